@@ -0,0 +1,161 @@
+package topk
+
+import (
+	"math"
+	"sort"
+)
+
+// AccuracyReport describes how well the top k elements reported by a sketch
+// match the exact counts of its input, e.g. to evaluate parameter choices on
+// a labeled sample of real data. It is meant to be marshalled as JSON.
+type AccuracyReport struct {
+	K int `json:"k"`
+	// Inserts is the total count and Distinct the number of keys of the
+	// exact counts.
+	Inserts  int `json:"inserts"`
+	Distinct int `json:"distinct"`
+
+	// Precision is the fraction of the reported elements that are among the
+	// exact top k, Recall the fraction of the exact top k that is reported.
+	Precision float64 `json:"precision_at_k"`
+	Recall    float64 `json:"recall_at_k"`
+	// MeanRankError and MaxRankError are the distance between the exact and
+	// the reported rank of the exact top k. Keys that are not reported are
+	// ranked k.
+	MeanRankError float64 `json:"mean_rank_error"`
+	MaxRankError  int     `json:"max_rank_error"`
+	// MeanRelativeError is the mean of |Count-exact|/exact over the
+	// reported elements.
+	MeanRelativeError float64 `json:"mean_relative_error"`
+
+	// Violations are the estimates whose bounds don't contain the exact
+	// count.
+	Violations []Violation `json:"violations"`
+	// Elements are the reported elements with their exact counts and ranks.
+	Elements []EvaluatedElement `json:"elements"`
+}
+
+// EvaluatedElement is a reported element together with its exact count and
+// its rank among all exact counts.
+type EvaluatedElement struct {
+	Element
+	Exact     int `json:"exact"`
+	Rank      int `json:"rank"`
+	ExactRank int `json:"exact_rank"`
+}
+
+// Evaluate compares the top k of result, ordered like Keys, with the exact
+// counts of the input. Exact ranks order keys by descending count, then by
+// key.
+func Evaluate(result []Element, exact map[string]int, k int) *AccuracyReport {
+	result = result[:min(k, len(result))]
+	r := &AccuracyReport{K: k, Distinct: len(exact)}
+
+	ranked := make([]string, 0, len(exact))
+	for key, c := range exact {
+		ranked = append(ranked, key)
+		r.Inserts += c
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		ci, cj := exact[ranked[i]], exact[ranked[j]]
+		return ci > cj || ci == cj && ranked[i] < ranked[j]
+	})
+	exactRank := make(map[string]int, len(ranked))
+	for i, key := range ranked {
+		exactRank[key] = i
+	}
+	top := ranked[:min(k, len(ranked))]
+
+	rank := make(map[string]int, len(result))
+	var relErr float64
+	for i, e := range result {
+		rank[e.Key] = i
+		x, ok := exact[e.Key]
+		er := len(ranked)
+		if ok {
+			er = exactRank[e.Key]
+		}
+		r.Elements = append(r.Elements, EvaluatedElement{Element: e, Exact: x, Rank: i, ExactRank: er})
+		if v, bad := checkBounds(e, x); bad {
+			r.Violations = append(r.Violations, v)
+		}
+		if er < k {
+			r.Precision++
+		}
+		relErr += math.Abs(float64(e.Count-int64(x))) / float64(max(x, 1))
+	}
+	if len(result) > 0 {
+		r.Precision /= float64(len(result))
+		r.MeanRelativeError = relErr / float64(len(result))
+	}
+
+	var rankErr int
+	for i, key := range top {
+		got, ok := rank[key]
+		if ok {
+			r.Recall++
+		} else {
+			got = k
+		}
+		d := max(got-i, i-got)
+		rankErr += d
+		r.MaxRankError = max(r.MaxRankError, d)
+	}
+	if len(top) > 0 {
+		r.Recall /= float64(len(top))
+		r.MeanRankError = float64(rankErr) / float64(len(top))
+	} else {
+		r.Precision, r.Recall = 1, 1
+	}
+	return r
+}
+
+// EvaluateSketch is like Evaluate for the results of s. If s can estimate
+// keys, like Stream and TopK, the estimates of all keys of exact are checked
+// for Violations as well, in key order.
+func EvaluateSketch(s Sketch, exact map[string]int, k int) *AccuracyReport {
+	r := Evaluate(s.Keys(), exact, k)
+	est, ok := s.(interface{ Estimate(string) Element })
+	if !ok {
+		return r
+	}
+	r.Violations = r.Violations[:0]
+	keys := make([]string, 0, len(exact))
+	for key := range exact {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if v, bad := checkBounds(est.Estimate(key), exact[key]); bad {
+			r.Violations = append(r.Violations, v)
+		}
+	}
+	return r
+}
+
+// ErrorRate returns the fraction of the reported elements whose guaranteed
+// count (Count-Error) is not within a factor of 1±epsilon of the exact
+// count.
+func (r *AccuracyReport) ErrorRate(epsilon float64) float64 {
+	if len(r.Elements) == 0 {
+		return 0
+	}
+	var bad int
+	for _, e := range r.Elements {
+		lo := int64(math.Floor(float64(e.Exact) * (1 - epsilon)))
+		hi := int64(math.Ceil(float64(e.Exact) * (1 + epsilon)))
+		if g := e.Count - e.Error; g < lo || g > hi {
+			bad++
+		}
+	}
+	return float64(bad) / float64(len(r.Elements))
+}
+
+// checkBounds returns the Violation of e if its bounds don't contain the
+// exact count.
+func checkBounds(e Element, exact int) (Violation, bool) {
+	if e.Count < int64(exact) || e.Count-e.Error > int64(exact) {
+		return Violation{Estimate: e, Exact: exact}, true
+	}
+	return Violation{}, false
+}
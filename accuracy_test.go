@@ -0,0 +1,71 @@
+package topk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	exact := map[string]int{"a": 10, "b": 8, "c": 5, "d": 1}
+	result := []Element{
+		{Key: "a", Count: 10},
+		{Key: "c", Count: 9, Error: 2},
+		{Key: "d", Count: 7, Error: 7},
+		{Key: "b", Count: 7},
+	}
+	r := Evaluate(result, exact, 3)
+	assert.Equal(t, 3, r.K)
+	assert.Equal(t, 24, r.Inserts)
+	assert.Equal(t, 4, r.Distinct)
+	assert.InDelta(t, 2.0/3, r.Precision, 1e-9)
+	assert.InDelta(t, 2.0/3, r.Recall, 1e-9)
+	// a is in place, b is ranked 3 instead of 1 and c 1 instead of 2
+	assert.InDelta(t, 1.0, r.MeanRankError, 1e-9)
+	assert.Equal(t, 2, r.MaxRankError)
+	assert.InDelta(t, (0+4.0/5+6)/3, r.MeanRelativeError, 1e-9)
+	assert.Equal(t, []Violation{{Estimate: Element{Key: "c", Count: 9, Error: 2}, Exact: 5}}, r.Violations)
+	assert.Equal(t, EvaluatedElement{Element: result[2], Exact: 1, Rank: 2, ExactRank: 3}, r.Elements[2])
+	assert.InDelta(t, 1.0/3, r.ErrorRate(0.1), 1e-9)
+
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	var got AccuracyReport
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, *r, got)
+
+	r = Evaluate(nil, nil, 3)
+	assert.Equal(t, 1.0, r.Precision)
+	assert.Equal(t, 1.0, r.Recall)
+}
+
+func TestEvaluateSketch(t *testing.T) {
+	tk := New(2)
+	tk.Insert("a", 5)
+	tk.Insert("b", 3)
+	tk.Insert("c", 1)
+
+	// d was never inserted, so its estimate falls short
+	exact := map[string]int{"a": 5, "b": 3, "c": 1, "d": 9}
+	r := EvaluateSketch(tk, exact, 2)
+	require.Len(t, r.Violations, 1)
+	assert.Equal(t, "d", r.Violations[0].Estimate.Key)
+	assert.Equal(t, 0.5, r.Precision)
+
+	// results alone are only checked as reported
+	r = EvaluateSketch(struct{ Sketch }{tk}, exact, 2)
+	assert.Empty(t, r.Violations)
+}
+
+func TestShadowReport(t *testing.T) {
+	s := NewShadow(New(5))
+	for _, w := range loadWords()[:20000] {
+		s.Insert(w, 1)
+	}
+	r := s.Report(5)
+	assert.Empty(t, r.Violations)
+	assert.Len(t, r.Elements, 5)
+	assert.Equal(t, 20000, r.Inserts)
+}
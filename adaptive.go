@@ -0,0 +1,109 @@
+package topk
+
+// Churn thresholds of the adaptive monitored set, in evictions per insert.
+const (
+	adaptGrowChurn   = 0.05
+	adaptShrinkChurn = 0.005
+)
+
+// adaptive resizes the monitored set based on eviction churn.
+type adaptive struct {
+	min, max int
+
+	// counters of the current period
+	inserts, evictions int
+	hit                map[string]struct{}
+
+	// totals, reported by Stats
+	totalEvictions int
+	grown, shrunk  int
+}
+
+// SetAdaptive lets the number of monitored elements vary between lo and
+// hi. Every period of as many inserts as elements are monitored, the
+// monitored set doubles if more than 5% of the inserts evicted an element,
+// i.e. the head of the distribution is flatter than the set can hold, and
+// shrinks by a quarter if fewer than 0.5% did, but never below the number of
+// distinct keys inserted during the period. Shrinking evicts the smallest
+// elements into the alphas; the alphas keep their size. Like any sketch, an
+// adaptive one can merge sketches monitoring at most as many elements as it
+// currently does, see Merge. A hi <= 0 disables adapting and keeps the
+// current size.
+func (s *Stream) SetAdaptive(lo, hi int) {
+	if hi <= 0 {
+		s.adapt = nil
+		return
+	}
+	lo = max(lo, 1)
+	s.adapt = &adaptive{min: lo, max: max(lo, hi), hit: make(map[string]struct{})}
+}
+
+// adaptInsert counts an insert and resizes the monitored set at the end of
+// a period.
+func (s *Stream) adaptInsert(x string) {
+	a := s.adapt
+	a.hit[x] = struct{}{}
+	if a.inserts++; a.inserts < s.n {
+		return
+	}
+	churn := float64(a.evictions) / float64(a.inserts)
+	// a flat head that just fits must not be shrunk into churning again
+	floor := max(a.min, len(a.hit))
+	a.inserts, a.evictions = 0, 0
+	clear(a.hit)
+	switch {
+	case churn > adaptGrowChurn && s.n < a.max:
+		s.n = min(2*s.n, a.max)
+		a.grown++
+	case churn < adaptShrinkChurn && s.n > floor:
+		s.n = max(s.n-s.n/4, floor)
+		for len(s.k.elts) > s.n {
+			e := s.k.pop()
+			xhash := reduce(s.sum(e.Key), len(s.alphas))
+			s.alphas[xhash] = s.evict.alpha(s.alphas[xhash], e)
+		}
+		a.shrunk++
+	}
+}
+
+// Stats describes the shape of a Stream and how it adapted.
+type Stats struct {
+	// Monitored is the number of elements that can be monitored.
+	Monitored int `json:"monitored"`
+	// Elements is the number of elements currently monitored.
+	Elements int `json:"elements"`
+	// Alphas is the number of alpha cells.
+	Alphas int `json:"alphas"`
+	// Saturated is set once a count reached the largest int64 instead of
+	// overflowing, see SetStrictCounts.
+	Saturated bool `json:"saturated"`
+
+	// The following are only counted with SetAdaptive.
+
+	// Evictions is the number of elements evicted by inserts.
+	Evictions int `json:"evictions"`
+	// Grown and Shrunk count the resizes of the monitored set.
+	Grown  int `json:"grown"`
+	Shrunk int `json:"shrunk"`
+
+	// Classes counts the inserts per Class, only with SetOverload.
+	Classes []ClassStats `json:"classes,omitempty"`
+}
+
+// Stats returns the current Stats.
+func (s *Stream) Stats() Stats {
+	st := Stats{
+		Monitored: s.n,
+		Elements:  len(s.k.elts),
+		Alphas:    len(s.alphas),
+		Saturated: s.saturated,
+	}
+	if s.adapt != nil {
+		st.Evictions = s.adapt.totalEvictions
+		st.Grown, st.Shrunk = s.adapt.grown, s.adapt.shrunk
+	}
+	if s.overload != nil {
+		st.Classes = s.overload.stats()
+	}
+	return st
+}
@@ -0,0 +1,37 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptive(t *testing.T) {
+	tk := NewWithMonitored(5, 10)
+	tk.SetAdaptive(10, 40)
+
+	// a flat distribution churns, growing the monitored set
+	for i := 0; i < 1000; i++ {
+		tk.Insert(fmt.Sprintf("flat-%d", i%30), 1)
+	}
+	st := tk.Stats()
+	// grown to the cap, then shrunk to the keys seen
+	assert.Equal(t, 30, st.Monitored)
+	assert.Equal(t, 2, st.Grown)
+	assert.Equal(t, 1, st.Shrunk)
+	assert.Greater(t, st.Evictions, 0)
+	assert.Len(t, tk.alphas, 60)
+
+	// a few heavy keys are stable, shrinking it back
+	for i := 0; i < 2000; i++ {
+		tk.Insert(fmt.Sprintf("heavy-%d", i%3), 100)
+	}
+	st = tk.Stats()
+	assert.Equal(t, 10, st.Monitored)
+	assert.LessOrEqual(t, st.Elements, 10)
+	assert.Greater(t, st.Shrunk, 0)
+	assert.Equal(t, "heavy-0", tk.Keys()[0].Key)
+
+	assert.Equal(t, Stats{Monitored: 10, Elements: 0, Alphas: 60}, NewWithMonitored(5, 10).Stats())
+}
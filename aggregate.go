@@ -0,0 +1,35 @@
+package topk
+
+// WithAggregator sets how inserts combine the count of a key with the
+// count inserted, by default their sum. The aggregate must be monotone,
+// never below the old count, e.g. max(old, delta) to rank endpoints by
+// their largest latency, with the latencies inserted as counts; results
+// below old count as old. An evicted key's count becomes the alpha of its
+// cell, and a key entering the monitored elements aggregates its insert
+// with that alpha, which is the Error of its element.
+//
+// Only inserts aggregate: the total count, Merge, Subtract, decay and the
+// bounds of guaranteed counts all assume sums, so with another aggregate
+// they hold only as far as it behaves like one.
+func WithAggregator(agg func(old, delta int64) int64) Option {
+	return func(c *config) { c.agg = agg }
+}
+
+// aggregate combines the count old of a key with the count delta inserted,
+// see WithAggregator.
+func (s *Stream) aggregate(old, delta int64) int64 {
+	sum, ok := s.aggregated(old, delta)
+	if !ok {
+		s.saturated = true
+	}
+	return sum
+}
+
+// aggregated is like aggregate, but reports saturation instead of recording
+// it, for callers that must not modify s.
+func (s *Stream) aggregated(old, delta int64) (int64, bool) {
+	if s.agg == nil {
+		return addCount(old, delta)
+	}
+	return max(s.agg(old, delta), old), true
+}
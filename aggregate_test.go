@@ -0,0 +1,43 @@
+package topk
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator(t *testing.T) {
+	largest := func(old, delta int64) int64 { return max(old, delta) }
+	tk := New(5, WithAggregator(largest))
+	exact := make(map[string]int)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 10000; i++ {
+		x := fmt.Sprintf("endpoint-%d", rng.IntN(200))
+		latency := rng.IntN(1000)
+		if i%1000 == 999 {
+			x, latency = "endpoint-7", 5000+i
+		}
+		exact[x] = max(exact[x], latency)
+		tk.Insert(x, latency)
+	}
+
+	// the largest latencies are estimated from above
+	keys := tk.Keys()
+	assert.Equal(t, "endpoint-7", keys[0].Key)
+	assert.Equal(t, int64(exact["endpoint-7"]), keys[0].Count)
+	for _, e := range tk.Stream.k.elts {
+		assert.GreaterOrEqual(t, e.Count, int64(exact[e.Key]), e.Key)
+	}
+
+	// results below the old count count as the old one
+	tk = New(5, WithAggregator(func(old, delta int64) int64 { return delta }))
+	tk.Insert("a", 10)
+	assert.Equal(t, int64(10), tk.Insert("a", 3).Count)
+
+	// the default sums
+	tk = New(5, WithAggregator(nil))
+	tk.Insert("a", 10)
+	assert.Equal(t, int64(13), tk.Insert("a", 3).Count)
+}
@@ -0,0 +1,36 @@
+package topk
+
+import "math"
+
+// audit forwards a keyed sample of the inserts of a Stream.
+type audit struct {
+	threshold uint64 // keys hashing below it are sampled
+	sink      func(key string, w int)
+}
+
+// AuditSample forwards the inserts of a sample of the keys to sink, e.g. to
+// count them exactly and verify the estimates of the Stream against them.
+// The sample is keyed: a key is either forwarded on every insert or never,
+// chosen by its hash, so that the exact counts of the sampled keys are
+// complete. rate is the expected fraction of sampled keys; a rate <= 0 or
+// a nil sink disables sampling. Inserts are counted as usual.
+func (s *Stream) AuditSample(rate float64, sink func(key string, w int)) {
+	if rate <= 0 || sink == nil {
+		s.audit = nil
+		return
+	}
+	threshold := uint64(math.MaxUint32) + 1
+	if rate < 1 {
+		threshold = uint64(rate * (1 << 32))
+	}
+	s.audit = &audit{threshold: threshold, sink: sink}
+}
+
+// sample forwards the insert of x if its hash h is sampled. Alpha cells
+// are chosen by the lower 32 bits of the hash, so the sample uses the
+// upper ones.
+func (a *audit) sample(x string, count int, h uint64) {
+	if h>>32 < a.threshold {
+		a.sink(x, count)
+	}
+}
@@ -0,0 +1,41 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditSample(t *testing.T) {
+	tk := New(10)
+	exact := make(map[string]int)
+	tk.AuditSample(0.25, func(key string, w int) { exact[key] += w })
+
+	for i := 0; i < 10000; i++ {
+		tk.Insert(fmt.Sprintf("key-%d", i%1000), 1+i%3)
+	}
+
+	// about a quarter of the keys, with all of their inserts
+	assert.InDelta(t, 250, len(exact), 50)
+	for k, c := range exact {
+		assert.GreaterOrEqual(t, tk.Estimate(k).Count, int64(c))
+	}
+
+	// counting is unaffected
+	tk2 := New(10)
+	all := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		tk2.Insert(fmt.Sprintf("key-%d", i%1000), 1+i%3)
+		all[fmt.Sprintf("key-%d", i%1000)] += 1 + i%3
+	}
+	assert.Equal(t, tk2.Keys(), tk.Keys())
+	for k, c := range exact {
+		assert.Equal(t, all[k], c, k)
+	}
+
+	n := len(exact)
+	tk.AuditSample(0, nil)
+	tk.Insert("key-1", 1)
+	assert.Len(t, exact, n)
+}
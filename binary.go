@@ -0,0 +1,34 @@
+package topk
+
+import "bytes"
+
+// MarshalBinary implements encoding.BinaryMarshaler with the encoding of
+// Encode.
+func (s *Stream) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := s.Encode(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, like Decode.
+func (s *Stream) UnmarshalBinary(data []byte) error {
+	return s.Decode(bytes.NewReader(data))
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler with the encoding of
+// Encode. It is needed so that the embedded Stream's method doesn't drop
+// the fields of the TopK.
+func (t *TopK) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := t.Encode(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, like Decode.
+func (t *TopK) UnmarshalBinary(data []byte) error {
+	return t.Decode(bytes.NewReader(data))
+}
@@ -0,0 +1,40 @@
+package topk
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Stream)(nil)
+	_ encoding.BinaryUnmarshaler = (*Stream)(nil)
+	_ encoding.BinaryMarshaler   = (*TopK)(nil)
+	_ encoding.BinaryUnmarshaler = (*TopK)(nil)
+)
+
+func TestMarshalBinary(t *testing.T) {
+	tk := New(3)
+	for i, k := range []string{"a", "b", "a", "c", "a", "b"} {
+		tk.Insert(k, i+1)
+	}
+
+	data, err := tk.Stream.MarshalBinary()
+	require.NoError(t, err)
+	s := &Stream{}
+	require.NoError(t, s.UnmarshalBinary(data))
+	assert.Equal(t, tk.Stream.Keys(), s.Keys())
+
+	// gob goes through MarshalBinary, keeping k and the count
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, gob.NewEncoder(buf).Encode(tk))
+	tk2 := &TopK{}
+	require.NoError(t, gob.NewDecoder(buf).Decode(tk2))
+	assert.Equal(t, tk, tk2)
+
+	assert.Error(t, s.UnmarshalBinary([]byte{0xc1}))
+}
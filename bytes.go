@@ -0,0 +1,49 @@
+package topk
+
+import "unsafe"
+
+// InsertBytes is like Insert, but only allocates a string for x when x is
+// admitted to the monitored elements. To avoid the allocation, the Key of
+// the returned Element is empty if x is not monitored. With a clock,
+// emerging keys, adaptive sizing or audit sampling enabled, x is always
+// copied, since they retain keys.
+func (s *Stream) InsertBytes(x []byte, count int) Element {
+	if s.clock == nil && s.emerging == nil && s.adapt == nil && s.audit == nil {
+		key := bytesView(x)
+		// neither path retains key
+		if _, ok := s.k.m[key]; ok {
+			return s.Insert(key, count)
+		}
+		if admit, _ := s.WouldAdmit(key, count); !admit {
+			e := s.Insert(key, count)
+			e.Key = ""
+			return e
+		}
+	}
+	return s.Insert(string(x), count)
+}
+
+// EstimateBytes is like Estimate, but doesn't allocate. The Key of the
+// returned Element is empty if x is not monitored.
+func (s *Stream) EstimateBytes(x []byte) Element {
+	e := s.Estimate(bytesView(x))
+	if _, ok := s.k.m[bytesView(x)]; !ok {
+		e.Key = ""
+	}
+	return e
+}
+
+// InsertBytes is like Insert, but avoids allocating for x. See
+// Stream.InsertBytes.
+func (t *TopK) InsertBytes(x []byte, count int) Element {
+	if t.halfLife > 0 {
+		t.autoDecay()
+	}
+	return t.Stream.InsertBytes(x, count)
+}
+
+// bytesView returns a string sharing memory with b. It must not be retained
+// beyond the lifetime of b.
+func bytesView(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
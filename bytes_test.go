@@ -0,0 +1,40 @@
+package topk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertBytes(t *testing.T) {
+	buf := []byte("foo")
+	tk := NewWithScaleFactor(1, 1)
+	assert.Equal(t, Element{Key: "foo", Count: 2}, tk.InsertBytes(buf, 2))
+	assert.Equal(t, Element{Key: "foo", Count: 3}, tk.InsertBytes(buf, 1))
+
+	// the monitored key doesn't share memory with buf
+	copy(buf, "bar")
+	assert.Equal(t, []Element{{Key: "foo", Count: 3}}, tk.Keys())
+
+	// rejected
+	assert.Equal(t, Element{Count: 1}, tk.InsertBytes(buf, 1))
+	assert.Equal(t, Element{Count: 1, Error: 1}, tk.EstimateBytes(buf))
+	assert.Equal(t, int64(4), tk.Count())
+
+	// admitted, evicting foo
+	assert.Equal(t, Element{Key: "bar", Count: 4, Error: 1}, tk.InsertBytes(buf, 3))
+	copy(buf, "xxx")
+	assert.Equal(t, []Element{{Key: "bar", Count: 4, Error: 1}}, tk.Keys())
+	assert.Equal(t, Element{Key: "bar", Count: 4, Error: 1}, tk.EstimateBytes([]byte("bar")))
+}
+
+func TestInsertBytesAllocs(t *testing.T) {
+	tk := NewWithScaleFactor(1, 1)
+	tk.Insert("foo", 1000)
+	buf, foo := []byte("bar"), []byte("foo")
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		tk.InsertBytes(buf, 1)
+		tk.InsertBytes(foo, 1)
+		tk.EstimateBytes(buf)
+	}))
+}
@@ -0,0 +1,61 @@
+package topk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// VerifyChain checks the segments in the root directory of fsys before they
+// are replayed: in the order of their names, a snapshot written by Encode
+// followed by deltas written by EncodeDelta, each against the state that the
+// segments before it lead to. Each delta records the fingerprint of that
+// state, so a missing, reordered or repeated delta is detected, and the
+// checksum of every segment detects corrupt or tampered ones. Segments are
+// decoded with the configuration of s, which is not modified. The error names
+// the first segment that breaks the chain and wraps ErrDeltaBase if the chain
+// has a gap.
+func (s *Stream) VerifyChain(fsys fs.FS) error {
+	state := emptyLike(s)
+	return verifyChain(fsys, state.Decode, state.ApplyDelta)
+}
+
+// VerifyChain checks the chain of a snapshot written by TopK.Encode and
+// deltas written by TopK.EncodeDelta. See Stream.VerifyChain.
+func (t *TopK) VerifyChain(fsys fs.FS) error {
+	state := &TopK{k: t.k, Stream: emptyLike(t.Stream)}
+	return verifyChain(fsys, state.Decode, state.ApplyDelta)
+}
+
+// verifyChain decodes the first segment in fsys and applies the others.
+func verifyChain(fsys fs.FS, decode, apply func(io.Reader) error) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	first := true
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return err
+		}
+		if first {
+			err = decode(bytes.NewReader(data))
+		} else {
+			err = apply(bytes.NewReader(data))
+		}
+		if err != nil {
+			return fmt.Errorf("topk: segment %s: %w", e.Name(), err)
+		}
+		first = false
+	}
+	if first {
+		return errors.New("topk: no segments")
+	}
+	return nil
+}
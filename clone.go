@@ -0,0 +1,51 @@
+package topk
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+)
+
+// Clone returns a deep copy of s, e.g. a snapshot for a reader while s
+// keeps counting, without going through Encode and Decode. The copy has the
+// same configuration; functions like the clock or the pipeline stages are
+// shared, while the hook set with OnPromote is not copied.
+func (s *Stream) Clone() *Stream {
+	c := *s
+	c.k = keys{m: maps.Clone(s.k.m), elts: slices.Clone(s.k.elts)}
+	c.alphas = slices.Clone(s.alphas)
+	c.touched = maps.Clone(s.touched)
+	c.pipeline = slices.Clone(s.pipeline)
+	c.promote = nil
+	if s.quota != nil {
+		q := *s.quota
+		q.used = maps.Clone(q.used)
+		c.quota = &q
+	}
+	if s.overload != nil {
+		o := *s.overload
+		o.classes = make(map[Class]*classCount, len(o.classes))
+		for class, cc := range s.overload.classes {
+			o.classes[class] = &classCount{inserts: cc.inserts, dropped: cc.dropped}
+		}
+		// the sampling of the copy starts over
+		o.rng = rand.New(rand.NewPCG(uint64(o.limit), uint64(o.sample)))
+		c.overload = &o
+	}
+	if s.emerging != nil {
+		c.emerging = &emerging{Stream: s.emerging.Clone(), inserts: s.emerging.inserts}
+	}
+	if s.adapt != nil {
+		a := *s.adapt
+		a.hit = maps.Clone(a.hit)
+		c.adapt = &a
+	}
+	return &c
+}
+
+// Clone returns a deep copy of t. See Stream.Clone.
+func (t *TopK) Clone() *TopK {
+	c := *t
+	c.Stream = t.Stream.Clone()
+	return &c
+}
@@ -0,0 +1,57 @@
+package topk
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	tk := New(10)
+	now := time.Unix(1, 0)
+	tk.SetClock(func() time.Time { return now })
+	tk.EnableEmerging(16)
+	tk.SetSourceQuota(1000, time.Minute)
+	for i := 0; i < 1000; i++ {
+		tk.InsertFrom("src", fmt.Sprintf("word-%d", i%(1+i%40)), 1)
+	}
+
+	c := tk.Clone()
+	// functions never compare equal
+	clock := tk.clock
+	tk.clock, c.clock = nil, nil
+	assert.Equal(t, tk, c)
+	tk.clock, c.clock = clock, clock
+	assert.Equal(t, tk.Keys(), c.Keys())
+
+	// the copies are independent
+	c.Insert("new", 1000)
+	c.InsertFrom("src", "word-1", 1)
+	assert.NotEqual(t, tk.Keys(), c.Keys())
+	assert.Equal(t, 1000, tk.quota.used["src"])
+	assert.NotEqual(t, tk.Count(), c.Count())
+	assert.NotEqual(t, tk.touched, c.touched)
+}
+
+func BenchmarkClone(b *testing.B) {
+	tk := New(100)
+	for i := 0; i < 100000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%(1+i%1000)), 1)
+	}
+	b.Run("Clone", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tk.Clone()
+		}
+	})
+	b.Run("Encode", func(b *testing.B) {
+		var buf bytes.Buffer
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			tk.Encode(&buf)
+			(&TopK{}).Decode(&buf)
+		}
+	})
+}
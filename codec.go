@@ -0,0 +1,73 @@
+package topk
+
+import "fmt"
+
+// Snapshots are MessagePack encoded. By default the encoding is done with
+// github.com/tinylib/msgp, which also provides the EncodeMsgp/DecodeMsgp
+// methods. Building with the topk_nomsgp tag replaces it with a small
+// built-in codec writing the same format, for builds that can't or don't
+// want to depend on msgp.
+
+// encoder is the subset of *msgp.Writer used for encoding.
+type encoder interface {
+	WriteInt(i int) error
+	WriteInt64(i int64) error
+	WriteString(s string) error
+	WriteMapHeader(sz uint32) error
+	WriteArrayHeader(sz uint32) error
+	Flush() error
+}
+
+// decoder is the subset of *msgp.Reader used for decoding.
+type decoder interface {
+	ReadInt() (int, error)
+	ReadInt64() (int64, error)
+	ReadString() (string, error)
+	ReadMapHeader() (uint32, error)
+	ReadArrayHeader() (uint32, error)
+}
+
+// Snapshots start with formatMagic followed by the format version. The
+// magic is negative and doesn't fit the extension bits of hash.go, so it
+// can't be mistaken for the first int of a snapshot written before the
+// header was introduced, which is read as version 0. Version 2 snapshots
+// end with a checksum, see checksumSize; version 1 is still written by
+// EncodeMsgp, whose output may be embedded in other data.
+const (
+	formatMagic   = -0x746f706b // "topk"
+	formatVersion = 2
+)
+
+// VersionError is returned when decoding a snapshot written in a format
+// version this package doesn't know, e.g. by a newer release.
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("topk: unsupported snapshot version %d, expected at most %d", e.Version, formatVersion)
+}
+
+func writeHeader(w encoder, version int) error {
+	if err := w.WriteInt(formatMagic); err != nil {
+		return err
+	}
+	return w.WriteInt(version)
+}
+
+// readHeader reads the header of a snapshot, if any, and returns the first
+// int following it.
+func readHeader(r decoder) (int, error) {
+	i, err := r.ReadInt()
+	if err != nil || i != formatMagic {
+		return i, err
+	}
+	version, err := r.ReadInt()
+	if err != nil {
+		return 0, err
+	}
+	if version < 1 || version > formatVersion {
+		return 0, &VersionError{Version: version}
+	}
+	return r.ReadInt()
+}
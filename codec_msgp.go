@@ -0,0 +1,57 @@
+//go:build !topk_nomsgp
+
+package topk
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+func newEncoder(w io.Writer) encoder { return msgp.NewWriter(w) }
+
+func newDecoder(r io.Reader) decoder { return msgpDecoder{msgp.NewReader(r)} }
+
+// msgpDecoder bounds the length of strings, which msgp would allocate
+// before reading them.
+type msgpDecoder struct {
+	*msgp.Reader
+}
+
+func (r msgpDecoder) ReadString() (string, error) {
+	sz, err := r.ReadStringHeader()
+	if err != nil {
+		return "", err
+	}
+	if sz > maxDecodeKeyLen {
+		return "", fmt.Errorf("%w: key of %d bytes", ErrCorruptSnapshot, sz)
+	}
+	b := make([]byte, sz)
+	if _, err := r.ReadFull(b); err != nil {
+		return "", err
+	}
+	return bytesView(b), nil
+}
+
+// EncodeMsgp ...
+func (s *Stream) EncodeMsgp(w *msgp.Writer) error {
+	return s.encode(w, encodeUnchecked)
+}
+
+// DecodeMsgp ...
+// On error, the Stream is left unmodified.
+func (s *Stream) DecodeMsgp(r *msgp.Reader) error {
+	return s.decode(msgpDecoder{r})
+}
+
+// EncodeMsgp ...
+func (t *TopK) EncodeMsgp(w *msgp.Writer) error {
+	return t.encode(w, encodeUnchecked)
+}
+
+// DecodeMsgp ...
+// On error, the TopK is left unmodified.
+func (t *TopK) DecodeMsgp(r *msgp.Reader) error {
+	return t.decode(msgpDecoder{r}, false)
+}
@@ -0,0 +1,272 @@
+//go:build topk_nomsgp
+
+package topk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The subset of MessagePack written by msgp for the types used in snapshots.
+const (
+	mfixmap   = 0x80
+	mfixarray = 0x90
+	mfixstr   = 0xa0
+	muint8    = 0xcc
+	muint16   = 0xcd
+	muint32   = 0xce
+	muint64   = 0xcf
+	mint8     = 0xd0
+	mint16    = 0xd1
+	mint32    = 0xd2
+	mint64    = 0xd3
+	mstr8     = 0xd9
+	mstr16    = 0xda
+	mstr32    = 0xdb
+	marray16  = 0xdc
+	marray32  = 0xdd
+	mmap16    = 0xde
+	mmap32    = 0xdf
+)
+
+type writer struct {
+	w   *bufio.Writer
+	buf [9]byte
+}
+
+func newEncoder(w io.Writer) encoder { return &writer{w: bufio.NewWriter(w)} }
+
+func (w *writer) prefix(lead byte, v uint64, n int) error {
+	w.buf[0] = lead
+	for i := n; i > 0; i-- {
+		w.buf[i] = byte(v)
+		v >>= 8
+	}
+	_, err := w.w.Write(w.buf[:n+1])
+	return err
+}
+
+func (w *writer) WriteInt(i int) error { return w.WriteInt64(int64(i)) }
+
+func (w *writer) WriteInt64(v int64) error {
+	if v >= 0 {
+		switch {
+		case v <= math.MaxInt8:
+			return w.w.WriteByte(byte(v))
+		case v <= math.MaxInt16:
+			return w.prefix(mint16, uint64(v), 2)
+		case v <= math.MaxInt32:
+			return w.prefix(mint32, uint64(v), 4)
+		default:
+			return w.prefix(mint64, uint64(v), 8)
+		}
+	}
+	switch {
+	case v >= -32:
+		return w.w.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		return w.prefix(mint8, uint64(v), 1)
+	case v >= math.MinInt16:
+		return w.prefix(mint16, uint64(v), 2)
+	case v >= math.MinInt32:
+		return w.prefix(mint32, uint64(v), 4)
+	default:
+		return w.prefix(mint64, uint64(v), 8)
+	}
+}
+
+func (w *writer) WriteString(s string) error {
+	var err error
+	switch sz := len(s); {
+	case sz <= 31:
+		err = w.w.WriteByte(mfixstr | byte(sz))
+	case sz <= math.MaxUint8:
+		err = w.prefix(mstr8, uint64(sz), 1)
+	case sz <= math.MaxUint16:
+		err = w.prefix(mstr16, uint64(sz), 2)
+	default:
+		err = w.prefix(mstr32, uint64(sz), 4)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.w.WriteString(s)
+	return err
+}
+
+func (w *writer) header(sz uint32, fix, lead16, lead32 byte) error {
+	switch {
+	case sz <= 15:
+		return w.w.WriteByte(fix | byte(sz))
+	case sz <= math.MaxUint16:
+		return w.prefix(lead16, uint64(sz), 2)
+	default:
+		return w.prefix(lead32, uint64(sz), 4)
+	}
+}
+
+func (w *writer) WriteMapHeader(sz uint32) error {
+	return w.header(sz, mfixmap, mmap16, mmap32)
+}
+
+func (w *writer) WriteArrayHeader(sz uint32) error {
+	return w.header(sz, mfixarray, marray16, marray32)
+}
+
+func (w *writer) Flush() error { return w.w.Flush() }
+
+type reader struct {
+	r   *bufio.Reader
+	buf [8]byte
+}
+
+func newDecoder(r io.Reader) decoder { return &reader{r: bufio.NewReader(r)} }
+
+// next reads n bytes; running out of input after the first byte of a value
+// is an unexpected EOF.
+func (r *reader) next(n int) ([]byte, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return r.buf[:n], nil
+}
+
+func (r *reader) uint(n int) (uint64, error) {
+	p, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range p {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func (r *reader) ReadInt() (int, error) {
+	i, err := r.ReadInt64()
+	if err != nil {
+		return 0, err
+	}
+	if int64(int(i)) != i {
+		return 0, fmt.Errorf("topk: int overflow: %d", i)
+	}
+	return int(i), nil
+}
+
+func (r *reader) ReadInt64() (int64, error) {
+	lead, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case lead <= 0x7f:
+		return int64(lead), nil
+	case lead >= 0xe0:
+		return int64(int8(lead)), nil
+	}
+
+	var v uint64
+	switch lead {
+	case muint8, mint8:
+		v, err = r.uint(1)
+	case muint16, mint16:
+		v, err = r.uint(2)
+	case muint32, mint32:
+		v, err = r.uint(4)
+	case muint64, mint64:
+		v, err = r.uint(8)
+	default:
+		return 0, fmt.Errorf("topk: expected int, found prefix 0x%x", lead)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var i int64
+	switch lead {
+	case mint8:
+		i = int64(int8(v))
+	case mint16:
+		i = int64(int16(v))
+	case mint32:
+		i = int64(int32(v))
+	case muint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("topk: int overflow: %d", v)
+		}
+		i = int64(v)
+	default:
+		i = int64(v)
+	}
+	return i, nil
+}
+
+func (r *reader) ReadString() (string, error) {
+	lead, err := r.r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var sz uint64
+	switch {
+	case lead&0xe0 == mfixstr:
+		sz = uint64(lead & 0x1f)
+	case lead == mstr8:
+		sz, err = r.uint(1)
+	case lead == mstr16:
+		sz, err = r.uint(2)
+	case lead == mstr32:
+		sz, err = r.uint(4)
+	default:
+		return "", fmt.Errorf("topk: expected string, found prefix 0x%x", lead)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if sz > maxDecodeKeyLen {
+		return "", fmt.Errorf("%w: key of %d bytes", ErrCorruptSnapshot, sz)
+	}
+	b := make([]byte, sz)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r *reader) header(fix, lead16, lead32 byte, what string) (uint32, error) {
+	lead, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var sz uint64
+	switch {
+	case lead&0xf0 == fix:
+		return uint32(lead & 0x0f), nil
+	case lead == lead16:
+		sz, err = r.uint(2)
+	case lead == lead32:
+		sz, err = r.uint(4)
+	default:
+		return 0, fmt.Errorf("topk: expected %s, found prefix 0x%x", what, lead)
+	}
+	return uint32(sz), err
+}
+
+func (r *reader) ReadMapHeader() (uint32, error) {
+	return r.header(mfixmap, mmap16, mmap32, "map")
+}
+
+func (r *reader) ReadArrayHeader() (uint32, error) {
+	return r.header(mfixarray, marray16, marray32, "array")
+}
@@ -0,0 +1,127 @@
+package topk
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden snapshot")
+
+// TestGoldenSnapshot checks that both codecs write and read the same bytes;
+// run it with and without the topk_nomsgp tag.
+func TestGoldenSnapshot(t *testing.T) {
+	if defaultHash != hashMetro {
+		t.Skip("the golden snapshot is hashed with metro")
+	}
+	tk := New(10)
+	tk.Insert("small", 1)
+	tk.Insert("medium", 300)
+	tk.Insert("large", 70000)
+	tk.Insert("huge", 1<<20)
+	tk.Insert(strings.Repeat("k", 40), 2)
+	tk.Insert(strings.Repeat("l", 300), 3)
+	for i := 0; i < 20; i++ {
+		tk.Insert(strings.Repeat("m", i), 1)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, tk.EncodeDeterministic(buf))
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile("testdata/golden.msgp", buf.Bytes(), 0o644))
+	}
+
+	golden, err := os.ReadFile("testdata/golden.msgp")
+	assert.NoError(t, err)
+	assert.Equal(t, golden, buf.Bytes())
+
+	decoded := &TopK{}
+	assert.NoError(t, decoded.Decode(bytes.NewReader(golden)))
+	assert.Equal(t, tk.Keys(), decoded.Keys())
+	assert.Equal(t, tk.Count(), decoded.Count())
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	if defaultHash != hashMetro {
+		t.Skip("the golden snapshot is hashed with metro")
+	}
+	// snapshots written before the header was introduced still decode
+	v0, err := os.ReadFile("testdata/golden_v0.msgp")
+	assert.NoError(t, err)
+	golden, err := os.ReadFile("testdata/golden.msgp")
+	assert.NoError(t, err)
+	tk0, tk1 := &TopK{}, &TopK{}
+	assert.NoError(t, tk0.Decode(bytes.NewReader(v0)))
+	assert.NoError(t, tk1.Decode(bytes.NewReader(golden)))
+	assert.Equal(t, tk1, tk0)
+
+	// unknown versions are rejected
+	buf := bytes.NewBuffer(nil)
+	enc := newEncoder(buf)
+	assert.NoError(t, enc.WriteInt(formatMagic))
+	assert.NoError(t, enc.WriteInt(formatVersion+1))
+	assert.NoError(t, enc.Flush())
+	buf.Write(golden[6:])
+	var verr *VersionError
+	assert.ErrorAs(t, tk1.Decode(bytes.NewReader(buf.Bytes())), &verr)
+	assert.Equal(t, formatVersion+1, verr.Version)
+	assert.ErrorAs(t, (&Stream{}).Decode(bytes.NewReader(buf.Bytes())), &verr)
+	assert.Equal(t, tk0, tk1)
+}
+
+func TestEncodeCompact(t *testing.T) {
+	tk := New(50)
+	for i := 0; i < 10000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%(1+i%500)), 1)
+	}
+
+	full, compact := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	assert.NoError(t, tk.Encode(full))
+	assert.NoError(t, tk.EncodeCompact(compact))
+	// every alpha but one takes at least a byte
+	assert.LessOrEqual(t, compact.Len(), full.Len()-len(tk.alphas)+1)
+
+	decoded := &TopK{}
+	assert.NoError(t, decoded.Decode(compact))
+	assert.Equal(t, tk.Keys(), decoded.Keys())
+	assert.Equal(t, tk.Count(), decoded.Count())
+	assert.Len(t, decoded.alphas, 1)
+	for i := 0; i < 500; i++ {
+		x := fmt.Sprintf("word-%d", i)
+		assert.GreaterOrEqual(t, decoded.Estimate(x).Count, tk.Estimate(x).Count, x)
+	}
+	assert.Error(t, decoded.Merge(tk))
+}
+
+func TestChecksum(t *testing.T) {
+	tk := New(5)
+	for i := 0; i < 100; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%20), i)
+	}
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, tk.Encode(buf))
+	data := buf.Bytes()
+
+	// a flipped bit in the alphas would still decode
+	data[len(data)/2] ^= 1
+	decoded := &TopK{}
+	assert.ErrorIs(t, decoded.Decode(bytes.NewReader(data)), ErrChecksumMismatch)
+	data[len(data)/2] ^= 1
+	assert.NoError(t, decoded.Decode(bytes.NewReader(data)))
+	assert.Equal(t, tk, decoded)
+
+	// snapshots without a checksum are read as before
+	buf.Reset()
+	enc := newEncoder(buf)
+	assert.NoError(t, tk.encode(enc, encodeUnchecked))
+	assert.NoError(t, enc.Flush())
+	assert.Equal(t, len(data)-checksumSize, buf.Len())
+	decoded = &TopK{}
+	assert.NoError(t, decoded.Decode(buf))
+	assert.Equal(t, tk, decoded)
+}
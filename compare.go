@@ -0,0 +1,174 @@
+package topk
+
+import "math"
+
+// Sketch is a sketch that can be fed and queried for its top elements.
+// Both *Stream and *TopK implement it.
+type Sketch interface {
+	Insert(x string, count int) Element
+	Keys() []Element
+}
+
+// Divergence describes how far apart the top elements of two sketches are.
+type Divergence struct {
+	// SymmetricDifference is the number of keys in only one of the results.
+	SymmetricDifference int `json:"symmetric_difference"`
+	// Jaccard is the Jaccard index of the keys of both results.
+	Jaccard float64 `json:"jaccard"`
+	// RankCorrelation is the Kendall tau of both results.
+	RankCorrelation float64 `json:"rank_correlation"`
+}
+
+// Compare returns the Divergence between the top n elements of a and b.
+// Nothing is compared if n <= 0, so both are treated as empty.
+func Compare(a, b []Element, n int) Divergence {
+	if n <= 0 {
+		return Divergence{Jaccard: 1, RankCorrelation: 1}
+	}
+	a, b = a[:min(n, len(a))], b[:min(n, len(b))]
+	common := intersection(a, b)
+	return Divergence{
+		SymmetricDifference: len(a) + len(b) - 2*common,
+		Jaccard:             jaccard(len(a), len(b), common),
+		RankCorrelation:     KendallTau(a, b),
+	}
+}
+
+// JaccardAt returns the Jaccard index of the keys of the top n elements of a
+// and b: the size of their intersection divided by the size of their union.
+// It is 1 if both are empty, or n <= 0.
+func JaccardAt(a, b []Element, n int) float64 {
+	if n <= 0 {
+		return 1
+	}
+	a, b = a[:min(n, len(a))], b[:min(n, len(b))]
+	return jaccard(len(a), len(b), intersection(a, b))
+}
+
+// intersection returns the number of keys in both a and b.
+func intersection(a, b []Element) int {
+	keys := make(map[string]struct{}, len(a))
+	for _, e := range a {
+		keys[e.Key] = struct{}{}
+	}
+	common := 0
+	for _, e := range b {
+		if _, ok := keys[e.Key]; ok {
+			common++
+		}
+	}
+	return common
+}
+
+// jaccard returns the Jaccard index of sets of sizes na and nb with common
+// elements in common.
+func jaccard(na, nb, common int) float64 {
+	if na == 0 && nb == 0 {
+		return 1
+	}
+	return float64(common) / float64(na+nb-common)
+}
+
+// KendallTau returns the Kendall rank correlation (tau-b) between a and b,
+// between -1 for reversed and 1 for identical rankings. Elements are ranked
+// by Count, so equal counts are ties. Keys missing from one result are
+// ranked below all of its elements, tied with each other. It is 1 if there
+// is nothing to compare.
+func KendallTau(a, b []Element) float64 {
+	ca := make(map[string]int64, len(a))
+	for _, e := range a {
+		ca[e.Key] = e.Count
+	}
+	cb := make(map[string]int64, len(b))
+	for _, e := range b {
+		cb[e.Key] = e.Count
+	}
+
+	// counts of both results for the union of the keys, -1 if missing
+	var xs, ys []int64
+	for _, e := range a {
+		xs = append(xs, e.Count)
+		ys = append(ys, countOr(cb, e.Key, -1))
+	}
+	for _, e := range b {
+		if _, ok := ca[e.Key]; !ok {
+			xs = append(xs, -1)
+			ys = append(ys, e.Count)
+		}
+	}
+
+	var concordant, discordant, tiesA, tiesB, pairs int
+	for i := range xs {
+		for j := i + 1; j < len(xs); j++ {
+			pairs++
+			dx, dy := sign(xs[i]-xs[j]), sign(ys[i]-ys[j])
+			switch {
+			case dx == 0 && dy == 0:
+				tiesA++
+				tiesB++
+			case dx == 0:
+				tiesA++
+			case dy == 0:
+				tiesB++
+			case dx == dy:
+				concordant++
+			default:
+				discordant++
+			}
+		}
+	}
+
+	denom := math.Sqrt(float64(pairs-tiesA) * float64(pairs-tiesB))
+	if denom == 0 {
+		return 1
+	}
+	return float64(concordant-discordant) / denom
+}
+
+func countOr(m map[string]int64, key string, def int64) int64 {
+	if c, ok := m[key]; ok {
+		return c
+	}
+	return def
+}
+
+func sign(x int64) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+// Comparison feeds the same inserts to two sketches, e.g. an old and a new
+// configuration during a shadow launch, and reports how far apart their
+// results are.
+type Comparison struct {
+	A, B Sketch
+	// N is the number of top elements compared.
+	N int
+	// If Report is set, it is called with the current Divergence every
+	// Every inserts.
+	Report func(Divergence)
+	Every  int
+
+	inserts int
+}
+
+// Insert inserts x into both sketches.
+func (c *Comparison) Insert(x string, count int) {
+	c.A.Insert(x, count)
+	c.B.Insert(x, count)
+
+	c.inserts++
+	if c.Report != nil && c.Every > 0 && c.inserts%c.Every == 0 {
+		c.Report(c.Divergence())
+	}
+}
+
+// Divergence compares the current top N elements of both sketches.
+func (c *Comparison) Divergence() Divergence {
+	return Compare(c.A.Keys(), c.B.Keys(), c.N)
+}
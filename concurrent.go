@@ -0,0 +1,150 @@
+package topk
+
+import (
+	"io"
+	"sync"
+)
+
+// ConcurrentStream is a Stream safe for concurrent use. Inserts and merges
+// are serialized, while Keys and Estimate only take a read lock, so queries
+// don't block each other.
+type ConcurrentStream struct {
+	mu sync.RWMutex
+	s  *Stream
+
+	// view shares s since the last Snapshot, until the next write
+	view *View
+}
+
+// Safe wraps s for concurrent use. s must not be used directly afterwards,
+// other than through Do.
+func Safe(s *Stream) *ConcurrentStream {
+	return &ConcurrentStream{s: s}
+}
+
+// Insert ...
+func (c *ConcurrentStream) Insert(x string, count int) Element {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.own()
+	return c.s.Insert(x, count)
+}
+
+// Merge merges other into the Stream. other must not be modified
+// concurrently.
+func (c *ConcurrentStream) Merge(other *Stream) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.own()
+	return c.s.Merge(other)
+}
+
+// Keys returns a copy of the current estimates for the most frequent
+// elements.
+func (c *ConcurrentStream) Keys() []Element {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Keys()
+}
+
+// Estimate ...
+func (c *ConcurrentStream) Estimate(x string) Element {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Estimate(x)
+}
+
+// Encode ...
+func (c *ConcurrentStream) Encode(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Encode(w)
+}
+
+// Decode replaces the Stream with the decoded snapshot, see Stream.Decode.
+func (c *ConcurrentStream) Decode(r io.Reader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.own()
+	return c.s.Decode(r)
+}
+
+// Stats ...
+func (c *ConcurrentStream) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Stats()
+}
+
+// Do calls fn with the wrapped Stream under the write lock, for the methods
+// not wrapped by ConcurrentStream. fn must not retain s.
+func (c *ConcurrentStream) Do(fn func(s *Stream)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.own()
+	fn(c.s)
+}
+
+// ConcurrentTopK is a TopK safe for concurrent use, locked like
+// ConcurrentStream.
+type ConcurrentTopK struct {
+	mu sync.RWMutex
+	t  *TopK
+}
+
+// SafeTopK wraps t for concurrent use. t must not be used directly
+// afterwards, other than through Do.
+func SafeTopK(t *TopK) *ConcurrentTopK {
+	return &ConcurrentTopK{t: t}
+}
+
+// Insert ...
+func (c *ConcurrentTopK) Insert(x string, count int) Element {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t.Insert(x, count)
+}
+
+// Merge merges other into the TopK. other must not be modified
+// concurrently.
+func (c *ConcurrentTopK) Merge(other *TopK) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t.Merge(other)
+}
+
+// Keys returns a copy of the current top k elements.
+func (c *ConcurrentTopK) Keys() []Element {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.t.Keys()
+}
+
+// Estimate ...
+func (c *ConcurrentTopK) Estimate(x string) Element {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.t.Estimate(x)
+}
+
+// Count ...
+func (c *ConcurrentTopK) Count() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.t.Count()
+}
+
+// Encode ...
+func (c *ConcurrentTopK) Encode(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.t.Encode(w)
+}
+
+// Do calls fn with the wrapped TopK under the write lock. fn must not
+// retain t.
+func (c *ConcurrentTopK) Do(fn func(t *TopK)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(c.t)
+}
@@ -0,0 +1,106 @@
+package topk
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentStream(t *testing.T) {
+	c := Safe(newStream(10))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Insert("foo", 1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Keys()
+				c.Estimate("foo")
+				c.Encode(&bytes.Buffer{})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, Element{Key: "foo", Count: 4000}, c.Estimate("foo"))
+
+	other := newStream(10)
+	other.Insert("bar", 5)
+	require.NoError(t, c.Merge(other))
+	assert.Equal(t, []Element{{Key: "foo", Count: 4000}, {Key: "bar", Count: 5}}, c.Keys())
+
+	c.Do(func(s *Stream) { s.Forget("foo") })
+	assert.Equal(t, []Element{{Key: "bar", Count: 5}}, c.Keys())
+}
+
+func TestConcurrentTopK(t *testing.T) {
+	c := SafeTopK(New(1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Insert("foo", 1)
+				c.Keys()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Insert("bar", 1)
+	assert.Equal(t, []Element{{Key: "foo", Count: 4000}}, c.Keys())
+	assert.Equal(t, int64(4001), c.Count())
+
+	other := New(1)
+	other.Insert("bar", 5000)
+	require.NoError(t, c.Merge(other))
+	assert.Equal(t, "bar", c.Keys()[0].Key)
+}
+
+func TestSnapshot(t *testing.T) {
+	c := Safe(newStream(10))
+	c.Insert("foo", 1)
+	v := c.Snapshot()
+	assert.Same(t, v, c.Snapshot())
+	keys := v.Keys()
+
+	// writes don't change a taken View
+	c.Insert("foo", 1)
+	c.Insert("bar", 1)
+	assert.Equal(t, keys, v.Keys())
+	assert.Equal(t, int64(1), v.Count())
+	assert.NotSame(t, v, c.Snapshot())
+	assert.Equal(t, c.Keys(), c.Snapshot().Keys())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 1000; j++ {
+			c.Insert("foo", 1)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				v := c.Snapshot()
+				v.Keys()
+				v.Estimate("foo")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1002), c.Snapshot().Estimate("foo").Count)
+}
@@ -0,0 +1,101 @@
+package topk
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// ErrDecayMismatch is returned when merging TopKs that decay with different
+// half-lives, whose counts weigh the past differently and can't be summed.
+var ErrDecayMismatch = errors.New("topk: cannot merge sketches decaying with different half-lives")
+
+// Decay scales all counts, errors and alphas, and the total count, by
+// factor, which must be in (0, 1], so that recent traffic weighs more than
+// old traffic without recreating the sketch. Counts are rounded down. The
+// estimates remain upper bounds of the equally decayed exact counts, up to
+// the rounding. Other factors return an error and leave s unmodified.
+func (s *Stream) Decay(factor float64) error {
+	if !(factor > 0 && factor <= 1) {
+		return fmt.Errorf("topk: invalid decay factor %v", factor)
+	}
+	s.applyDecay(factor)
+	return nil
+}
+
+// applyDecay decays s and its emerging tracker by factor, which may
+// underflow to 0 for long pauses.
+func (s *Stream) applyDecay(factor float64) {
+	s.decay(factor)
+	if s.emerging != nil {
+		s.emerging.decay(factor)
+	}
+}
+
+// SetHalfLife makes Insert decay the TopK continuously, halving the weight
+// of past inserts every h. The time is taken from the clock set with
+// SetClock, or time.Now. To keep inserts cheap, the decay is applied in
+// steps of a tenth of h. A zero h disables decaying.
+func (t *TopK) SetHalfLife(h time.Duration) {
+	t.halfLife = h
+	t.decayed = time.Time{}
+}
+
+// autoDecay applies the decay for the time passed since the last one.
+func (t *TopK) autoDecay() {
+	now := time.Now()
+	if t.clock != nil {
+		now = t.clock()
+	}
+	if t.decayed.IsZero() {
+		t.decayed = now
+		return
+	}
+	elapsed := now.Sub(t.decayed)
+	if elapsed < t.halfLife/10 {
+		return
+	}
+	t.applyDecay(t.decayFactor(elapsed))
+	t.decayed = now
+}
+
+// decayFactor returns the factor decaying counts over d.
+func (t *TopK) decayFactor(d time.Duration) float64 {
+	return math.Exp2(-float64(d) / float64(t.halfLife))
+}
+
+// alignDecay brings the counts of t and other to the same reference time
+// before merging, the later of the times they were last decayed at. t is
+// decayed in place; for other, a decayed copy of its Stream is returned.
+// Both must have the same half-life.
+func (t *TopK) alignDecay(other *TopK) *Stream {
+	if t.halfLife == 0 || other.decayed.IsZero() {
+		return other.Stream
+	}
+	if t.decayed.IsZero() || other.decayed.After(t.decayed) {
+		if !t.decayed.IsZero() {
+			t.applyDecay(t.decayFactor(other.decayed.Sub(t.decayed)))
+		}
+		t.decayed = other.decayed
+		return other.Stream
+	}
+
+	factor := t.decayFactor(t.decayed.Sub(other.decayed))
+	o := &Stream{
+		n:       other.n,
+		hash:    other.hash,
+		hasher:  other.hasher,
+		seed:    other.seed,
+		k:       keys{m: maps.Clone(other.Stream.k.m), elts: slices.Clone(other.Stream.k.elts)},
+		alphas:  slices.Clone(other.alphas),
+		c:       other.c,
+		first:   other.first,
+		last:    other.last,
+		stamped: other.stamped,
+	}
+	o.decay(factor)
+	return o
+}
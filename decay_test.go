@@ -0,0 +1,89 @@
+package topk
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecay(t *testing.T) {
+	tk := New(2)
+	tk.EnableEmerging(2)
+	tk.Insert("a", 100)
+	tk.Insert("b", 11)
+	tk.Insert("c", 7)
+	tk.Insert("d", 1)
+
+	assert.NoError(t, tk.Decay(0.5))
+	assert.Equal(t, []Element{{Key: "a", Count: 50}, {Key: "b", Count: 5}}, tk.Keys())
+	assert.Equal(t, int64(59), tk.Count())
+	assert.LessOrEqual(t, tk.Estimate("d").Count, int64(4))
+
+	for _, f := range []float64{0, -0.5, 1.5, math.NaN(), math.Inf(1)} {
+		assert.Error(t, tk.Decay(f), "factor %v", f)
+	}
+	assert.Equal(t, int64(59), tk.Count())
+	assert.NoError(t, tk.Decay(1))
+	assert.Equal(t, int64(50), tk.Estimate("a").Count)
+}
+
+func TestHalfLife(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tk := New(5)
+	tk.SetClock(func() time.Time { return now })
+	tk.SetHalfLife(time.Hour)
+
+	tk.Insert("a", 1000)
+	now = now.Add(time.Minute)
+	tk.Insert("b", 1)
+	assert.Equal(t, int64(1000), tk.Estimate("a").Count)
+
+	now = now.Add(time.Hour)
+	tk.Insert("b", 1)
+	assert.InDelta(t, 500, tk.Estimate("a").Count, 10)
+	assert.InDelta(t, 501, tk.Count(), 10)
+
+	tk.SetHalfLife(0)
+	now = now.Add(10 * time.Hour)
+	tk.Insert("b", 1)
+	assert.InDelta(t, 500, tk.Estimate("a").Count, 10)
+}
+
+func TestMergeDecayed(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	newTK := func() *TopK {
+		tk := New(5)
+		tk.SetClock(func() time.Time { return now })
+		tk.SetHalfLife(time.Hour)
+		return tk
+	}
+
+	tk1 := newTK()
+	tk1.Insert("a", 1000)
+	now = now.Add(time.Hour)
+	tk2 := newTK()
+	tk2.Insert("a", 1000)
+	tk2.Insert("b", 100)
+
+	// tk1 is an hour behind: its counts are halved before summing, in
+	// either direction, and the inputs are not modified
+	res, err := MergeMany(tk1, tk2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), res.Estimate("a").Count)
+	assert.Equal(t, int64(1600), res.Count())
+	res, err = MergeMany(tk2, tk1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), res.Estimate("a").Count)
+	assert.Equal(t, int64(1000), tk1.Estimate("a").Count)
+
+	assert.NoError(t, tk1.Merge(tk2))
+	assert.Equal(t, int64(1500), tk1.Estimate("a").Count)
+	assert.Equal(t, int64(1600), tk1.Count())
+
+	tk3 := New(5)
+	tk3.SetHalfLife(2 * time.Hour)
+	assert.ErrorIs(t, tk1.Merge(tk3), ErrDecayMismatch)
+	assert.ErrorIs(t, tk1.Merge(New(5)), ErrDecayMismatch)
+}
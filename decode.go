@@ -0,0 +1,105 @@
+package topk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeError is returned when a snapshot could not be decoded completely.
+type DecodeError struct {
+	// Section is the part of the snapshot that could not be read: "header",
+	// "size", "alphas", "elements" or "checksum".
+	Section string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("topk: decoding %s: %v", e.Section, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// ErrCorruptSnapshot is wrapped by the DecodeError returned for snapshots
+// that are valid MessagePack but can't be the encoding of a sketch, e.g.
+// because they were corrupted or crafted.
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+func corrupt(section, format string, args ...any) *DecodeError {
+	return &DecodeError{Section: section, Err: fmt.Errorf("%w: "+format, append([]any{ErrCorruptSnapshot}, args...)...)}
+}
+
+// Limits of decoded snapshots. Sizes read from a snapshot only preallocate
+// up to decodePrealloc entries, the rest is allocated as the data arrives,
+// so decoding can't allocate much more than the size of its input; the
+// limits bound a single snapshot regardless.
+const (
+	maxDecodeMonitored = 1 << 24
+	maxDecodeAlphas    = 1 << 26
+	maxDecodeKeyLen    = 1 << 20
+	maxDecodeDictKeys  = 1 << 26
+	decodePrealloc     = 1 << 12
+)
+
+// DecodePartial is like Decode, but if the snapshot is cut short it leaves s
+// with a best-effort sketch of everything that could be read instead of
+// leaving it untouched. Alphas that were not read are zero, so estimates for
+// unmonitored keys may be too low, and elements that were not read are not
+// monitored. The returned *DecodeError names the section that is incomplete.
+// If not even the size of the Stream could be read, s is not modified.
+func (s *Stream) DecodePartial(r io.Reader) error {
+	return decodeFrom(r, s.transform, true, func(dec decoder) error {
+		_, err := s.decodePartial(dec)
+		return err
+	})
+}
+
+// DecodePartial is like Decode, but keeps what could be read from a
+// truncated snapshot. See Stream.DecodePartial.
+func (t *TopK) DecodePartial(r io.Reader) error {
+	return decodeFrom(r, t.transformer(), true, func(dec decoder) error {
+		return t.decode(dec, true)
+	})
+}
+
+// decodePartial reports whether anything was decoded into s.
+func (s *Stream) decodePartial(r decoder) (bool, error) {
+	d := Stream{hasher: s.hasher}
+	err := d.decodeSections(r, true)
+	if err != nil {
+		if d.n <= 0 {
+			return false, err
+		}
+		// without alphas, fall back to those configured for s
+		alphas := d.n * defaultBufMultiplier
+		if d.n == s.n && len(s.alphas) > 0 {
+			alphas = len(s.alphas)
+		}
+		d.repair(alphas)
+	}
+	s.restore(&d)
+	return true, err
+}
+
+// repair restores the invariants of a partially decoded Stream, with the
+// given number of alphas if none were read.
+func (s *Stream) repair(alphas int) {
+	if len(s.alphas) == 0 {
+		s.alphas = make([]int64, alphas)
+	}
+
+	// the index might not match the elements that were read, rebuild it
+	elts := s.k.elts
+	s.k = keys{m: make(map[string]int, len(elts)), elts: elts[:0]}
+	for _, e := range elts {
+		if _, ok := s.k.m[e.Key]; ok {
+			continue
+		}
+		s.k.m[e.Key] = len(s.k.elts)
+		s.k.elts = append(s.k.elts, e)
+	}
+	s.k.init()
+	for len(s.k.elts) > s.n {
+		s.k.pop()
+	}
+}
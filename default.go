@@ -0,0 +1,58 @@
+package topk
+
+import "sync"
+
+// DefaultK is the number of results of the default sketch.
+const DefaultK = 10
+
+var (
+	defaultMu   sync.Mutex
+	defaultTopK *TopK
+)
+
+// Default returns the process-wide sketch used by the package-level Insert,
+// Keys and Estimate, creating it with New(DefaultK) on first use. It can be
+// used to configure the sketch before it is shared, but must not be used
+// concurrently with the package-level functions.
+func Default() *TopK {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultSketch()
+}
+
+// SetDefault replaces the default sketch, e.g. with one with a different k.
+func SetDefault(tk *TopK) {
+	defaultMu.Lock()
+	defaultTopK = tk
+	defaultMu.Unlock()
+}
+
+func defaultSketch() *TopK {
+	if defaultTopK == nil {
+		defaultTopK = New(DefaultK)
+	}
+	return defaultTopK
+}
+
+// Insert inserts x into the default sketch. It is safe for concurrent use.
+func Insert(x string, count int) Element {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultSketch().Insert(x, count)
+}
+
+// Keys returns the top k elements of the default sketch. It is safe for
+// concurrent use.
+func Keys() []Element {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultSketch().Keys()
+}
+
+// Estimate returns the estimate for x of the default sketch. It is safe for
+// concurrent use.
+func Estimate(x string) Element {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultSketch().Estimate(x)
+}
@@ -0,0 +1,35 @@
+package topk
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	defer SetDefault(nil)
+
+	SetDefault(nil)
+	assert.Equal(t, DefaultK, Default().k)
+	assert.Same(t, Default(), Default())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Insert("foo", 1)
+				Keys()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, Element{Key: "foo", Count: 400}, Estimate("foo"))
+
+	SetDefault(New(1))
+	Insert("bar", 2)
+	Insert("baz", 1)
+	assert.Equal(t, []Element{{Key: "bar", Count: 2}}, Keys())
+}
@@ -0,0 +1,387 @@
+package topk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// A delta holds the changes of a sketch since a checkpoint: the alpha cells
+// that changed, the keys that are no longer monitored, and the elements that
+// are new or changed. It starts like a snapshot whose extension int has
+// extDelta set, so Decode rejects it, followed by the fingerprint of the
+// checkpoint it applies to.
+const extDelta = 0x40
+
+// ErrDeltaBase is returned by ApplyDelta when the sketch is not in the state
+// the delta was encoded against, e.g. because a delta was lost or applied
+// twice. The sketch has to be resynchronized with a full snapshot.
+var ErrDeltaBase = errors.New("topk: delta doesn't apply to this sketch")
+
+// EncodeDelta writes the changes of s since the checkpoint since, which is
+// much smaller than Encode when few elements changed. A receiver holding the
+// same state as since reaches the state of s with ApplyDelta. since must have
+// the same shape and hash as s, or be nil for an empty Stream. To keep a
+// checkpoint without copying s, a producer can apply each delta it sends to
+// its own copy of since as well.
+func (s *Stream) EncodeDelta(w io.Writer, since *Stream) error {
+	since, err := s.deltaBase(since)
+	if err != nil {
+		return err
+	}
+	return s.labelled("encode", func() error {
+		return encodeTo(w, s.transform, func(enc encoder) error {
+			if err := writeDeltaHeader(enc, since.fingerprint()); err != nil {
+				return err
+			}
+			return s.encodeDelta(enc, since)
+		})
+	})
+}
+
+// ApplyDelta applies a delta written by EncodeDelta. It returns ErrDeltaBase
+// if s is not in the state the delta was encoded against. s is not modified
+// on error.
+func (s *Stream) ApplyDelta(r io.Reader) error {
+	return s.labelled("decode", func() error {
+		return decodeFrom(r, s.transform, false, func(dec decoder) error {
+			fp, err := readDeltaHeader(dec)
+			if err != nil {
+				return err
+			}
+			if fp != s.fingerprint() {
+				return ErrDeltaBase
+			}
+			d, err := s.decodeDelta(dec)
+			if err != nil {
+				return err
+			}
+			s.applyDelta(d)
+			return nil
+		})
+	})
+}
+
+// EncodeDelta writes the changes of t since the checkpoint since. See
+// Stream.EncodeDelta.
+func (t *TopK) EncodeDelta(w io.Writer, since *TopK) error {
+	var base *Stream
+	if since != nil {
+		if since.k != t.k {
+			return fmt.Errorf("topk: delta base has k %d, expected %d", since.k, t.k)
+		}
+		base = since.Stream
+	}
+	base, err := t.Stream.deltaBase(base)
+	if err != nil {
+		return err
+	}
+	return t.Stream.labelled("encode", func() error {
+		return encodeTo(w, t.transformer(), func(enc encoder) error {
+			if err := writeDeltaHeader(enc, fingerprintTopK(base, t.k)); err != nil {
+				return err
+			}
+			return t.Stream.encodeDelta(enc, base)
+		})
+	})
+}
+
+// ApplyDelta applies a delta written by TopK.EncodeDelta. See
+// Stream.ApplyDelta.
+func (t *TopK) ApplyDelta(r io.Reader) error {
+	return t.Stream.labelled("decode", func() error {
+		return decodeFrom(r, t.transformer(), false, func(dec decoder) error {
+			fp, err := readDeltaHeader(dec)
+			if err != nil {
+				return err
+			}
+			if fp != fingerprintTopK(t.Stream, t.k) {
+				return ErrDeltaBase
+			}
+			d, err := t.Stream.decodeDelta(dec)
+			if err != nil {
+				return err
+			}
+			t.Stream.applyDelta(d)
+			return nil
+		})
+	})
+}
+
+// deltaBase checks that since can be the checkpoint of s, and returns an
+// empty Stream shaped like s if since is nil.
+func (s *Stream) deltaBase(since *Stream) (*Stream, error) {
+	if since == nil {
+		base := newStreamWithAlphas(s.n, len(s.alphas))
+		base.hash, base.hasher, base.seed = s.hash, s.hasher, s.seed
+		return base, nil
+	}
+	if since.n != s.n || len(since.alphas) != len(s.alphas) {
+		return nil, fmt.Errorf("topk: delta base has size %d with %d alphas, expected %d with %d", since.n, len(since.alphas), s.n, len(s.alphas))
+	}
+	if since.hash != s.hash || since.seed != s.seed {
+		return nil, errors.New("topk: delta base uses a different hash")
+	}
+	return since, nil
+}
+
+// fingerprint identifies the state of s. Elements are summed, so it doesn't
+// depend on the order of the heap, which differs between a sketch and one
+// that reached the same state by applying deltas.
+func (s *Stream) fingerprint() uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	writeInt := func(v int64) {
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		h.Write(b[:])
+	}
+	writeInt(int64(s.n))
+	writeInt(s.c)
+	for _, a := range s.alphas {
+		writeInt(a)
+	}
+	sum := h.Sum64()
+	for _, e := range s.k.elts {
+		h.Reset()
+		io.WriteString(h, e.Key)
+		writeInt(e.Count)
+		writeInt(e.Error)
+		sum += h.Sum64()
+	}
+	return sum
+}
+
+func fingerprintTopK(s *Stream, k int) uint64 {
+	return s.fingerprint() ^ uint64(k)*0x9e3779b97f4a7c15
+}
+
+func writeDeltaHeader(w encoder, fp uint64) error {
+	if err := writeHeader(w, formatVersion); err != nil {
+		return err
+	}
+	if err := w.WriteInt(-extDelta); err != nil {
+		return err
+	}
+	return w.WriteInt64(int64(fp))
+}
+
+// readDeltaHeader reads the header of a delta and returns the fingerprint of
+// its checkpoint.
+func readDeltaHeader(r decoder) (uint64, error) {
+	ext, err := readHeader(r)
+	if err != nil {
+		return 0, &DecodeError{Section: "header", Err: err}
+	}
+	if ext != -extDelta {
+		return 0, corrupt("header", "not a delta")
+	}
+	fp, err := r.ReadInt64()
+	if err != nil {
+		return 0, &DecodeError{Section: "header", Err: err}
+	}
+	return uint64(fp), nil
+}
+
+// delta is a decoded delta, applied once it has been read completely.
+type delta struct {
+	first, last, stamped int64
+	c                    int64
+	alphas               map[int]int64
+	removed              []string
+	changed              []Element
+}
+
+func (s *Stream) encodeDelta(w encoder, since *Stream) error {
+	stamped := s.stamped
+	if s.clock != nil {
+		stamped = s.clock().UnixNano()
+	}
+	for _, t := range []int64{s.first, s.last, stamped} {
+		if err := w.WriteInt64(t); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteInt64(s.c); err != nil {
+		return err
+	}
+
+	var alphas []int
+	for i, a := range s.alphas {
+		if a != since.alphas[i] {
+			alphas = append(alphas, i)
+		}
+	}
+	if err := w.WriteMapHeader(uint32(len(alphas))); err != nil {
+		return err
+	}
+	for _, i := range alphas {
+		if err := w.WriteInt(i); err != nil {
+			return err
+		}
+		if err := w.WriteInt64(s.alphas[i]); err != nil {
+			return err
+		}
+	}
+
+	var removed []string
+	for _, e := range since.k.elts {
+		if _, ok := s.k.m[e.Key]; !ok {
+			removed = append(removed, e.Key)
+		}
+	}
+	if err := w.WriteArrayHeader(uint32(len(removed))); err != nil {
+		return err
+	}
+	for _, k := range removed {
+		if err := w.WriteString(k); err != nil {
+			return err
+		}
+	}
+
+	var changed []Element
+	for _, e := range s.k.elts {
+		if idx, ok := since.k.m[e.Key]; !ok || since.k.elts[idx] != e {
+			changed = append(changed, e)
+		}
+	}
+	if err := w.WriteArrayHeader(uint32(len(changed))); err != nil {
+		return err
+	}
+	for _, e := range changed {
+		if err := w.WriteString(e.Key); err != nil {
+			return err
+		}
+		if err := w.WriteInt64(e.Count); err != nil {
+			return err
+		}
+		if err := w.WriteInt64(e.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeDelta reads a delta for s, checking that it can be applied.
+func (s *Stream) decodeDelta(r decoder) (*delta, error) {
+	var (
+		d   delta
+		err error
+		sz  uint32
+	)
+	for _, t := range []*int64{&d.first, &d.last, &d.stamped} {
+		if *t, err = r.ReadInt64(); err != nil {
+			return nil, &DecodeError{Section: "header", Err: err}
+		}
+	}
+	if d.c, err = r.ReadInt64(); err != nil {
+		return nil, &DecodeError{Section: "header", Err: err}
+	}
+	if d.c < 0 {
+		return nil, corrupt("header", "count %d", d.c)
+	}
+
+	if sz, err = r.ReadMapHeader(); err != nil {
+		return nil, &DecodeError{Section: "alphas", Err: err}
+	}
+	if sz > uint32(len(s.alphas)) {
+		return nil, corrupt("alphas", "%d changed alphas of %d", sz, len(s.alphas))
+	}
+	d.alphas = make(map[int]int64, min(sz, decodePrealloc))
+	for i := uint32(0); i < sz; i++ {
+		idx, err := r.ReadInt()
+		if err != nil {
+			return nil, &DecodeError{Section: "alphas", Err: err}
+		}
+		a, err := r.ReadInt64()
+		if err != nil {
+			return nil, &DecodeError{Section: "alphas", Err: err}
+		}
+		if idx < 0 || idx >= len(s.alphas) || a < 0 {
+			return nil, corrupt("alphas", "alpha %d at %d", a, idx)
+		}
+		d.alphas[idx] = a
+	}
+
+	if sz, err = r.ReadArrayHeader(); err != nil {
+		return nil, &DecodeError{Section: "elements", Err: err}
+	}
+	if sz > uint32(len(s.k.elts)) {
+		return nil, corrupt("elements", "%d removed of %d elements", sz, len(s.k.elts))
+	}
+	removed := make(map[string]struct{}, sz)
+	for i := uint32(0); i < sz; i++ {
+		k, err := r.ReadString()
+		if err != nil {
+			return nil, &DecodeError{Section: "elements", Err: err}
+		}
+		if _, ok := removed[k]; ok {
+			return nil, corrupt("elements", "element %q removed twice", k)
+		}
+		if _, ok := s.k.m[k]; !ok {
+			return nil, corrupt("elements", "removed element %q is not monitored", k)
+		}
+		removed[k] = struct{}{}
+		d.removed = append(d.removed, k)
+	}
+
+	if sz, err = r.ReadArrayHeader(); err != nil {
+		return nil, &DecodeError{Section: "elements", Err: err}
+	}
+	if sz > uint32(s.n) {
+		return nil, corrupt("elements", "%d changed elements", sz)
+	}
+	size := len(s.k.elts) - len(removed)
+	seen := make(map[string]struct{}, min(sz, decodePrealloc))
+	d.changed = make([]Element, 0, min(sz, decodePrealloc))
+	for i := uint32(0); i < sz; i++ {
+		var e Element
+		if e.Key, err = r.ReadString(); err != nil {
+			return nil, &DecodeError{Section: "elements", Err: err}
+		}
+		if e.Count, err = r.ReadInt64(); err != nil {
+			return nil, &DecodeError{Section: "elements", Err: err}
+		}
+		if e.Error, err = r.ReadInt64(); err != nil {
+			return nil, &DecodeError{Section: "elements", Err: err}
+		}
+		if e.Error < 0 || e.Count < e.Error {
+			return nil, corrupt("elements", "element %q with count %d and error %d", e.Key, e.Count, e.Error)
+		}
+		if _, ok := seen[e.Key]; ok {
+			return nil, corrupt("elements", "element %q changed twice", e.Key)
+		}
+		seen[e.Key] = struct{}{}
+		_, monitored := s.k.m[e.Key]
+		if _, ok := removed[e.Key]; ok || !monitored {
+			size++
+		}
+		d.changed = append(d.changed, e)
+	}
+	if size > s.n {
+		return nil, corrupt("elements", "%d elements, expected at most %d", size, s.n)
+	}
+	return &d, nil
+}
+
+func (s *Stream) applyDelta(d *delta) {
+	s.first, s.last, s.stamped, s.c = d.first, d.last, d.stamped, d.c
+	for i, a := range d.alphas {
+		s.alphas[i] = a
+	}
+	for _, k := range d.removed {
+		s.k.remove(s.k.m[k])
+	}
+	// removed elements can come back as changed ones
+	for _, e := range d.changed {
+		if idx, ok := s.k.m[e.Key]; ok {
+			s.k.elts[idx] = e
+		} else {
+			s.k.push(e)
+		}
+	}
+	s.k.init()
+	s.touched = nil
+	s.saturated = s.hasSaturated()
+}
@@ -0,0 +1,168 @@
+package topk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelta(t *testing.T) {
+	b, err := os.ReadFile("testdata/domains.txt")
+	require.NoError(t, err)
+	domains := strings.Fields(string(b))
+
+	tk := New(50)
+	base, follower := New(50), New(50)
+	var full, deltas bytes.Buffer
+	var fulls int
+	for i, d := range domains {
+		tk.Insert(d, 1)
+		if (i+1)%500 != 0 {
+			continue
+		}
+		var buf bytes.Buffer
+		require.NoError(t, tk.EncodeDelta(&buf, base))
+		delta := buf.Bytes()
+		deltas.Write(delta)
+		require.NoError(t, base.ApplyDelta(bytes.NewReader(delta)))
+		require.NoError(t, follower.ApplyDelta(bytes.NewReader(delta)))
+
+		assert.Equal(t, tk.Keys(), follower.Keys())
+		assert.Equal(t, tk.Count(), follower.Count())
+		assert.Equal(t, tk.alphas, follower.alphas)
+		assert.Equal(t, tk.Stream.fingerprint(), follower.Stream.fingerprint())
+
+		// a delta applies once
+		assert.ErrorIs(t, follower.ApplyDelta(bytes.NewReader(delta)), ErrDeltaBase)
+		assert.Equal(t, tk.Keys(), follower.Keys())
+
+		full.Reset()
+		require.NoError(t, tk.Encode(&full))
+		assert.Less(t, len(delta), full.Len())
+		fulls += full.Len()
+	}
+	t.Logf("deltas: %d bytes, snapshots: %d bytes", deltas.Len(), fulls)
+	assert.Less(t, deltas.Len(), fulls/2)
+
+	// a delta is not a snapshot
+	var buf bytes.Buffer
+	require.NoError(t, tk.EncodeDelta(&buf, base))
+	assert.ErrorIs(t, New(50).Decode(bytes.NewReader(buf.Bytes())), ErrCorruptSnapshot)
+	assert.ErrorIs(t, New(50).ApplyDelta(&full), ErrCorruptSnapshot)
+
+	assert.Error(t, tk.EncodeDelta(&buf, New(10)))
+}
+
+func TestStreamDelta(t *testing.T) {
+	s := newStream(3)
+	for i, k := range []string{"a", "b", "c", "a", "d", "e"} {
+		s.Insert(k, i+1)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, s.EncodeDelta(&buf, nil))
+	got := newStream(3)
+	require.NoError(t, got.ApplyDelta(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, s.Keys(), got.Keys())
+	assert.Equal(t, s.alphas, got.alphas)
+
+	// keys leave and come back
+	s.Forget("a")
+	s.Insert("f", 10)
+	s.Insert("a", 20)
+	buf.Reset()
+	require.NoError(t, s.EncodeDelta(&buf, got))
+	require.NoError(t, got.ApplyDelta(&buf))
+	assert.Equal(t, s.Keys(), got.Keys())
+	assert.Equal(t, s.alphas, got.alphas)
+
+	// got is left as is on error
+	buf.Reset()
+	require.NoError(t, s.EncodeDelta(&buf, nil))
+	data := buf.Bytes()
+	assert.Error(t, got.ApplyDelta(bytes.NewReader(data[:len(data)-3])))
+	assert.Equal(t, s.Keys(), got.Keys())
+}
+
+func TestVerifyChain(t *testing.T) {
+	tk := New(10)
+	tk.SetTransformer(gzipTransformer{})
+	base := tk.Clone()
+	fsys := fstest.MapFS{}
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 100; j++ {
+			tk.Insert(fmt.Sprintf("key-%d", (i*j)%30), 1)
+		}
+		var buf bytes.Buffer
+		if i == 0 {
+			require.NoError(t, tk.Encode(&buf))
+		} else {
+			require.NoError(t, tk.EncodeDelta(&buf, base))
+		}
+		base = tk.Clone()
+		fsys[fmt.Sprintf("%03d", i)] = &fstest.MapFile{Data: buf.Bytes()}
+	}
+	fsys["dir"] = &fstest.MapFile{Mode: fs.ModeDir}
+	assert.NoError(t, tk.VerifyChain(fsys))
+
+	without := func(name string) fstest.MapFS {
+		m := maps.Clone(fsys)
+		delete(m, name)
+		return m
+	}
+	err := tk.VerifyChain(without("002"))
+	assert.ErrorIs(t, err, ErrDeltaBase)
+	assert.ErrorContains(t, err, "segment 003")
+	assert.ErrorIs(t, tk.VerifyChain(without("000")), ErrCorruptSnapshot)
+	assert.NoError(t, tk.VerifyChain(without("003")))
+
+	// reordered
+	m := maps.Clone(fsys)
+	m["001"], m["002"] = fsys["002"], fsys["001"]
+	assert.ErrorIs(t, tk.VerifyChain(m), ErrDeltaBase)
+
+	// tampered
+	var raw bytes.Buffer
+	r, err := gzip.NewReader(bytes.NewReader(fsys["001"].Data))
+	require.NoError(t, err)
+	_, err = raw.ReadFrom(r)
+	require.NoError(t, err)
+	data := raw.Bytes()
+	data[len(data)-checksumSize-1]++
+	var tampered bytes.Buffer
+	w := gzip.NewWriter(&tampered)
+	w.Write(data)
+	require.NoError(t, w.Close())
+	m = maps.Clone(fsys)
+	m["001"] = &fstest.MapFile{Data: tampered.Bytes()}
+	assert.ErrorIs(t, tk.VerifyChain(m), ErrChecksumMismatch)
+
+	assert.Error(t, tk.VerifyChain(fstest.MapFS{}))
+
+	// the chain of a Stream, without the Transformer
+	s := newStream(3)
+	s.Insert("a", 1)
+	var buf bytes.Buffer
+	require.NoError(t, s.Encode(&buf))
+	snapshot := buf.Bytes()
+	since := s.Clone()
+	s.Insert("b", 2)
+	buf = bytes.Buffer{}
+	require.NoError(t, s.EncodeDelta(&buf, since))
+	chain := fstest.MapFS{
+		"a": &fstest.MapFile{Data: snapshot},
+		"b": &fstest.MapFile{Data: buf.Bytes()},
+	}
+	assert.NoError(t, s.VerifyChain(chain))
+	assert.Error(t, tk.VerifyChain(chain))
+	chain["c"] = chain["b"]
+	assert.ErrorIs(t, s.VerifyChain(chain), ErrDeltaBase)
+}
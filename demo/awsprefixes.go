@@ -98,7 +98,7 @@ func main() {
 
 	ipCount = 0
 	rangeCount := 0
-	exactCount := make(map[string]int)
+	exactCount := make(map[string]int64)
 
 	for _, ipp := range ipr.Prefixes {
 		rangeCount++
@@ -0,0 +1,210 @@
+package topk
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Dictionary assigns compact uint32 IDs to keys. Snapshots encoded with a
+// Dictionary store the IDs instead of the keys, which makes them much
+// smaller when the same keys recur across many sketches, e.g. one per
+// window. The IDs are a serialization format only: sketches keep their keys
+// as strings, since Element and every query expose them. Keys decoded with
+// a Dictionary share its strings instead of allocating their own, so
+// sketches decoded with the same Dictionary hold each key once. The
+// Dictionary has to be persisted along with the snapshots, and can only
+// grow. It is safe for concurrent use.
+type Dictionary struct {
+	mu        sync.RWMutex
+	ids       map[string]uint32
+	keys      []string
+	transform Transformer
+}
+
+// NewDictionary returns an empty Dictionary.
+func NewDictionary() *Dictionary {
+	return &Dictionary{ids: make(map[string]uint32)}
+}
+
+// ID returns the ID of key, assigning the next free one if key is new.
+func (d *Dictionary) ID(key string) uint32 {
+	d.mu.RLock()
+	id, ok := d.ids[key]
+	d.mu.RUnlock()
+	if ok {
+		return id
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id, ok := d.ids[key]; ok {
+		return id
+	}
+	id = uint32(len(d.keys))
+	d.ids[key] = id
+	d.keys = append(d.keys, key)
+	return id
+}
+
+// Key returns the key with the given ID, and whether there is one.
+func (d *Dictionary) Key(id uint32) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if int(id) >= len(d.keys) {
+		return "", false
+	}
+	return d.keys[id], true
+}
+
+// Len returns the number of keys in the Dictionary.
+func (d *Dictionary) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.keys)
+}
+
+// SetTransformer configures the Transformer applied by Encode and Decode,
+// typically the one of the sketches encoded with the Dictionary.
+func (d *Dictionary) SetTransformer(t Transformer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.transform = t
+}
+
+// Encode writes the keys of the Dictionary in ID order, with the header and
+// checksum of snapshots.
+func (d *Dictionary) Encode(w io.Writer) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return encodeTo(w, d.transform, func(enc encoder) error {
+		if err := writeHeader(enc, formatVersion); err != nil {
+			return err
+		}
+		if err := enc.WriteArrayHeader(uint32(len(d.keys))); err != nil {
+			return err
+		}
+		for _, k := range d.keys {
+			if err := enc.WriteString(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Decode replaces the contents of the Dictionary with the keys written by
+// Encode. The Dictionary is not modified on error.
+func (d *Dictionary) Decode(r io.Reader) error {
+	d.mu.RLock()
+	t := d.transform
+	d.mu.RUnlock()
+	return decodeFrom(r, t, false, func(dec decoder) error {
+		magic, err := dec.ReadInt()
+		if err != nil {
+			return &DecodeError{Section: "header", Err: err}
+		}
+		version, err := dec.ReadInt()
+		if err != nil {
+			return &DecodeError{Section: "header", Err: err}
+		}
+		if magic != formatMagic {
+			return corrupt("header", "magic %#x", magic)
+		}
+		if version != formatVersion {
+			return &VersionError{Version: version}
+		}
+		sz, err := dec.ReadArrayHeader()
+		if err != nil {
+			return &DecodeError{Section: "keys", Err: err}
+		}
+		if sz > maxDecodeDictKeys {
+			return corrupt("keys", "%d keys", sz)
+		}
+		ids := make(map[string]uint32, min(sz, decodePrealloc))
+		keys := make([]string, 0, min(sz, decodePrealloc))
+		for i := uint32(0); i < sz; i++ {
+			k, err := dec.ReadString()
+			if err != nil {
+				return &DecodeError{Section: "keys", Err: err}
+			}
+			if _, ok := ids[k]; ok {
+				return corrupt("keys", "key %q appears twice", k)
+			}
+			ids[k] = i
+			keys = append(keys, k)
+		}
+
+		d.mu.Lock()
+		d.ids, d.keys = ids, keys
+		d.mu.Unlock()
+		return nil
+	})
+}
+
+// dictEncoder writes the IDs of keys instead of the keys.
+type dictEncoder struct {
+	encoder
+	d *Dictionary
+}
+
+func (e dictEncoder) WriteString(s string) error {
+	return e.encoder.WriteInt(int(e.d.ID(s)))
+}
+
+// dictDecoder reads keys written by a dictEncoder.
+type dictDecoder struct {
+	decoder
+	d *Dictionary
+}
+
+func (d dictDecoder) ReadString() (string, error) {
+	id, err := d.decoder.ReadInt()
+	if err != nil {
+		return "", err
+	}
+	k, ok := d.d.Key(uint32(id))
+	if !ok {
+		return "", fmt.Errorf("topk: unknown key ID %d", id)
+	}
+	return k, nil
+}
+
+// EncodeWithDictionary is like Encode, but writes the IDs of the keys in d
+// instead of the keys, adding the keys d doesn't know yet.
+func (s *Stream) EncodeWithDictionary(w io.Writer, d *Dictionary) error {
+	return s.labelled("encode", func() error {
+		return encodeTo(w, s.transform, func(enc encoder) error {
+			return s.encode(dictEncoder{enc, d}, 0)
+		})
+	})
+}
+
+// DecodeWithDictionary decodes a snapshot written by EncodeWithDictionary
+// with the same (or a grown) Dictionary.
+func (s *Stream) DecodeWithDictionary(r io.Reader, d *Dictionary) error {
+	return s.labelled("decode", func() error {
+		return decodeFrom(r, s.transform, false, func(dec decoder) error {
+			return s.decode(dictDecoder{dec, d})
+		})
+	})
+}
+
+// EncodeWithDictionary is like Encode, but writes the IDs of the keys in d
+// instead of the keys. See Stream.EncodeWithDictionary.
+func (t *TopK) EncodeWithDictionary(w io.Writer, d *Dictionary) error {
+	return t.Stream.labelled("encode", func() error {
+		return encodeTo(w, t.transformer(), func(enc encoder) error {
+			return t.encode(dictEncoder{enc, d}, 0)
+		})
+	})
+}
+
+// DecodeWithDictionary decodes a snapshot written by EncodeWithDictionary.
+func (t *TopK) DecodeWithDictionary(r io.Reader, d *Dictionary) error {
+	return t.Stream.labelled("decode", func() error {
+		return decodeFrom(r, t.transformer(), false, func(dec decoder) error {
+			return t.decode(dictDecoder{dec, d}, false)
+		})
+	})
+}
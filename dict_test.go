@@ -0,0 +1,122 @@
+package topk
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDictionary(t *testing.T) {
+	d := NewDictionary()
+	assert.Equal(t, uint32(0), d.ID("foo"))
+	assert.Equal(t, uint32(1), d.ID("bar"))
+	assert.Equal(t, uint32(0), d.ID("foo"))
+	assert.Equal(t, 2, d.Len())
+
+	k, ok := d.Key(1)
+	assert.True(t, ok)
+	assert.Equal(t, "bar", k)
+	_, ok = d.Key(2)
+	assert.False(t, ok)
+
+	var buf bytes.Buffer
+	require.NoError(t, d.Encode(&buf))
+	got := NewDictionary()
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, d.keys, got.keys)
+	assert.Equal(t, d.ids, got.ids)
+
+	// the Transformer is applied
+	d.SetTransformer(gzipTransformer{})
+	require.NoError(t, d.Encode(&buf))
+	assert.Error(t, NewDictionary().Decode(bytes.NewReader(buf.Bytes())))
+	got = NewDictionary()
+	got.SetTransformer(gzipTransformer{})
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, d.keys, got.keys)
+}
+
+func TestEncodeWithDictionary(t *testing.T) {
+	words := loadWords()
+	d := NewDictionary()
+
+	for w := 0; w < 3; w++ {
+		tk := New(20)
+		for i, word := range words[:200] {
+			tk.Insert(word, (i*7+w)%13+1)
+		}
+
+		var plain, compact bytes.Buffer
+		require.NoError(t, tk.Encode(&plain))
+		require.NoError(t, tk.EncodeWithDictionary(&compact, d))
+		assert.Less(t, compact.Len(), plain.Len())
+
+		var got TopK
+		require.NoError(t, got.DecodeWithDictionary(&compact, d))
+		assert.True(t, reflect.DeepEqual(tk, &got))
+	}
+	assert.LessOrEqual(t, d.Len(), 200)
+
+	// IDs unknown to the dictionary are an error
+	tk := New(5)
+	tk.Insert("foo", 1)
+	var buf bytes.Buffer
+	require.NoError(t, tk.EncodeWithDictionary(&buf, NewDictionary()))
+	var got TopK
+	assert.Error(t, got.DecodeWithDictionary(&buf, &Dictionary{}))
+}
+
+func TestDictionaryDecodeErrors(t *testing.T) {
+	// a huge size must fail instead of allocating it
+	var de *DecodeError
+	d := NewDictionary()
+	d.ID("foo")
+	assert.ErrorAs(t, d.Decode(bytes.NewReader([]byte{0xdd, 0x0f, 0xff, 0xff, 0xff})), &de)
+	huge := []byte{0xdd, 0x0f, 0xff, 0xff, 0xff}
+	assert.ErrorAs(t, d.Decode(bytes.NewReader(append(dictHeader(t), huge...))), &de)
+	assert.Equal(t, 1, d.Len())
+
+	// the checksum written by Encode is verified
+	var buf bytes.Buffer
+	require.NoError(t, d.Encode(&buf))
+	data := buf.Bytes()
+	data[len(data)-checksumSize-1] ^= 0xff
+	err := NewDictionary().Decode(bytes.NewReader(data))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// a corrupt size and duplicate keys are corrupt
+	for _, keys := range [][]string{make([]string, 0, 1), {"a", "a"}} {
+		buf.Reset()
+		require.NoError(t, encodeTo(&buf, nil, func(enc encoder) error {
+			if err := writeHeader(enc, formatVersion); err != nil {
+				return err
+			}
+			n := len(keys)
+			if n == 0 {
+				n = maxDecodeDictKeys + 1
+			}
+			if err := enc.WriteArrayHeader(uint32(n)); err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := enc.WriteString(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		assert.ErrorIs(t, NewDictionary().Decode(&buf), ErrCorruptSnapshot)
+	}
+}
+
+// dictHeader returns the header of an encoded Dictionary.
+func dictHeader(t *testing.T) []byte {
+	var buf bytes.Buffer
+	enc := newEncoder(&buf)
+	require.NoError(t, writeHeader(enc, formatVersion))
+	require.NoError(t, enc.Flush())
+	return buf.Bytes()
+}
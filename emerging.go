@@ -0,0 +1,63 @@
+package topk
+
+// emerging is a small secondary sketch fed with the inserts rejected by the
+// filter of a Stream. It decays quickly, so it reflects keys that are rising
+// right now rather than keys that have been around for long.
+type emerging struct {
+	*Stream
+	inserts int
+}
+
+// insert adds x to the sketch, halving all counts every time the sketch has
+// seen as many inserts as it has alpha cells.
+func (e *emerging) insert(x string, count int) {
+	if e.inserts++; e.inserts >= len(e.alphas) {
+		e.decay(0.5)
+		e.inserts = 0
+	}
+	e.Stream.Insert(x, count)
+}
+
+// EnableEmerging routes keys that are rejected by the filter into a
+// secondary sketch monitoring n keys, queryable with Emerging. n <= 0
+// disables it. The secondary sketch is not part of the encoded Stream.
+func (s *Stream) EnableEmerging(n int) {
+	if n <= 0 {
+		s.emerging = nil
+		return
+	}
+	s.emerging = &emerging{Stream: newStream(n)}
+}
+
+// Emerging returns up to n keys that are gaining weight but are not yet
+// monitored by s. It returns nil unless EnableEmerging was called.
+func (s *Stream) Emerging(n int) []Element {
+	if s.emerging == nil {
+		return nil
+	}
+	var res []Element
+	for _, e := range s.emerging.sorted(nil) {
+		if len(res) == n {
+			break
+		}
+		if _, ok := s.k.m[e.Key]; ok {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// decay scales all counts and alphas by factor.
+func (s *Stream) decay(factor float64) {
+	for i := range s.k.elts {
+		s.k.elts[i].Count = int64(float64(s.k.elts[i].Count) * factor)
+		s.k.elts[i].Error = int64(float64(s.k.elts[i].Error) * factor)
+	}
+	for i := range s.alphas {
+		s.alphas[i] = int64(float64(s.alphas[i]) * factor)
+	}
+	s.c = int64(float64(s.c) * factor)
+	// rounding can create ties that violate the tie-breaking on errors
+	s.k.init()
+}
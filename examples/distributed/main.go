@@ -0,0 +1,88 @@
+// Command distributed counts a stream split across several workers, each
+// with its own sketch, ships the sketches through a Transport and combines
+// them on a coordinator, both by merging and with a GlobalTopK query.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http/httptest"
+
+	"github.com/axiomhq/topk"
+	"github.com/axiomhq/topk/topkhttp"
+)
+
+const (
+	workers = 4
+	k       = 5
+)
+
+// worker counts its part of the stream and publishes its sketch.
+func worker(ctx context.Context, tr topk.Transport, id int, events []string) error {
+	tk := topk.New(k)
+	for _, e := range events {
+		tk.Insert(e, 1)
+	}
+	return tr.SendSketch(ctx, fmt.Sprintf("worker-%d", id), tk)
+}
+
+// coordinator fetches the sketches of all workers and returns the merged
+// top k and the top k of a GlobalTopK query over them.
+func coordinator(ctx context.Context, tr topk.Transport) (merged, global []topk.Element, err error) {
+	var (
+		all    = topk.New(k)
+		shards []topk.Shard
+	)
+	for i := 0; i < workers; i++ {
+		tk, err := tr.FetchSketch(ctx, fmt.Sprintf("worker-%d", i))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := all.Merge(tk); err != nil {
+			return nil, nil, err
+		}
+		shards = append(shards, tk)
+	}
+	return all.Keys(), topk.GlobalTopK(k, shards...), nil
+}
+
+// events returns n events with skewed keys.
+func events(r *rand.Rand, n int) []string {
+	zipf := rand.NewZipf(r, 1.2, 1, 1000)
+	res := make([]string, n)
+	for i := range res {
+		res[i] = fmt.Sprintf("key-%d", zipf.Uint64())
+	}
+	return res
+}
+
+func main() {
+	ctx := context.Background()
+
+	// the workers talk to the coordinator over HTTP
+	srv := httptest.NewServer(topkhttp.TransportHandler(topk.NewMemoryTransport(), nil))
+	defer srv.Close()
+	tr := &topkhttp.Transport{URL: srv.URL}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < workers; i++ {
+		if err := worker(ctx, tr, i, events(r, 10000)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	merged, global, err := coordinator(ctx, tr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("merged:")
+	for _, e := range merged {
+		fmt.Printf("  %s\t%d\n", e.Key, e.Count)
+	}
+	fmt.Println("global:")
+	for _, e := range global {
+		fmt.Printf("  %s\t%d\n", e.Key, e.Count)
+	}
+}
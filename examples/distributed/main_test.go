@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributed(t *testing.T) {
+	ctx := context.Background()
+	tr := topk.NewMemoryTransport()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < workers; i++ {
+		require.NoError(t, worker(ctx, tr, i, events(r, 1000)))
+	}
+
+	merged, global, err := coordinator(ctx, tr)
+	require.NoError(t, err)
+	assert.Len(t, merged, k)
+	assert.Len(t, global, k)
+	// key-0 is by far the most frequent
+	assert.Equal(t, "key-0", merged[0].Key)
+	assert.Equal(t, "key-0", global[0].Key)
+}
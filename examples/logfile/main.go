@@ -0,0 +1,59 @@
+// Command logfile prints the most frequent values of a field in log files,
+// e.g. the top client addresses of an access log:
+//
+//	logfile -field 1 -k 20 access.log
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/axiomhq/topk"
+)
+
+// count inserts the field-th whitespace separated field (1-based) of every
+// line of r into tk. Lines with fewer fields are skipped.
+func count(tk *topk.TopK, r io.Reader, field int) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < field {
+			continue
+		}
+		tk.Insert(fields[field-1], 1)
+	}
+	return sc.Err()
+}
+
+func main() {
+	field := flag.Int("field", 1, "field to count, starting at 1")
+	k := flag.Int("k", 10, "number of results")
+	flag.Parse()
+
+	tk := topk.New(*k)
+	if flag.NArg() == 0 {
+		if err := count(tk, os.Stdin, *field); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = count(tk, f, *field)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, e := range tk.Keys() {
+		fmt.Printf("%d\t±%d\t%s\n", e.Count, e.Error, e.Key)
+	}
+}
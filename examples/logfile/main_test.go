@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCount(t *testing.T) {
+	tk := topk.New(2)
+	log := `10.0.0.1 GET /
+10.0.0.2 GET /a
+10.0.0.1 GET /b
+
+10.0.0.3 GET /
+10.0.0.1 GET /`
+	assert.NoError(t, count(tk, strings.NewReader(log), 1))
+	assert.Equal(t, "10.0.0.1", tk.Keys()[0].Key)
+	assert.Equal(t, int64(3), tk.Keys()[0].Count)
+	assert.Equal(t, int64(5), tk.Count())
+}
@@ -0,0 +1,51 @@
+// Command routes is an HTTP server counting its most requested paths and
+// serving them as JSON at /top.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/axiomhq/topk"
+)
+
+// routes counts the paths of requests. It is safe for concurrent use.
+type routes struct {
+	mu sync.Mutex
+	tk *topk.TopK
+}
+
+// middleware counts the path of every request before passing it to next.
+func (rs *routes) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.Lock()
+		rs.tk.Insert(r.URL.Path, 1)
+		rs.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP serves the top paths.
+func (rs *routes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rs.mu.Lock()
+	keys := rs.tk.Keys()
+	rs.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "listen address")
+	flag.Parse()
+
+	rs := &routes{tk: topk.New(10)}
+	mux := http.NewServeMux()
+	mux.Handle("/top", rs)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello\n"))
+	})
+	log.Fatal(http.ListenAndServe(*addr, rs.middleware(mux)))
+}
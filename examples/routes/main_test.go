@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes(t *testing.T) {
+	rs := &routes{tk: topk.New(2)}
+	h := rs.middleware(http.NotFoundHandler())
+	for _, p := range []string{"/a", "/b", "/a", "/c", "/a"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	rs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/top", nil))
+	var keys []topk.Element
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&keys))
+	assert.Equal(t, topk.Element{Key: "/a", Count: 3}, keys[0])
+}
@@ -0,0 +1,104 @@
+package topk
+
+import (
+	"slices"
+	"sort"
+)
+
+// Shard is a sketch taking part in a distributed top-k query. Both *Stream
+// and *TopK implement it; remote sketches can be adapted by fetching their
+// keys and estimates.
+type Shard interface {
+	Keys() []Element
+	Estimate(x string) Element
+}
+
+// GlobalTopK computes the top n elements over the union of the streams
+// counted by shards, using the three round threshold algorithm (TPUT) of Cao
+// and Wang. Unlike merging the sketches, which only sees the keys each shard
+// happens to report, the final round queries every shard for the estimate
+// of every remaining candidate, so borderline keys are ranked by their
+// actual combined estimate. Pipelines and redactors of the shards don't
+// apply.
+func GlobalTopK(n int, shards ...Shard) []Element {
+	if n <= 0 || len(shards) == 0 {
+		return nil
+	}
+
+	// round 1: the top n of every shard give a lower bound on the n-th
+	// largest combined count
+	keys := make([][]Element, len(shards))
+	partial := make(map[string]int64)
+	for i, s := range shards {
+		keys[i] = shardKeys(s)
+		for j, e := range keys[i] {
+			if j == n {
+				break
+			}
+			partial[e.Key] += e.Count
+		}
+	}
+	threshold := nthLargest(partial, n) / int64(len(shards))
+
+	// round 2: every key reaching the threshold on some shard is a
+	// candidate; a key missing from a shard can have at most the threshold
+	// there
+	partial = make(map[string]int64)
+	reported := make(map[string]int)
+	for i := range shards {
+		for _, e := range keys[i] {
+			if e.Count < threshold {
+				break
+			}
+			partial[e.Key] += e.Count
+			reported[e.Key]++
+		}
+	}
+	lower := nthLargest(partial, n)
+	candidates := make([]string, 0, len(partial))
+	for k, v := range partial {
+		if v+threshold*int64(len(shards)-reported[k]) >= lower {
+			candidates = append(candidates, k)
+		}
+	}
+
+	// round 3: combine the estimates of all shards for the candidates
+	res := make([]Element, 0, len(candidates))
+	for _, k := range candidates {
+		e := Element{Key: k}
+		for _, s := range shards {
+			est := s.Estimate(k)
+			e.Count += est.Count
+			e.Error += est.Error
+		}
+		res = append(res, e)
+	}
+	sort.Sort(elementsByCountDescending(res))
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// shardKeys returns the keys of s. Streams and TopKs report their monitored
+// elements as they are, since a pipeline or redactor would change the keys
+// and counts Estimate is queried for.
+func shardKeys(s Shard) []Element {
+	if r, ok := s.(interface{ sorted([]Element) []Element }); ok {
+		return r.sorted(nil)
+	}
+	return s.Keys()
+}
+
+// nthLargest returns the n-th largest value of m, or 0 if m has fewer values.
+func nthLargest(m map[string]int64, n int) int64 {
+	if len(m) < n {
+		return 0
+	}
+	vals := make([]int64, 0, len(m))
+	for _, v := range m {
+		vals = append(vals, v)
+	}
+	slices.Sort(vals)
+	return vals[len(vals)-n]
+}
@@ -0,0 +1,128 @@
+package topk
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Group is a set of related TopKs updated together, e.g. the top URLs, the
+// top client IPs and the top (IP, URL) pairs of the same requests. Each
+// event is applied to all of them under a single lock, and snapshots of the
+// Group are consistent across its sketches. It is safe for concurrent use.
+type Group struct {
+	mu       sync.RWMutex
+	sketches []*TopK
+}
+
+// NewGroup returns a Group of sketches. They must not be used directly
+// afterwards, other than through Do.
+func NewGroup(sketches ...*TopK) *Group {
+	return &Group{sketches: sketches}
+}
+
+// Insert adds count for keys[i] to the i-th sketch, for every sketch of the
+// Group. It panics unless there is one key per sketch.
+func (g *Group) Insert(count int, keys ...string) {
+	if len(keys) != len(g.sketches) {
+		panic(fmt.Sprintf("topk: %d keys for a group of %d sketches", len(keys), len(g.sketches)))
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, tk := range g.sketches {
+		tk.Insert(keys[i], count)
+	}
+}
+
+// Keys returns a copy of the current top k elements of the i-th sketch.
+func (g *Group) Keys(i int) []Element {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.sketches[i].Keys()
+}
+
+// Estimate returns the estimate of x in the i-th sketch.
+func (g *Group) Estimate(i int, x string) Element {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.sketches[i].Estimate(x)
+}
+
+// Do calls fn with the sketches under the write lock. fn must not retain
+// them.
+func (g *Group) Do(fn func(sketches []*TopK)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fn(g.sketches)
+}
+
+// Encode writes a snapshot of all sketches, taken under a single read lock,
+// with a single checksum. The Transformer of the sketches is applied around
+// it; they must all use the same one.
+func (g *Group) Encode(w io.Writer) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	t, err := g.transformer()
+	if err != nil {
+		return err
+	}
+	return encodeTo(w, t, func(enc encoder) error {
+		if err := enc.WriteArrayHeader(uint32(len(g.sketches))); err != nil {
+			return err
+		}
+		for _, tk := range g.sketches {
+			if err := tk.encode(enc, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Decode replaces the state of the sketches with a snapshot written by
+// Encode for a Group of as many sketches, keeping their configuration. The
+// sketches are left untouched unless all of them could be decoded.
+func (g *Group) Decode(r io.Reader) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	t, err := g.transformer()
+	if err != nil {
+		return err
+	}
+	return decodeFrom(r, t, false, func(dec decoder) error {
+		sz, err := dec.ReadArrayHeader()
+		if err != nil {
+			return &DecodeError{Section: "header", Err: err}
+		}
+		if int(sz) != len(g.sketches) {
+			return fmt.Errorf("topk: snapshot of %d sketches for a group of %d", sz, len(g.sketches))
+		}
+		decoded := make([]*TopK, len(g.sketches))
+		for i, tk := range g.sketches {
+			decoded[i] = &TopK{Stream: &Stream{hasher: tk.Stream.hasher}}
+			if err := decoded[i].decode(dec, false); err != nil {
+				return err
+			}
+		}
+		for i, tk := range g.sketches {
+			tk.k = decoded[i].k
+			tk.Stream.restore(decoded[i].Stream)
+		}
+		return nil
+	})
+}
+
+// transformer returns the Transformer of the sketches, which must be the
+// same for all of them.
+func (g *Group) transformer() (Transformer, error) {
+	var t Transformer
+	for i, tk := range g.sketches {
+		if i == 0 {
+			t = tk.transformer()
+		} else if !reflect.DeepEqual(tk.transformer(), t) {
+			return nil, fmt.Errorf("topk: sketch %d of the group uses a different Transformer", i)
+		}
+	}
+	return t, nil
+}
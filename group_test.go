@@ -0,0 +1,73 @@
+package topk
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	urls, ips, pairs := New(5), New(5), New(5)
+	g := NewGroup(urls, ips, pairs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				url, ip := fmt.Sprintf("/%d", j%3), fmt.Sprintf("10.0.0.%d", j%2)
+				g.Insert(1, url, ip, ip+" "+url)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, Element{Key: "/0", Count: 136}, g.Estimate(0, "/0"))
+	assert.Equal(t, Element{Key: "10.0.0.0", Count: 200}, g.Keys(1)[0])
+	assert.Panics(t, func() { g.Insert(1, "/0") })
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Encode(&buf))
+	data := buf.Bytes()
+
+	got := NewGroup(New(5), New(5), New(5))
+	require.NoError(t, got.Decode(bytes.NewReader(data)))
+	g.Do(func(sketches []*TopK) {
+		for i, tk := range sketches {
+			assert.Equal(t, tk.Keys(), got.Keys(i))
+			assert.Equal(t, tk.Count(), got.sketches[i].Count())
+		}
+	})
+
+	// decoding is all or nothing
+	assert.Error(t, NewGroup(New(5), New(5)).Decode(bytes.NewReader(data)))
+	assert.Error(t, got.Decode(bytes.NewReader(data[:len(data)-10])))
+	assert.Equal(t, g.Keys(2), got.Keys(2))
+
+	// the common Transformer of the sketches is applied
+	g.Do(func(sketches []*TopK) {
+		for _, tk := range sketches {
+			tk.SetTransformer(gzipTransformer{})
+		}
+	})
+	buf.Reset()
+	require.NoError(t, g.Encode(&buf))
+	assert.Error(t, got.Decode(bytes.NewReader(buf.Bytes())))
+	got.Do(func(sketches []*TopK) {
+		for _, tk := range sketches {
+			tk.SetTransformer(gzipTransformer{})
+		}
+	})
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, g.Keys(0), got.Keys(0))
+
+	// and must be the same for all of them
+	g.sketches[1].SetTransformer(nil)
+	assert.ErrorContains(t, g.Encode(&buf), "different Transformer")
+	got.sketches[2].SetTransformer(nil)
+	assert.ErrorContains(t, got.Decode(bytes.NewReader(data)), "different Transformer")
+}
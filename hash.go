@@ -0,0 +1,113 @@
+package topk
+
+import "fmt"
+
+// hashID identifies the hash function used to map keys to alpha cells.
+// Snapshots record it, since a sketch can only be read or merged with the
+// hash it was built with.
+type hashID int
+
+const (
+	// hashMetro is github.com/dgryski/go-metro. It is not recorded in
+	// snapshots, so they stay readable by older versions.
+	hashMetro hashID = iota
+	// hashFNV is 64-bit FNV-1a, a pure-Go fallback. Its output is mixed
+	// with fmix64, as the bits used for the alpha cells are poorly
+	// distributed for short keys otherwise.
+	hashFNV
+	// hashCustom is a function set with WithHasher. Snapshots only record
+	// that it was used, decoding them requires the same function.
+	hashCustom
+)
+
+// Bits of the negative int snapshots start with when they differ from the
+// original format.
+const (
+	extHash  = 0xf // the hashID
+	extTimes = 0x10
+	extSeed  = 0x20
+	extCount = 0x80 // the total count of a Stream, see Count
+)
+
+func (h hashID) String() string {
+	switch h {
+	case hashMetro:
+		return "metro"
+	case hashFNV:
+		return "fnv1a"
+	case hashCustom:
+		return "custom"
+	}
+	return fmt.Sprintf("hash(%d)", int(h))
+}
+
+// available reports whether h can be computed by this build.
+func (h hashID) available() bool {
+	switch h {
+	case hashMetro:
+		return metroHash != nil
+	case hashFNV:
+		return true
+	}
+	return false
+}
+
+// Hash returns the hash of x as computed by s, for InsertHashed. It depends
+// on the hash function and seed of s, see WithHasher and WithSeed.
+func (s *Stream) Hash(x string) uint64 {
+	return s.sum(x)
+}
+
+// sum hashes x with the hash of s.
+func (s *Stream) sum(x string) uint64 {
+	if s.hash == hashCustom {
+		return s.hasher(x)
+	}
+	return s.hash.sum(x, s.seed)
+}
+
+// hashAvailable reports whether s can compute its hash.
+func (s *Stream) hashAvailable() bool {
+	if s.hash == hashCustom {
+		return s.hasher != nil
+	}
+	return s.hash.available()
+}
+
+func (h hashID) sum(x string, seed uint64) uint64 {
+	if h == hashFNV {
+		return fmix64(fnv1a(x, seed))
+	}
+	return metroHash(x, seed)
+}
+
+// fnv1a is hash/fnv's New64a, without the allocation. A non-zero seed is
+// hashed in front of x.
+func fnv1a(x string, seed uint64) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	if seed != 0 {
+		for i := 0; i < 8; i++ {
+			h ^= seed >> (8 * i) & 0xff
+			h *= prime64
+		}
+	}
+	for i := 0; i < len(x); i++ {
+		h ^= uint64(x[i])
+		h *= prime64
+	}
+	return h
+}
+
+// fmix64 is the finalizer of MurmurHash3.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
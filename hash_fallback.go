@@ -0,0 +1,12 @@
+//go:build topk_nometro || mips || mipsle || mips64 || mips64le
+
+package topk
+
+// go-metro is slow on MIPS, and can be left out entirely with the
+// topk_nometro tag. New sketches use FNV-1a instead, and snapshots built
+// with metro can't be read.
+
+// defaultHash is used by new sketches.
+const defaultHash = hashFNV
+
+var metroHash func(string, uint64) uint64
@@ -0,0 +1,10 @@
+//go:build !topk_nometro && !mips && !mipsle && !mips64 && !mips64le
+
+package topk
+
+import "github.com/dgryski/go-metro"
+
+// defaultHash is used by new sketches.
+const defaultHash = hashMetro
+
+var metroHash = metro.Hash64Str
@@ -0,0 +1,60 @@
+package topk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFNV1a(t *testing.T) {
+	for _, x := range []string{"", "a", "foo", "a much longer key with spaces"} {
+		h := fnv.New64a()
+		h.Write([]byte(x))
+		assert.Equal(t, h.Sum64(), fnv1a(x, 0), x)
+		assert.NotEqual(t, fnv1a(x, 0), fnv1a(x, 1), x)
+	}
+}
+
+func TestHashRecorded(t *testing.T) {
+	tk := New(10)
+	tk.Stream.hash = hashFNV
+	for i, k := range []string{"a", "b", "c", "a", "d", "a"} {
+		tk.Insert(k, i+1)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, tk.Encode(&buf))
+
+	var got TopK
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, hashFNV, got.Stream.hash)
+	assert.True(t, reflect.DeepEqual(tk, &got))
+
+	other := New(10)
+	other.Stream.hash = hashMetro
+	assert.Error(t, tk.Merge(other))
+
+	buf.Reset()
+	require.NoError(t, tk.Encode(&buf))
+	// corrupt the hash ID
+	b := buf.Bytes()
+	b[2] = 0xf0 // fixint -16
+	var derr *DecodeError
+	assert.True(t, errors.As(got.Decode(bytes.NewReader(b)), &derr))
+}
+
+func TestInsertHashed(t *testing.T) {
+	tk1, tk2 := New(10, WithSeed(7)), New(10, WithSeed(7))
+	for i := 0; i < 1000; i++ {
+		x := fmt.Sprintf("word-%d", i%(1+i%40))
+		tk1.Insert(x, 1)
+		tk2.InsertHashed(x, tk2.Hash(x), 1)
+	}
+	assert.Equal(t, tk1, tk2)
+}
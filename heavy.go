@@ -0,0 +1,53 @@
+package topk
+
+import "slices"
+
+// GuaranteedKeys returns the elements of Keys whose guaranteed count,
+// Count-Error, exceeds both the smallest monitored count and the largest
+// alpha. These bound the counts of the keys that are not monitored, also of
+// those that were evicted or forgotten, so these elements are heavy hitters
+// for certain. Unlike Keys, the result has no false positives, but may miss
+// heavy hitters whose error is too large.
+func (s *Stream) GuaranteedKeys() []Element {
+	return s.redacted(s.guaranteed(s.sorted(nil)))
+}
+
+// GuaranteedKeys is like Stream.GuaranteedKeys, limited to the top k
+// elements.
+func (t *TopK) GuaranteedKeys() []Element {
+	return t.redacted(t.Stream.guaranteed(t.sorted(nil)))
+}
+
+// guaranteed filters elts to the elements whose guaranteed count exceeds
+// the count of any key s doesn't monitor.
+func (s *Stream) guaranteed(elts []Element) []Element {
+	if len(s.k.elts) == 0 {
+		return nil
+	}
+	floor := max(s.k.elts[0].Count, slices.Max(s.alphas))
+	res := elts[:0]
+	for _, e := range elts {
+		if e.Count-e.Error > floor {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// HeavyHitters returns the elements of Keys whose estimated count exceeds
+// phi times the total count, see Count, the classic phi-heavy-hitters query.
+// As estimates are upper bounds, every monitored key whose true count
+// exceeds it is returned, along with possible false positives;
+// GuaranteedKeys gives the conservative set. For a TopK, the result is not
+// limited to the top k.
+func (s *Stream) HeavyHitters(phi float64) []Element {
+	threshold := phi * float64(s.c)
+	elts := s.sorted(nil)
+	res := elts[:0]
+	for _, e := range elts {
+		if float64(e.Count) > threshold {
+			res = append(res, e)
+		}
+	}
+	return s.redacted(res)
+}
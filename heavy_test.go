@@ -0,0 +1,73 @@
+package topk
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuaranteedKeys(t *testing.T) {
+	tk := New(20)
+	r := rand.New(rand.NewSource(1))
+	exact := make(map[string]int)
+	for i := 0; i < 50000; i++ {
+		x := fmt.Sprintf("word-%d", int(r.ExpFloat64()*20))
+		tk.Insert(x, 1)
+		exact[x]++
+	}
+
+	keys := tk.GuaranteedKeys()
+	assert.NotEmpty(t, keys)
+	assert.LessOrEqual(t, len(keys), len(tk.Keys()))
+	r1 := Evaluate(keys, exact, 20)
+	assert.Equal(t, 1.0, r1.Precision)
+	assert.Empty(t, r1.Violations)
+
+	// keys with errors are left out
+	tk = New(2)
+	tk.Insert("a", 10)
+	for i := 0; i < 10; i++ {
+		tk.Insert(fmt.Sprintf("b-%d", i), 1)
+	}
+	assert.Equal(t, []Element{{Key: "a", Count: 10}}, tk.GuaranteedKeys())
+	assert.Empty(t, New(2).GuaranteedKeys())
+
+	// a forgotten key may still be heavier than the monitored ones
+	tk = New(2)
+	tk.Insert("a", 100)
+	tk.Insert("b", 10)
+	tk.Insert("c", 5)
+	assert.True(t, tk.Forget("a"))
+	assert.Empty(t, tk.GuaranteedKeys())
+	tk.Insert("b", 100)
+	assert.Equal(t, []Element{{Key: "b", Count: 110}}, tk.GuaranteedKeys())
+}
+
+func TestHeavyHitters(t *testing.T) {
+	tk := New(20)
+	r := rand.New(rand.NewSource(1))
+	exact := make(map[string]int)
+	for i := 0; i < 50000; i++ {
+		x := fmt.Sprintf("word-%d", int(r.ExpFloat64()*20))
+		tk.Insert(x, 1)
+		exact[x]++
+	}
+
+	for _, phi := range []float64{0.01, 0.05, 0.1} {
+		hh := tk.HeavyHitters(phi)
+		got := make(map[string]bool)
+		for _, e := range hh {
+			got[e.Key] = true
+			assert.Greater(t, float64(e.Count), phi*50000)
+		}
+		for x, c := range exact {
+			if float64(c) > phi*50000 {
+				assert.True(t, got[x], "phi %v: %s with %d", phi, x, c)
+			}
+		}
+	}
+	assert.Empty(t, tk.HeavyHitters(1))
+	assert.Equal(t, tk.Stream.Keys(), tk.HeavyHitters(0))
+}
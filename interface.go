@@ -0,0 +1,16 @@
+package topk
+
+import "io"
+
+// Interface is the public behavior of a Stream. Application code can depend
+// on it rather than on *Stream, e.g. to inject fakes in tests or to wrap a
+// Stream with decorators adding metrics, locking or tracing. *Stream and
+// *ConcurrentStream implement it.
+type Interface interface {
+	Sketch
+	Estimate(x string) Element
+	Merge(other *Stream) error
+	Encode(w io.Writer) error
+	Decode(r io.Reader) error
+	Stats() Stats
+}
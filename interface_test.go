@@ -0,0 +1,45 @@
+package topk
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ Interface = (*Stream)(nil)
+	_ Interface = (*ConcurrentStream)(nil)
+)
+
+// countingStream decorates an Interface, counting inserts.
+type countingStream struct {
+	Interface
+	inserts int
+}
+
+func (c *countingStream) Insert(x string, count int) Element {
+	c.inserts++
+	return c.Interface.Insert(x, count)
+}
+
+func TestInterface(t *testing.T) {
+	for _, s := range []Interface{newStream(5), Safe(newStream(5))} {
+		c := &countingStream{Interface: s}
+		var i Interface = c
+		i.Insert("a", 2)
+		i.Insert("b", 1)
+		assert.Equal(t, 2, c.inserts)
+		assert.Equal(t, []Element{{Key: "a", Count: 2}, {Key: "b", Count: 1}}, i.Keys())
+		assert.Equal(t, 2, i.Stats().Elements)
+
+		var buf bytes.Buffer
+		require.NoError(t, i.Encode(&buf))
+		got := &countingStream{Interface: newStream(5)}
+		require.NoError(t, got.Decode(&buf))
+		assert.Equal(t, i.Keys(), got.Keys())
+		require.NoError(t, got.Merge(newStream(5)))
+		assert.Equal(t, Element{Key: "a", Count: 2}, got.Estimate("a"))
+	}
+}
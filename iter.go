@@ -0,0 +1,51 @@
+package topk
+
+import "iter"
+
+// All returns an iterator over the elements of Keys in no particular order,
+// without copying or sorting them unless a pipeline is set or elements are
+// monitored in overflow, see SetOverflow. The Stream must not be modified
+// while iterating.
+func (s *Stream) All() iter.Seq[Element] {
+	return func(yield func(Element) bool) {
+		if len(s.pipeline) > 0 || len(s.k.elts) > s.n {
+			for _, e := range s.Keys() {
+				if !yield(e) {
+					return
+				}
+			}
+			return
+		}
+		for _, e := range s.k.elts {
+			if s.redact != nil {
+				e.Key = s.redact(e.Key)
+			}
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+// Top returns an iterator over the first m elements of Keys, in order,
+// selected like TopN.
+func (s *Stream) Top(m int) iter.Seq[Element] {
+	return func(yield func(Element) bool) {
+		for _, e := range s.TopN(m) {
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the top k elements, in order. See
+// Stream.All.
+func (t *TopK) All() iter.Seq[Element] {
+	return t.Top(t.k)
+}
+
+// Top returns an iterator over the first m of the top k elements, in order.
+func (t *TopK) Top(m int) iter.Seq[Element] {
+	return t.Stream.Top(min(m, t.k))
+}
@@ -0,0 +1,33 @@
+package topk
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAll(t *testing.T) {
+	tk := New(10)
+	for i := 0; i < 1000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%(1+i%40)), 1)
+	}
+
+	all := slices.Collect(tk.Stream.All())
+	assert.ElementsMatch(t, tk.Stream.Keys(), all)
+	assert.Equal(t, tk.Keys(), slices.Collect(tk.All()))
+	assert.Equal(t, tk.Keys()[:3], slices.Collect(tk.Top(3)))
+	assert.Equal(t, tk.Keys(), slices.Collect(tk.Top(100)))
+
+	var n int
+	for range tk.Stream.All() {
+		if n++; n == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, n)
+
+	tk.SetPipeline(Threshold(20))
+	assert.Equal(t, tk.Stream.Keys(), slices.Collect(tk.Stream.All()))
+}
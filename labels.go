@@ -0,0 +1,99 @@
+package topk
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Labels are the dimensions of an insert, e.g. {"region": "eu"}.
+type Labels map[string]string
+
+// LabelledTopK counts the top elements overall and per label value, e.g.
+// the top keys of every region. Every label value gets its own sub-sketch,
+// so the number of distinct values should be small. The sub-sketches share
+// the key strings of an insert.
+type LabelledTopK struct {
+	k      int
+	opts   []Option
+	all    *TopK
+	slices map[string]map[string]*TopK // label -> value -> sketch
+}
+
+// NewLabelled returns a LabelledTopK reporting the top k elements, with
+// every sketch created with opts.
+func NewLabelled(k int, opts ...Option) *LabelledTopK {
+	return &LabelledTopK{
+		k:      k,
+		opts:   opts,
+		all:    New(k, opts...),
+		slices: make(map[string]map[string]*TopK),
+	}
+}
+
+// Insert adds count for x overall and to the slice of each of labels. It
+// returns the overall estimate.
+func (l *LabelledTopK) Insert(x string, count int, labels Labels) Element {
+	for label, value := range labels {
+		values, ok := l.slices[label]
+		if !ok {
+			values = make(map[string]*TopK)
+			l.slices[label] = values
+		}
+		tk, ok := values[value]
+		if !ok {
+			tk = New(l.k, l.opts...)
+			values[value] = tk
+		}
+		tk.Insert(x, count)
+	}
+	return l.all.Insert(x, count)
+}
+
+// Keys returns the top k elements overall.
+func (l *LabelledTopK) Keys() []Element {
+	return l.all.Keys()
+}
+
+// Count returns the total count overall.
+func (l *LabelledTopK) Count() int64 {
+	return l.all.Count()
+}
+
+// Slice returns the sketch of the inserts with label set to value, or nil
+// if there were none.
+func (l *LabelledTopK) Slice(label, value string) *TopK {
+	return l.slices[label][value]
+}
+
+// KeysBy returns the top k elements of the inserts with label set to value.
+func (l *LabelledTopK) KeysBy(label, value string) []Element {
+	if tk := l.Slice(label, value); tk != nil {
+		return tk.Keys()
+	}
+	return nil
+}
+
+// Values returns the values seen for label, in ascending order.
+func (l *LabelledTopK) Values(label string) []string {
+	res := make([]string, 0, len(l.slices[label]))
+	for v := range l.slices[label] {
+		res = append(res, v)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Rollup merges the slices of label for the given values, e.g. the regions
+// of a continent, into a new TopK. Values without inserts are skipped.
+func (l *LabelledTopK) Rollup(label string, values ...string) (*TopK, error) {
+	var sketches []*TopK
+	for _, v := range values {
+		if tk := l.Slice(label, v); tk != nil {
+			sketches = append(sketches, tk)
+		}
+	}
+	if len(sketches) == 0 {
+		return nil, fmt.Errorf("topk: no inserts for %s in %v", label, values)
+	}
+	return MergeMany(sketches...)
+}
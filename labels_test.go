@@ -0,0 +1,31 @@
+package topk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelledTopK(t *testing.T) {
+	l := NewLabelled(2)
+	l.Insert("a", 5, Labels{"region": "eu", "host": "h1"})
+	l.Insert("b", 3, Labels{"region": "us", "host": "h1"})
+	l.Insert("c", 4, Labels{"region": "ap"})
+	l.Insert("b", 3, nil)
+
+	assert.Equal(t, []Element{{Key: "b", Count: 6}, {Key: "a", Count: 5}}, l.Keys())
+	assert.Equal(t, int64(15), l.Count())
+	assert.Equal(t, []Element{{Key: "a", Count: 5}}, l.KeysBy("region", "eu"))
+	assert.Nil(t, l.KeysBy("region", "sa"))
+	assert.Equal(t, []string{"ap", "eu", "us"}, l.Values("region"))
+	assert.Equal(t, []string{"h1"}, l.Values("host"))
+
+	rollup, err := l.Rollup("region", "eu", "us", "sa")
+	require.NoError(t, err)
+	assert.Equal(t, []Element{{Key: "a", Count: 5}, {Key: "b", Count: 3}}, rollup.Keys())
+	assert.Equal(t, int64(8), rollup.Count())
+
+	_, err = l.Rollup("region", "sa")
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package topk
+
+import (
+	"math"
+	"sort"
+)
+
+// Ranked is an Element with the smoothed score it is ranked by.
+type Ranked struct {
+	Element
+	Score float64 `json:"score"`
+}
+
+// Leaderboard turns successive TopK results into a slowly changing ranking
+// suitable for display to end users. Counts are exponentially smoothed
+// between updates, so a single noisy refresh can't reorder the list, and
+// elements need a minimum guaranteed count before they are shown at all.
+// With a prior, the smoothed counts are combined with it into a Bayesian
+// average, so elements seen in few updates rank close to the prior until
+// they have proven themselves.
+type Leaderboard struct {
+	// MinCount is the guaranteed count (Count-Error) an element needs to be
+	// ranked.
+	MinCount int64
+	// Smoothing in [0, 1) is the weight of the previous smoothed count of
+	// an element when its new estimate is folded in. 0 disables smoothing.
+	Smoothing float64
+	// Prior is the count an element is assumed to have before it was seen,
+	// e.g. a typical count of the ranked elements, and PriorWeight the
+	// number of updates this assumption is worth. The score of an element
+	// ranked in u updates is then
+	// (PriorWeight*Prior + u*smoothed count) / (PriorWeight + u), the
+	// Laplace-smoothed mean for a Prior of 1. A PriorWeight <= 0 disables
+	// the prior, and the score is the smoothed count.
+	Prior       float64
+	PriorWeight float64
+
+	scores map[string]*leaderScore
+}
+
+// leaderScore is the state of an element of a Leaderboard.
+type leaderScore struct {
+	smoothed float64
+	updates  int // the updates the element was ranked in
+}
+
+// score returns the score of the element in l.
+func (l *Leaderboard) score(s *leaderScore) float64 {
+	if l.PriorWeight <= 0 {
+		return s.smoothed
+	}
+	u := float64(s.updates)
+	return (l.PriorWeight*l.Prior + u*s.smoothed) / (l.PriorWeight + u)
+}
+
+// Update folds the current results into the smoothed counts and returns the
+// top n elements by score. Elements missing from elts keep decaying until
+// they drop below MinCount.
+func (l *Leaderboard) Update(elts []Element, n int) []Ranked {
+	if l.scores == nil {
+		l.scores = make(map[string]*leaderScore, len(elts))
+	}
+
+	seen := make(map[string]Element, len(elts))
+	for _, e := range elts {
+		if e.Count-e.Error < l.MinCount {
+			continue
+		}
+		seen[e.Key] = e
+		if prev, ok := l.scores[e.Key]; ok {
+			prev.smoothed = l.Smoothing*prev.smoothed + (1-l.Smoothing)*float64(e.Count)
+			prev.updates++
+		} else {
+			l.scores[e.Key] = &leaderScore{smoothed: float64(e.Count), updates: 1}
+		}
+	}
+	for k, v := range l.scores {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		if v.smoothed *= l.Smoothing; v.smoothed < float64(l.MinCount) || v.smoothed == 0 {
+			delete(l.scores, k)
+		}
+	}
+
+	res := make([]Ranked, 0, len(l.scores))
+	for k, v := range l.scores {
+		e, ok := seen[k]
+		if !ok {
+			e = Element{Key: k}
+		}
+		res = append(res, Ranked{Element: e, Score: l.score(v)})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score || (res[i].Score == res[j].Score && res[i].Key < res[j].Key)
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// Trending ranks the elements of recent, a sketch over a recent window, by
+// how much they stand out against their long-term volume in s. The score is
+// the recent count divided by the square root of the total count, so keys
+// with a sudden burst rank above keys that are merely always large.
+func (s *Stream) Trending(recent *Stream, n int) []Ranked {
+	elts := recent.sorted(nil)
+	res := make([]Ranked, 0, len(elts))
+	for _, e := range elts {
+		total := s.Estimate(e.Key).Count
+		if total < e.Count {
+			total = e.Count
+		}
+		if total == 0 {
+			continue
+		}
+		res = append(res, Ranked{Element: e, Score: float64(e.Count) / math.Sqrt(float64(total))})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score || (res[i].Score == res[j].Score && res[i].Key < res[j].Key)
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	if recent.redact != nil {
+		for i := range res {
+			res[i].Key = recent.redact(res[i].Key)
+		}
+	}
+	return res
+}
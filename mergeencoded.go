@@ -0,0 +1,169 @@
+package topk
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// MergeEncoded merges a snapshot written by Encode into s, like decoding it
+// into a Stream and merging that, but without materializing the decoded
+// Stream: the alphas are added as they are read, and only the alphas of the
+// cells of the monitored elements of s are kept for the merge. Unlike Merge,
+// the snapshot must have the same size as s. s is not modified on error.
+func (s *Stream) MergeEncoded(r io.Reader) error {
+	return s.labelled("merge", func() error {
+		return decodeFrom(r, s.transform, false, s.mergeEncoded)
+	})
+}
+
+// MergeEncoded merges a snapshot written by TopK.Encode into t. See
+// Stream.MergeEncoded. Snapshots don't record decay, so t can't decay.
+func (t *TopK) MergeEncoded(r io.Reader) error {
+	if t.halfLife > 0 {
+		return ErrDecayMismatch
+	}
+	return t.Stream.labelled("merge", func() error {
+		return decodeFrom(r, t.transformer(), false, func(dec decoder) error {
+			k, err := readHeader(dec)
+			if err != nil {
+				return &DecodeError{Section: "header", Err: err}
+			}
+			c, err := dec.ReadInt64()
+			if err != nil {
+				return &DecodeError{Section: "header", Err: err}
+			}
+			if k < 0 || c < 0 {
+				return corrupt("header", "k %d and count %d", k, c)
+			}
+			if err := t.checkMerge(&TopK{k: k, Stream: &Stream{c: c}}); err != nil {
+				return err
+			}
+			if err := t.Stream.mergeEncoded(dec); err != nil {
+				return err
+			}
+			t.c = t.add(t.c, c)
+			return nil
+		})
+	})
+}
+
+// mergeEncoded merges the encoded Stream read from r into s.
+func (s *Stream) mergeEncoded(r decoder) error {
+	other := Stream{hasher: s.hasher}
+	if err := other.decodeHead(r); err != nil {
+		return err
+	}
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return &DecodeError{Section: "alphas", Err: err}
+	}
+	if err := s.mergeable(&other, int(sz)); err != nil {
+		return err
+	}
+	if other.n != s.n || int(sz) != len(s.alphas) {
+		return fmt.Errorf("expected stream of size n %d with %d alphas, got %d with %d", s.n, len(s.alphas), other.n, sz)
+	}
+
+	// counts saturate unless strict, see SetStrictCounts
+	var overflowed bool
+	add := func(a, b int64) int64 {
+		sum, ok := addCount(a, b)
+		overflowed = overflowed || !ok
+		return sum
+	}
+
+	// the alphas of other in the cells of the monitored elements of s,
+	// picked up in ascending order while reading
+	idx := make([]uint32, 0, len(s.k.elts))
+	for _, e := range s.k.elts {
+		idx = append(idx, reduce(s.sum(e.Key), len(s.alphas)))
+	}
+	slices.Sort(idx)
+	idx = slices.Compact(idx)
+	cells := make(map[uint32]int64, len(idx))
+	alphas := make([]int64, len(s.alphas))
+	for i := range alphas {
+		a, err := r.ReadInt64()
+		if err != nil {
+			return &DecodeError{Section: "alphas", Err: err}
+		}
+		if a < 0 {
+			return corrupt("alphas", "negative alpha %d", a)
+		}
+		if len(idx) > 0 && idx[0] == uint32(i) {
+			cells[idx[0]], idx = a, idx[1:]
+		}
+		alphas[i] = add(s.alphas[i], a)
+	}
+
+	// the index of the elements isn't needed
+	if sz, err = r.ReadMapHeader(); err != nil {
+		return &DecodeError{Section: "elements", Err: err}
+	}
+	if sz > uint32(other.n) {
+		return corrupt("elements", "%d monitored elements", sz)
+	}
+	for i := uint32(0); i < sz; i++ {
+		if _, err := r.ReadString(); err != nil {
+			return &DecodeError{Section: "elements", Err: err}
+		}
+		if _, err := r.ReadInt(); err != nil {
+			return &DecodeError{Section: "elements", Err: err}
+		}
+	}
+	n := sz
+	if sz, err = r.ReadArrayHeader(); err != nil {
+		return &DecodeError{Section: "elements", Err: err}
+	}
+	if sz != n {
+		return corrupt("elements", "%d elements for %d indexed keys", sz, n)
+	}
+
+	eMap := make(map[string]Element, len(s.k.elts)+int(sz))
+	for i := uint32(0); i < sz; i++ {
+		var e2 Element
+		if e2.Key, err = r.ReadString(); err != nil {
+			return &DecodeError{Section: "elements", Err: err}
+		}
+		if e2.Count, err = r.ReadInt64(); err != nil {
+			return &DecodeError{Section: "elements", Err: err}
+		}
+		if e2.Error, err = r.ReadInt64(); err != nil {
+			return &DecodeError{Section: "elements", Err: err}
+		}
+		if e2.Error < 0 || e2.Count < e2.Error {
+			return corrupt("elements", "element %q with count %d and error %d", e2.Key, e2.Count, e2.Error)
+		}
+		if _, ok := eMap[e2.Key]; ok {
+			return corrupt("elements", "element %q appears twice", e2.Key)
+		}
+		if idx, ok := s.k.m[e2.Key]; ok {
+			e1 := s.k.elts[idx]
+			eMap[e2.Key] = Element{Key: e2.Key, Count: add(e1.Count, e2.Count), Error: add(e1.Error, e2.Error)}
+			continue
+		}
+		min1 := s.alphas[reduce(s.sum(e2.Key), len(s.alphas))]
+		eMap[e2.Key] = Element{Key: e2.Key, Count: add(e2.Count, min1), Error: add(e2.Error, min1)}
+	}
+	for _, e1 := range s.k.elts {
+		if _, ok := eMap[e1.Key]; ok {
+			continue
+		}
+		min2 := cells[reduce(s.sum(e1.Key), len(s.alphas))]
+		eMap[e1.Key] = Element{Key: e1.Key, Count: add(e1.Count, min2), Error: add(e1.Error, min2)}
+	}
+	c := add(s.c, other.c)
+	if overflowed && s.strict {
+		return ErrCountOverflow
+	}
+
+	var trimmed []Element
+	s.k, trimmed = s.mergedKeys(eMap)
+	s.alphas = alphas
+	s.fold(trimmed)
+	s.c = c
+	s.saturated = s.saturated || overflowed
+	s.cover(&other)
+	return nil
+}
@@ -0,0 +1,86 @@
+package topk
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeEncoded(t *testing.T) {
+	words := loadWords()
+	parts := split(words[:30000], 3)
+	sketches := make([]*TopK, len(parts))
+	for i, part := range parts {
+		sketches[i] = New(20)
+		for _, w := range part {
+			sketches[i].Insert(w, 1)
+		}
+	}
+
+	want, got := New(20), New(20)
+	for _, tk := range sketches {
+		var buf bytes.Buffer
+		require.NoError(t, tk.Encode(&buf))
+		data := buf.Bytes()
+
+		decoded := &TopK{}
+		require.NoError(t, decoded.Decode(bytes.NewReader(data)))
+		require.NoError(t, want.Merge(decoded))
+		require.NoError(t, got.MergeEncoded(bytes.NewReader(data)))
+
+		assert.Equal(t, want.Keys(), got.Keys())
+		assert.Equal(t, want.alphas, got.alphas)
+		assert.Equal(t, want.Count(), got.Count())
+	}
+
+	// streams
+	var buf bytes.Buffer
+	require.NoError(t, sketches[0].Stream.Encode(&buf))
+	s := newStream(40)
+	require.NoError(t, s.MergeEncoded(&buf))
+	assert.Equal(t, sketches[0].Stream.Keys(), s.Keys())
+
+	// the target is left as is on error
+	buf.Reset()
+	require.NoError(t, sketches[1].Encode(&buf))
+	data := buf.Bytes()
+	keys := got.Keys()
+	assert.Error(t, got.MergeEncoded(bytes.NewReader(data[:len(data)/2])))
+	assert.Error(t, New(10).MergeEncoded(bytes.NewReader(data)))
+	assert.Error(t, New(20, WithBufferMultiplier(2)).MergeEncoded(bytes.NewReader(data)))
+	assert.Equal(t, keys, got.Keys())
+
+	decaying := New(20)
+	decaying.SetHalfLife(time.Hour)
+	assert.ErrorIs(t, decaying.MergeEncoded(bytes.NewReader(data)), ErrDecayMismatch)
+}
+
+func BenchmarkMergeEncoded(b *testing.B) {
+	tk := New(1000)
+	for _, w := range loadWords() {
+		tk.Insert(w, 1)
+	}
+	var buf bytes.Buffer
+	require.NoError(b, tk.Encode(&buf))
+	data := buf.Bytes()
+
+	b.Run("decode", func(b *testing.B) {
+		b.ReportAllocs()
+		dst := New(1000)
+		for i := 0; i < b.N; i++ {
+			other := &TopK{}
+			_ = other.Decode(bytes.NewReader(data))
+			_ = dst.Merge(other)
+		}
+	})
+	b.Run("encoded", func(b *testing.B) {
+		b.ReportAllocs()
+		dst := New(1000)
+		for i := 0; i < b.N; i++ {
+			_ = dst.MergeEncoded(bytes.NewReader(data))
+		}
+	})
+}
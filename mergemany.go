@@ -0,0 +1,141 @@
+package topk
+
+import (
+	"cmp"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// MergeMany returns a new TopK merging all of sketches, which must have the
+// same hash and half-life. It reports the largest k of them and is sized
+// like the largest of them, see Merge, with the configuration of that one,
+// e.g. its pipeline, eviction policy and aggregator. The inputs are not
+// modified, so MergeMany(a, b) is the non-destructive counterpart of
+// a.Merge(b).
+func MergeMany(sketches ...*TopK) (*TopK, error) {
+	if len(sketches) == 0 {
+		return nil, errors.New("topk: nothing to merge")
+	}
+	first := slices.MaxFunc(sketches, func(a, b *TopK) int { return cmp.Compare(a.n, b.n) })
+	k := slices.MaxFunc(sketches, func(a, b *TopK) int { return cmp.Compare(a.k, b.k) }).k
+	res := &TopK{
+		k:        k,
+		Stream:   emptyLike(first.Stream),
+		halfLife: first.halfLife,
+	}
+	res.n = max(res.n, k)
+	for _, tk := range sketches {
+		if err := res.Merge(tk); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Union returns a new Stream merging a and b, which are not modified, e.g.
+// to compute a combined view while both keep ingesting. See MergeMany for
+// TopKs.
+func Union(a, b *Stream) (*Stream, error) {
+	res := emptyLike(a)
+	if err := res.Merge(a); err != nil {
+		return nil, err
+	}
+	if err := res.Merge(b); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// emptyLike returns an empty Stream with the shape, hash and configuration
+// of s. Stateful features, like quotas or emerging keys, are not copied.
+func emptyLike(s *Stream) *Stream {
+	res := newStreamWithAlphas(s.n, len(s.alphas))
+	res.hash, res.hasher, res.seed = s.hash, s.hasher, s.seed
+	res.unit, res.agg = s.unit, s.agg
+	res.transform, res.redact = s.transform, s.redact
+	res.pipeline = slices.Clone(s.pipeline)
+	res.evict, res.ties, res.strict = s.evict, s.ties, s.strict
+	res.labels, res.clock = s.labels, s.clock
+	return res
+}
+
+// MergeAll returns a new Stream merging all of sketches, which must have the
+// same shape and hash, like Union. They are merged pairwise in a tree, with
+// the merges of each level running in parallel, so that many sketches take
+// log2(len(sketches)) rounds instead of len(sketches)-1. Merges trim to the
+// monitored elements, so the result may differ slightly from merging the
+// sketches one by one. The inputs are not modified.
+func MergeAll(sketches ...*Stream) (*Stream, error) {
+	if len(sketches) == 0 {
+		return nil, errors.New("topk: nothing to merge")
+	}
+	if len(sketches) == 1 {
+		return Union(sketches[0], emptyLike(sketches[0]))
+	}
+
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	level := sketches
+	for owned := false; len(level) > 1; owned = true {
+		next := make([]*Stream, (len(level)+1)/2)
+		errs := make([]error, len(next))
+		var wg sync.WaitGroup
+		for i := range next {
+			a := level[2*i]
+			var b *Stream
+			if 2*i+1 < len(level) {
+				b = level[2*i+1]
+			} else if owned {
+				next[i] = a
+				continue
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				switch {
+				case b == nil:
+					next[i], errs[i] = Union(a, emptyLike(a))
+				case owned:
+					next[i], errs[i] = a, a.Merge(b)
+				default:
+					next[i], errs[i] = Union(a, b)
+				}
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		level = next
+	}
+	return level[0], nil
+}
+
+// Contribution is a merged element together with the estimates of every
+// input sketch for its key, e.g. to tell which shard or region drives it.
+type Contribution struct {
+	Element
+	// Inputs are the estimates of the inputs, in the order they were passed.
+	Inputs []Element `json:"inputs"`
+}
+
+// MergeManyWithContributions is like MergeMany, but also returns the top k
+// elements of the result, ordered like Keys, with the contribution of every
+// input sketch.
+func MergeManyWithContributions(sketches ...*TopK) (*TopK, []Contribution, error) {
+	res, err := MergeMany(sketches...)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := res.sorted(nil)
+	contribs := make([]Contribution, len(keys))
+	for i, e := range keys {
+		contribs[i] = Contribution{Element: e, Inputs: make([]Element, len(sketches))}
+		for j, tk := range sketches {
+			contribs[i].Inputs[j] = tk.Estimate(e.Key)
+		}
+	}
+	return res, contribs, nil
+}
@@ -0,0 +1,139 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMany(t *testing.T) {
+	eu, us, ap := New(2), New(2), New(2)
+	eu.Insert("a", 10)
+	eu.Insert("b", 1)
+	us.Insert("a", 5)
+	us.Insert("c", 20)
+	ap.Insert("b", 2)
+
+	res, contribs, err := MergeManyWithContributions(eu, us, ap)
+	require.NoError(t, err)
+	assert.Equal(t, int64(38), res.Count())
+	assert.Equal(t, []Contribution{
+		{Element: Element{Key: "c", Count: 20}, Inputs: []Element{{Key: "c"}, {Key: "c", Count: 20}, {Key: "c"}}},
+		{Element: Element{Key: "a", Count: 15}, Inputs: []Element{{Key: "a", Count: 10}, {Key: "a", Count: 5}, {Key: "a"}}},
+	}, contribs)
+
+	// the inputs are untouched
+	assert.Equal(t, int64(11), eu.Count())
+
+	// the result reports the largest k, configured like the largest sketch
+	small, big := New(1), NewWithMonitored(3, 6, WithAggregator(func(old, delta int64) int64 { return max(old, delta) }))
+	big.SetPipeline(Threshold(2))
+	big.SetEvictionPolicy(EvictMax)
+	small.Insert("a", 5)
+	big.Insert("b", 3)
+	big.Insert("c", 1)
+	res, err = MergeMany(small, big)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.K())
+	assert.Equal(t, []Element{{Key: "a", Count: 5}, {Key: "b", Count: 3}}, res.Keys())
+	assert.Equal(t, EvictMax, res.evict)
+	assert.Equal(t, int64(5), res.Insert("a", 2).Count)
+
+	_, err = MergeMany()
+	assert.Error(t, err)
+	_, err = MergeMany(eu, NewWithErrorBound(0.25, 0.1))
+	assert.Error(t, err)
+}
+
+func TestUnion(t *testing.T) {
+	words := loadWords()[:20000]
+	a, b := newStream(20), newStream(20)
+	for i, w := range words {
+		if i%2 == 0 {
+			a.Insert(w, 1)
+		} else {
+			b.Insert(w, 1)
+		}
+	}
+	aKeys, bKeys := a.Keys(), b.Keys()
+	aAlphas := append([]int64(nil), a.alphas...)
+
+	u, err := Union(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, aKeys, a.Keys())
+	assert.Equal(t, bKeys, b.Keys())
+	assert.Equal(t, aAlphas, a.alphas)
+
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, a.Keys(), u.Keys())
+	assert.Equal(t, a.alphas, u.alphas)
+
+	// the union doesn't share state with its inputs
+	u.Insert("x", 1000)
+	assert.NotContains(t, a.Keys(), Element{Key: "x", Count: 1000})
+
+	_, err = Union(newStream(10), a)
+	assert.Error(t, err)
+}
+
+func TestMergeAll(t *testing.T) {
+	// without trimming, merges are associative and the tree gives the
+	// same result as merging one by one
+	var sketches []*Stream
+	for i := 0; i < 37; i++ {
+		s := newStream(50)
+		for j := 0; j < 40; j++ {
+			s.Insert(fmt.Sprint((i*j)%45), j%7+1)
+		}
+		sketches = append(sketches, s)
+	}
+	want := emptyLike(sketches[0])
+	for _, s := range sketches {
+		require.NoError(t, want.Merge(s))
+	}
+	first := sketches[0].Keys()
+
+	got, err := MergeAll(sketches...)
+	require.NoError(t, err)
+	assert.Equal(t, want.Keys(), got.Keys())
+	assert.Equal(t, want.alphas, got.alphas)
+	assert.Equal(t, first, sketches[0].Keys())
+
+	got, err = MergeAll(sketches[0])
+	require.NoError(t, err)
+	assert.Equal(t, first, got.Keys())
+	got.Insert("x", 1)
+	assert.Equal(t, first, sketches[0].Keys())
+
+	_, err = MergeAll()
+	assert.Error(t, err)
+	_, err = MergeAll(append(sketches, newStream(100))...)
+	assert.Error(t, err)
+}
+
+func BenchmarkMergeAll(b *testing.B) {
+	words := loadWords()
+	parts := split(words, 500)
+	sketches := make([]*Stream, len(parts))
+	for i, part := range parts {
+		sketches[i] = newStream(200)
+		for _, w := range part {
+			sketches[i].Insert(w, 1)
+		}
+	}
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			res := emptyLike(sketches[0])
+			for _, s := range sketches {
+				_ = res.Merge(s)
+			}
+		}
+	})
+	b.Run("tree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = MergeAll(sketches...)
+		}
+	})
+}
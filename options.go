@@ -0,0 +1,149 @@
+package topk
+
+import (
+	"math"
+	"slices"
+)
+
+// Option configures a TopK when it is created.
+type Option func(*config)
+
+type config struct {
+	hasher   func(string) uint64
+	seed     uint64
+	m        int // scale factor of New
+	buf      int // alphas per monitored element
+	alphas   int
+	ties     TieBreak
+	unit     float64
+	agg      func(old, delta int64) int64
+	pipeline []Stage
+}
+
+func newConfig(opts []Option) config {
+	c := config{m: defaultScaleFactorM, buf: defaultBufMultiplier}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// newStream returns a Stream monitoring n elements, with the given number of
+// alphas unless they are set explicitly.
+func (c config) newStream(n, alphas int) *Stream {
+	if c.alphas > 0 {
+		alphas = c.alphas
+	}
+	s := newStreamWithAlphas(n, alphas)
+	if c.hasher != nil {
+		s.hash, s.hasher = hashCustom, c.hasher
+	}
+	s.seed = c.seed
+	s.ties = c.ties
+	s.unit = c.unit
+	s.agg = c.agg
+	s.pipeline = c.pipeline
+	return s
+}
+
+// WithScaleFactor sets the number of monitored elements per reported
+// element for New, 2 by default. See NewWithScaleFactor.
+func WithScaleFactor(m int) Option {
+	return func(c *config) {
+		if m > 0 {
+			c.m = m
+		}
+	}
+}
+
+// WithBufferMultiplier sets the number of alpha cells per monitored
+// element, 6 by default as suggested by the paper. Larger filters reduce
+// the error of keys that are not monitored at the cost of memory, 8 bytes
+// per cell: multiplying the filter by 4 roughly divides the error of their
+// estimates by 4.
+func WithBufferMultiplier(f int) Option {
+	return func(c *config) {
+		if f > 0 {
+			c.buf, c.alphas = f, 0
+		}
+	}
+}
+
+// WithAlphas sets the number of alpha cells, overriding the buffer
+// multiplier and the sizing of NewWithErrorBound.
+func WithAlphas(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.alphas = size
+		}
+	}
+}
+
+// WithTieBreak sets how Keys orders elements with equal counts.
+func WithTieBreak(t TieBreak) Option {
+	return func(c *config) { c.ties = t }
+}
+
+// WithHasher sets the 64-bit hash function mapping keys to alpha cells,
+// e.g. to share hashing work with other sketches. It must be deterministic,
+// and snapshots can only be decoded and merged by sketches using the same
+// function.
+func WithHasher(h func(s string) uint64) Option {
+	return func(c *config) { c.hasher = h }
+}
+
+// WithSeed seeds the built-in hash, 0 by default, so that keys colliding
+// in the same alpha cell can't be crafted without knowing the seed. The
+// seed is kept in snapshots; only sketches with the same seed can be
+// merged. It has no effect with WithHasher.
+func WithSeed(seed uint64) Option {
+	return func(c *config) { c.seed = seed }
+}
+
+// WithWeightUnit sets the weight counted as 1 by InsertWeighted, 1 by
+// default, e.g. 1e-3 to track latencies in seconds to the millisecond.
+// Weights are rounded to whole units, so the unit should be small next to
+// the typical weight, and large enough that the total stays far below the
+// largest int64.
+func WithWeightUnit(unit float64) Option {
+	return func(c *config) {
+		if unit > 0 && !math.IsInf(unit, 1) {
+			c.unit = unit
+		}
+	}
+}
+
+// TieBreak orders elements with equal counts.
+type TieBreak int
+
+const (
+	// TieByKey orders ties by key. It is the default.
+	TieByKey TieBreak = iota
+	// TieByError puts the element with the smaller error, i.e. the larger
+	// guaranteed count, first, and orders by key after that.
+	TieByError
+)
+
+type elementsByCountThenError []Element
+
+func (elts elementsByCountThenError) Len() int { return len(elts) }
+func (elts elementsByCountThenError) Less(i, j int) bool {
+	if elts[i].Count != elts[j].Count {
+		return elts[i].Count > elts[j].Count
+	}
+	if elts[i].Error != elts[j].Error {
+		return elts[i].Error < elts[j].Error
+	}
+	return elts[i].Key < elts[j].Key
+}
+func (elts elementsByCountThenError) Swap(i, j int) { elts[i], elts[j] = elts[j], elts[i] }
+
+// sortElements sorts elts by descending count, breaking ties as configured.
+func (s *Stream) sortElements(elts []Element) {
+	slices.SortFunc(elts, func(a, b Element) int {
+		if s.before(a, b) {
+			return -1
+		}
+		return 1
+	})
+}
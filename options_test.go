@@ -0,0 +1,160 @@
+package topk
+
+import (
+	"bytes"
+	"hash/fnv"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fnvHasher(s string) uint64 {
+	h := fnv.New64()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func TestWithHasher(t *testing.T) {
+	var calls int
+	hasher := func(s string) uint64 {
+		calls++
+		return fnvHasher(s)
+	}
+	tk := New(5, WithHasher(hasher))
+	tk.Insert("foo", 1)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, Element{Key: "foo", Count: 1}, tk.Estimate("foo"))
+
+	var buf bytes.Buffer
+	require.NoError(t, tk.Encode(&buf))
+	b := buf.Bytes()
+
+	// decoding needs the hasher
+	assert.Error(t, New(5).Decode(bytes.NewReader(b)))
+	got := New(5, WithHasher(hasher))
+	require.NoError(t, got.Decode(bytes.NewReader(b)))
+	assert.Equal(t, tk.Keys(), got.Keys())
+
+	// built-in hashes keep working with a hasher configured
+	plain := New(5)
+	plain.Insert("bar", 2)
+	buf.Reset()
+	require.NoError(t, plain.Encode(&buf))
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, defaultHash, got.Stream.hash)
+	calls = 0
+	assert.Equal(t, Element{Key: "baz", Count: 0}, got.Estimate("baz"))
+	assert.Equal(t, 0, calls)
+
+	assert.Error(t, tk.Merge(plain))
+}
+
+func TestWithSeed(t *testing.T) {
+	a, b := New(5, WithSeed(42)), New(5)
+	assert.NotEqual(t, a.sum("foo"), b.sum("foo"))
+
+	a.Insert("foo", 3)
+	var buf bytes.Buffer
+	require.NoError(t, a.Encode(&buf))
+	got := &TopK{}
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, uint64(42), got.Stream.seed)
+	assert.Equal(t, a.sum("bar"), got.sum("bar"))
+
+	assert.Error(t, a.Merge(b))
+	assert.NoError(t, a.Merge(got))
+}
+
+func TestSizeOptions(t *testing.T) {
+	tk := New(10)
+	assert.Equal(t, 20, tk.n)
+	assert.Len(t, tk.alphas, 120)
+
+	tk = New(10, WithScaleFactor(4), WithBufferMultiplier(8))
+	assert.Equal(t, 40, tk.n)
+	assert.Len(t, tk.alphas, 320)
+
+	tk = NewWithMonitored(10, 50, WithAlphas(1000))
+	assert.Equal(t, 50, tk.n)
+	assert.Len(t, tk.alphas, 1000)
+
+	tk = NewWithErrorBound(0.1, 0.1, WithAlphas(7))
+	assert.Len(t, tk.alphas, 7)
+}
+
+func TestWithTieBreak(t *testing.T) {
+	keys := func(tk *TopK) []Element {
+		// a's count is partly inherited from its alpha cell
+		tk.alphas[reduce(tk.sum("a"), len(tk.alphas))] = 2
+		tk.Insert("a", 3)
+		tk.Insert("b", 5)
+		return tk.Keys()
+	}
+	assert.Equal(t, []Element{{Key: "a", Count: 5, Error: 2}, {Key: "b", Count: 5}}, keys(New(2)))
+	assert.Equal(t, []Element{{Key: "b", Count: 5}, {Key: "a", Count: 5, Error: 2}}, keys(New(2, WithTieBreak(TieByError))))
+}
+
+// unmonitoredError returns the mean absolute error of the estimates of the
+// keys of exact that tk does not monitor.
+func unmonitoredError(tk *TopK, exact map[string]int) float64 {
+	var sum, n int64
+	for k, c := range exact {
+		if _, ok := tk.Stream.k.m[k]; ok {
+			continue
+		}
+		d := tk.Estimate(k).Count - int64(c)
+		sum += max(d, -d)
+		n++
+	}
+	return float64(sum) / float64(n)
+}
+
+func TestBufferMultiplierAccuracy(t *testing.T) {
+	b, err := os.ReadFile("testdata/domains.txt")
+	require.NoError(t, err)
+	datasets := map[string][]string{
+		"domains": strings.Fields(string(b)), // skewed
+		"words":   loadWords(),               // almost uniform
+	}
+	for name, keys := range datasets {
+		exact := exactCount(keys)
+		top := exactTop(exact)[:10]
+
+		var errs []float64
+		for _, f := range []int{1, 2, defaultBufMultiplier, 24, 96} {
+			tk := New(10, WithBufferMultiplier(f))
+			for _, k := range keys {
+				tk.Insert(k, 1)
+			}
+			// the guarantees of the paper hold whatever the size of the filter
+			for _, e := range tk.Keys() {
+				assert.GreaterOrEqual(t, e.Count, int64(exact[e.Key]), "%s, multiplier %d: %s", name, f, e.Key)
+				assert.LessOrEqual(t, e.Count-e.Error, int64(exact[e.Key]), "%s, multiplier %d: %s", name, f, e.Key)
+			}
+			if name == "domains" {
+				var found int
+				for _, k := range top {
+					if _, ok := tk.Stream.k.m[k]; ok {
+						found++
+					}
+				}
+				t.Logf("domains, multiplier %d: %d of the top 10 monitored", f, found)
+				// the filter is what lets frequent keys displace the noise
+				if f >= defaultBufMultiplier {
+					assert.Equal(t, 10, found, "multiplier %d", f)
+				}
+			}
+
+			errs = append(errs, unmonitoredError(tk, exact))
+			t.Logf("%s, multiplier %d: mean error of unmonitored keys %.2f", name, f, errs[len(errs)-1])
+		}
+		// larger filters spread unmonitored keys over more cells
+		for i := 1; i < len(errs); i++ {
+			assert.Less(t, errs[i], errs[i-1], name)
+		}
+		assert.Less(t, errs[len(errs)-1], errs[0]/10, name)
+	}
+}
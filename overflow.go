@@ -0,0 +1,44 @@
+package topk
+
+// overflow lets the monitored set grow past n for close contests.
+type overflow struct {
+	factor float64
+	max    int
+}
+
+// SetOverflow makes Insert monitor up to max elements beyond n instead of
+// evicting the minimum element when the challenger's estimate is at most
+// factor times the minimum's count, i.e. when it is too close to call.
+// This smooths the accuracy cliff of hard eviction when the traffic mix
+// shifts. Keys still reports at most n elements. Once the overflow is full,
+// elements are evicted as usual; ReclaimOverflow gives the memory back
+// early. A factor < 1 or a max <= 0 disables it.
+func (s *Stream) SetOverflow(factor float64, max int) {
+	if factor < 1 || max <= 0 {
+		s.overflow = nil
+		return
+	}
+	s.overflow = &overflow{factor: factor, max: max}
+}
+
+// spill reports whether e should be added to the overflow instead of
+// evicting the minimum element.
+func (s *Stream) spill(e Element) bool {
+	return s.overflow != nil &&
+		len(s.k.elts) < s.n+s.overflow.max &&
+		float64(e.Count) <= s.overflow.factor*float64(s.k.elts[0].Count)
+}
+
+// ReclaimOverflow evicts the smallest elements until at most n are
+// monitored, as Insert would have, and returns the number of evicted
+// elements.
+func (s *Stream) ReclaimOverflow() int {
+	var evicted int
+	for len(s.k.elts) > s.n {
+		e := s.k.pop()
+		xhash := reduce(s.sum(e.Key), len(s.alphas))
+		s.alphas[xhash] = s.evict.alpha(s.alphas[xhash], e)
+		evicted++
+	}
+	return evicted
+}
@@ -0,0 +1,34 @@
+package topk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverflow(t *testing.T) {
+	// a large filter, so that the keys don't collide
+	tk := NewWithErrorBound(0.5, 0.01)
+	tk.SetOverflow(1.5, 1)
+	tk.Insert("a", 10)
+	tk.Insert("b", 8)
+
+	// too far ahead of b to spill, evicts b
+	tk.Insert("c", 20)
+	assert.Equal(t, []Element{{Key: "c", Count: 20}, {Key: "a", Count: 10}}, tk.Keys())
+
+	// close to a, spills
+	assert.Equal(t, Element{Key: "d", Count: 12}, tk.Insert("d", 12))
+	assert.Len(t, tk.Stream.k.elts, 3)
+	assert.Equal(t, []Element{{Key: "c", Count: 20}, {Key: "d", Count: 12}}, tk.Keys())
+
+	// the overflow is full, a is evicted
+	assert.Equal(t, Element{Key: "e", Count: 11}, tk.Insert("e", 11))
+	assert.Len(t, tk.Stream.k.elts, 3)
+	assert.Equal(t, Element{Key: "a", Count: 10, Error: 10}, tk.Estimate("a"))
+
+	assert.Equal(t, 1, tk.ReclaimOverflow())
+	assert.Equal(t, []Element{{Key: "c", Count: 20}, {Key: "d", Count: 12}}, tk.Keys())
+	assert.Equal(t, int64(11), tk.Estimate("e").Count)
+	assert.Equal(t, 0, tk.ReclaimOverflow())
+}
@@ -0,0 +1,121 @@
+package topk
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Stage post-processes the results of Keys. It may modify elts in place and
+// returns the elements to pass on, in the order they should be reported.
+type Stage func(elts []Element) []Element
+
+// SetPipeline sets the stages Keys passes its results through, in order,
+// replacing the previous ones. The stages apply where results are exported:
+// Keys, AppendKeys, TopN, KeysView, All and Top, and so the topkhttp
+// handler and the results of Windows, see Windows.SetPipeline. Queries
+// computing on the estimates, like GuaranteedKeys, HeavyHitters, Trending or
+// GlobalTopK, use the monitored elements as they are; Windows.Query does so
+// for live windows only.
+// TopK.Keys keeps the top k of the output, so elements dropped by a stage
+// make room for others. Keys are redacted after the stages, see
+// SetRedactor. Calling it without stages disables the pipeline.
+func (s *Stream) SetPipeline(stages ...Stage) {
+	s.pipeline = append([]Stage(nil), stages...)
+}
+
+// WithPipeline sets the stages Keys passes its results through. See
+// Stream.SetPipeline.
+func WithPipeline(stages ...Stage) Option {
+	return func(c *config) { c.pipeline = append([]Stage(nil), stages...) }
+}
+
+// SetPipeline sets the stages the results of every window pass through
+// when it is finalized, for windows created from now on. The stages are
+// shared by the windows: to smooth across successive windows, share a
+// Smoother and call its Advance after every finalized window, e.g. from the
+// Sink, which receives the windows in order. Query requires stages that
+// only drop elements, see there.
+func (w *Windows) SetPipeline(stages ...Stage) {
+	w.pipeline = append([]Stage(nil), stages...)
+}
+
+// Filter returns a Stage keeping the elements for which keep returns true.
+func Filter(keep func(Element) bool) Stage {
+	return func(elts []Element) []Element {
+		res := elts[:0]
+		for _, e := range elts {
+			if keep(e) {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+}
+
+// Redact returns a Stage mapping keys with redact, e.g. to hash or mask
+// sensitive values. Unlike SetRedactor, later stages see the redacted keys.
+func Redact(redact func(key string) string) Stage {
+	return func(elts []Element) []Element {
+		for i := range elts {
+			elts[i].Key = redact(elts[i].Key)
+		}
+		return elts
+	}
+}
+
+// Threshold returns a Stage dropping the elements with a guaranteed count
+// (Count-Error) below minCount, like Leaderboard.MinCount.
+func Threshold(minCount int64) Stage {
+	return Filter(func(e Element) bool { return e.Count-e.Error >= minCount })
+}
+
+// Smoother exponentially smooths the counts of elements between successive
+// results, like Leaderboard.Smoothing. Its Stage smooths results against
+// the counts as of the last call to Advance, so reading the same results
+// twice smooths them the same way, and only the caller decides when the
+// smoothing moves forward, e.g. once per reporting interval. A Smoother may
+// be shared, e.g. by the windows of Windows, and is safe for concurrent
+// use.
+type Smoother struct {
+	weight float64
+
+	mu   sync.Mutex
+	prev map[string]float64 // smoothed counts as of the last Advance
+	last map[string]float64 // smoothed counts of the last result
+}
+
+// Smooth returns a Smoother where weight in [0, 1) is the weight of the
+// previous smoothed count. Pass its Stage to SetPipeline.
+func Smooth(weight float64) *Smoother {
+	return &Smoother{weight: weight}
+}
+
+// Stage smooths elts against the counts as of the last Advance. Errors are
+// capped to the smoothed count, and the elements are reordered by it.
+// Elements missing from the previous result start over.
+func (sm *Smoother) Stage(elts []Element) []Element {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	last := make(map[string]float64, len(elts))
+	for i, e := range elts {
+		c := float64(e.Count)
+		if p, ok := sm.prev[e.Key]; ok {
+			c = sm.weight*p + (1-sm.weight)*c
+		}
+		last[e.Key] = c
+		elts[i].Count = int64(math.Round(c))
+		elts[i].Error = min(e.Error, elts[i].Count)
+	}
+	sm.last = last
+	sort.Sort(elementsByCountDescending(elts))
+	return elts
+}
+
+// Advance makes the counts of the last result smoothed by Stage the
+// previous counts of the following results.
+func (sm *Smoother) Advance() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.prev = sm.last
+}
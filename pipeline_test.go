@@ -0,0 +1,117 @@
+package topk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	tk := New(2, WithPipeline(
+		Filter(func(e Element) bool { return !strings.HasPrefix(e.Key, "internal/") }),
+		Threshold(3),
+		Redact(strings.ToUpper),
+	))
+	for k, c := range map[string]int{"a": 5, "internal/b": 10, "c": 4, "d": 2} {
+		tk.Insert(k, c)
+	}
+	// the filtered element makes room for the next one
+	assert.Equal(t, []Element{{Key: "A", Count: 5}, {Key: "C", Count: 4}}, tk.Keys())
+	assert.Equal(t, Element{Key: "internal/b", Count: 10}, tk.Estimate("internal/b"))
+
+	// stages run before the redactor
+	tk.SetRedactor(func(k string) string { return k + "*" })
+	assert.Equal(t, "A*", tk.Keys()[0].Key)
+
+	tk.SetPipeline()
+	tk.SetRedactor(nil)
+	assert.Equal(t, "internal/b", tk.Keys()[0].Key)
+}
+
+func TestSmooth(t *testing.T) {
+	s := newStream(3)
+	sm := Smooth(0.5)
+	s.SetPipeline(sm.Stage)
+	s.Insert("a", 10)
+	s.Insert("b", 6)
+	assert.Equal(t, []Element{{Key: "a", Count: 10}, {Key: "b", Count: 6}}, s.Keys())
+	sm.Advance()
+
+	// a spike of b is damped, the same way however often it is read
+	s.Insert("b", 10)
+	for range 3 {
+		assert.Equal(t, []Element{{Key: "b", Count: 11}, {Key: "a", Count: 10}}, s.Keys())
+		assert.Equal(t, []Element{{Key: "b", Count: 11}}, s.TopN(1))
+	}
+	sm.Advance()
+	s.Insert("c", 2)
+	assert.Equal(t, []Element{{Key: "b", Count: 14}, {Key: "a", Count: 10}, {Key: "c", Count: 2}}, s.Keys())
+
+	// queries on the estimates see the raw counts
+	assert.Equal(t, []Element{{Key: "b", Count: 16}, {Key: "a", Count: 10}}, s.HeavyHitters(0.3))
+}
+
+func TestPipelineInternal(t *testing.T) {
+	// a redacting pipeline doesn't hide the keys from queries that look
+	// them up again
+	upper := Redact(strings.ToUpper)
+	a, b := New(2, WithPipeline(upper)), New(2, WithPipeline(upper))
+	a.Insert("x", 5)
+	b.Insert("x", 3)
+	b.Insert("y", 1)
+	assert.Equal(t, []Element{{Key: "x", Count: 8}, {Key: "y", Count: 1}}, GlobalTopK(2, a, b))
+	assert.Equal(t, "X", a.Keys()[0].Key)
+
+	w := NewWindows(2, 2)
+	w.SetPipeline(upper)
+	w.InsertAt("x", 2, 1)
+	w.InsertAt("x", 3, 2)
+	res, err := w.Query(1, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Element{{Key: "x", Count: 5}}, res)
+
+	trending := a.Trending(b.Stream, 1)
+	require.Len(t, trending, 1)
+	assert.Equal(t, "x", trending[0].Key)
+}
+
+func TestWindowsPipeline(t *testing.T) {
+	w := NewWindows(2, 2)
+	w.SetPipeline(Threshold(2))
+	w.InsertAt("a", 3, 1)
+	w.InsertAt("b", 1, 1)
+	res, err := w.AdvanceWatermark(2)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, []Element{{Key: "a", Count: 3}}, res[0].Keys)
+}
+
+func TestWindowsSmooth(t *testing.T) {
+	sm := Smooth(0.5)
+	var smoothed []Window
+	w := NewWindows(2, 3)
+	w.SetPipeline(sm.Stage)
+	w.SetSink(SinkFunc(func(win Window) error {
+		smoothed = append(smoothed, win)
+		sm.Advance()
+		return nil
+	}))
+	w.InsertAt("a", 10, 1)
+	w.InsertAt("a", 20, 2)
+	w.InsertAt("a", 40, 3)
+	_, err := w.AdvanceWatermark(4)
+	require.NoError(t, err)
+	require.Len(t, smoothed, 3)
+	assert.Equal(t, int64(10), smoothed[0].Keys[0].Count)
+	assert.Equal(t, int64(15), smoothed[1].Keys[0].Count)
+	assert.Equal(t, int64(28), smoothed[2].Keys[0].Count)
+
+	// replays go through the same pipeline
+	w = NewWindows(2, 3)
+	w.SetPipeline(Threshold(2))
+	replayed := w.Replay([]Event{{Key: "a", Count: 3, Epoch: 1}, {Key: "b", Count: 1, Epoch: 1}})
+	require.Len(t, replayed, 1)
+	assert.Equal(t, []Element{{Key: "a", Count: 3}}, replayed[0].Keys)
+}
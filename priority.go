@@ -0,0 +1,138 @@
+package topk
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+// Class is the priority class of an insert, see InsertClass. Higher classes
+// have lower priority and are shed first when the Stream is overloaded.
+type Class int
+
+const (
+	// ClassLive is live traffic, which is never shed. Use InsertClass
+	// rather than Insert for it to count towards the limit of SetOverload.
+	ClassLive Class = iota
+	// ClassBackfill is traffic that can be degraded under load, e.g. the
+	// replay of historical data.
+	ClassBackfill
+)
+
+// overload tracks the inserts per interval, see SetOverload.
+type overload struct {
+	limit    int
+	interval time.Duration
+	sample   int
+
+	start   time.Time
+	inserts int
+	classes map[Class]*classCount
+	rng     *rand.Rand
+}
+
+type classCount struct {
+	inserts, dropped int
+}
+
+// SetOverload enables the degradation mode: once more than limit inserts
+// arrive within interval, inserts of class c above ClassLive are sampled,
+// keeping each with probability 1/sample^c, counted sample^c times so that estimates
+// stay unbiased. Lower priority classes are thus thinned out first, while
+// live traffic keeps its accuracy. Stats reports the drops per class. A
+// limit <= 0 or a sample < 2 disables it.
+func (s *Stream) SetOverload(limit int, interval time.Duration, sample int) {
+	if limit <= 0 || sample < 2 {
+		s.overload = nil
+		return
+	}
+	s.overload = &overload{
+		limit:    limit,
+		interval: interval,
+		sample:   sample,
+		classes:  make(map[Class]*classCount),
+		rng:      rand.New(rand.NewPCG(uint64(limit), uint64(sample))),
+	}
+}
+
+// shed returns the weight count is inserted with in class, 0 if the insert
+// is dropped.
+func (s *Stream) shed(class Class, count int) int {
+	o := s.overload
+	if o == nil {
+		return count
+	}
+
+	now := time.Now()
+	if s.clock != nil {
+		now = s.clock()
+	}
+	if now.Sub(o.start) >= o.interval {
+		o.start, o.inserts = now, 0
+	}
+	o.inserts++
+
+	cc := o.classes[class]
+	if cc == nil {
+		cc = &classCount{}
+		o.classes[class] = cc
+	}
+	cc.inserts++
+	if class <= ClassLive || o.inserts <= o.limit {
+		return count
+	}
+
+	every := int(min(math.Pow(float64(o.sample), float64(class)), math.MaxInt32))
+	if o.rng.IntN(every) != 0 {
+		cc.dropped++
+		return 0
+	}
+	if count > math.MaxInt/every {
+		return math.MaxInt
+	}
+	return count * every
+}
+
+// InsertClass is like Insert for an insert of the given Class, which may be
+// sampled if the Stream is overloaded, see SetOverload. If the insert is
+// dropped, the current estimate for x is returned and the Stream is not
+// modified.
+func (s *Stream) InsertClass(class Class, x string, count int) Element {
+	if count = s.shed(class, count); count <= 0 {
+		return s.Estimate(x)
+	}
+	return s.Insert(x, count)
+}
+
+// InsertClass is like Insert for an insert of the given Class. See
+// Stream.InsertClass.
+func (t *TopK) InsertClass(class Class, x string, count int) Element {
+	if count = t.shed(class, count); count <= 0 {
+		return t.Estimate(x)
+	}
+	return t.Insert(x, count)
+}
+
+// ClassStats counts the inserts of a Class, see SetOverload.
+type ClassStats struct {
+	Class   Class `json:"class"`
+	Inserts int   `json:"inserts"`
+	Dropped int   `json:"dropped"`
+	// DropRate is Dropped/Inserts.
+	DropRate float64 `json:"drop_rate"`
+}
+
+func (o *overload) stats() []ClassStats {
+	res := make([]ClassStats, 0, len(o.classes))
+	for c, cc := range o.classes {
+		res = append(res, ClassStats{
+			Class:    c,
+			Inserts:  cc.inserts,
+			Dropped:  cc.dropped,
+			DropRate: float64(cc.dropped) / float64(cc.inserts),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Class < res[j].Class })
+	return res
+}
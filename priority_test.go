@@ -0,0 +1,46 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverload(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tk := New(10)
+	tk.SetClock(func() time.Time { return now })
+	tk.SetOverload(1000, time.Minute, 4)
+
+	for i := 0; i < 20000; i++ {
+		tk.InsertClass(ClassLive, fmt.Sprint("live", i%5), 1)
+		tk.InsertClass(ClassBackfill, fmt.Sprint("backfill", i%4), 1)
+	}
+	// live traffic keeps exact counts
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, Element{Key: fmt.Sprint("live", i), Count: 4000}, tk.Estimate(fmt.Sprint("live", i)))
+	}
+	// backfill is thinned out, but unbiased
+	for i := 0; i < 4; i++ {
+		assert.InDelta(t, 5000, tk.Estimate(fmt.Sprint("backfill", i)).Count, 500)
+	}
+	assert.InDelta(t, 40000, tk.Count(), 1000)
+
+	st := tk.Stats().Classes
+	assert.Len(t, st, 2)
+	assert.Equal(t, ClassStats{Class: ClassLive, Inserts: 20000}, st[0])
+	assert.Equal(t, 20000, st[1].Inserts)
+	// the first 500 came before the limit was reached
+	assert.InDelta(t, 0.75*19500/20000, st[1].DropRate, 0.02)
+
+	// the next interval starts without shedding
+	now = now.Add(time.Minute)
+	e := tk.InsertClass(ClassBackfill, "backfill0", 1)
+	assert.Equal(t, tk.Estimate("backfill0"), e)
+	assert.Equal(t, st[1].Dropped, tk.Stats().Classes[1].Dropped)
+
+	tk.SetOverload(0, 0, 0)
+	assert.Nil(t, tk.Stats().Classes)
+}
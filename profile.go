@@ -0,0 +1,84 @@
+package topk
+
+import (
+	"context"
+	"io"
+	"runtime/pprof"
+)
+
+// SetProfilerLabels makes Merge, Encode and Decode run with the pprof label
+// topk=merge, topk=encode or topk=decode, so their cost can be attributed in
+// CPU profiles of the host application. Merge, Encode and Decode start from
+// an empty label set; use MergeContext, EncodeContext and DecodeContext to
+// add the label to those of a context instead, keeping the attribution of
+// the host.
+func (s *Stream) SetProfilerLabels(on bool) {
+	s.labels = on
+}
+
+// MergeContext is like Merge, but runs with the profiler labels of ctx.
+func (s *Stream) MergeContext(ctx context.Context, other *Stream) error {
+	return s.labelledContext(ctx, "merge", func(context.Context) error {
+		return s.merge(other, nil)
+	})
+}
+
+// EncodeContext is like Encode, but runs with the profiler labels of ctx.
+func (s *Stream) EncodeContext(ctx context.Context, w io.Writer) error {
+	return s.labelledContext(ctx, "encode", func(context.Context) error {
+		return encodeTo(w, s.transform, func(enc encoder) error {
+			return s.encode(enc, 0)
+		})
+	})
+}
+
+// DecodeContext is like Decode, but runs with the profiler labels of ctx.
+func (s *Stream) DecodeContext(ctx context.Context, r io.Reader) error {
+	return s.labelledContext(ctx, "decode", func(context.Context) error {
+		return decodeFrom(r, s.transform, false, s.decode)
+	})
+}
+
+// MergeContext is like Merge, but runs with the profiler labels of ctx.
+func (t *TopK) MergeContext(ctx context.Context, other *TopK) error {
+	if err := t.checkMerge(other); err != nil {
+		return err
+	}
+	return t.Stream.MergeContext(ctx, t.alignDecay(other))
+}
+
+// EncodeContext is like Encode, but runs with the profiler labels of ctx.
+func (t *TopK) EncodeContext(ctx context.Context, w io.Writer) error {
+	return t.Stream.labelledContext(ctx, "encode", func(context.Context) error {
+		return encodeTo(w, t.transformer(), func(enc encoder) error {
+			return t.encode(enc, 0)
+		})
+	})
+}
+
+// DecodeContext is like Decode, but runs with the profiler labels of ctx.
+func (t *TopK) DecodeContext(ctx context.Context, r io.Reader) error {
+	return t.Stream.labelledContext(ctx, "decode", func(context.Context) error {
+		return decodeFrom(r, t.transformer(), false, func(dec decoder) error {
+			return t.decode(dec, false)
+		})
+	})
+}
+
+// labelled runs f, with the pprof label topk=op if enabled.
+func (s *Stream) labelled(op string, f func() error) error {
+	return s.labelledContext(context.Background(), op, func(context.Context) error { return f() })
+}
+
+// labelledContext is like labelled, adding the label to those of ctx and
+// passing f the resulting context.
+func (s *Stream) labelledContext(ctx context.Context, op string, f func(context.Context) error) error {
+	if s == nil || !s.labels {
+		return f(ctx)
+	}
+	var err error
+	pprof.Do(ctx, pprof.Labels("topk", op), func(ctx context.Context) {
+		err = f(ctx)
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package topk
+
+// promote reports keys entering the monitored set or the top elements, see
+// OnPromote.
+type promote struct {
+	n  int
+	fn func(e Element, top bool)
+
+	// the top n elements as of the last refresh, and the last of them
+	top  map[string]struct{}
+	last Element
+}
+
+// OnPromote sets a hook called by Insert when x enters the monitored
+// elements, with top false, and when x enters the first n elements of Keys,
+// with top true, e.g. to react to a new heavy hitter without polling Keys.
+// For a TopK, n is usually K. e is the estimate of x after the insert. Keys
+// that reach the top through other operations than Insert, like Merge, are
+// not reported. A nil fn removes the hook.
+//
+// Checking for the top is cheap for most inserts: the top elements are only
+// recomputed when an inserted key may have overtaken the last of them.
+func (s *Stream) OnPromote(n int, fn func(e Element, top bool)) {
+	if fn == nil || n <= 0 {
+		s.promote = nil
+		return
+	}
+	s.promote = &promote{n: n, fn: fn}
+	s.promote.refresh(s)
+}
+
+// check reports the promotions of x by an insert, given whether it was
+// monitored before.
+func (p *promote) check(s *Stream, x string, monitored bool) {
+	idx, ok := s.k.m[x]
+	if !ok {
+		return
+	}
+	e := s.k.elts[idx]
+	if !monitored {
+		p.fn(e, false)
+	}
+	// counts only grow on insert, so x can't have overtaken an element
+	// that came after it
+	if _, ok := p.top[x]; ok || len(p.top) >= min(p.n, s.n) && !s.before(e, p.last) {
+		return
+	}
+	rank, ok := s.Rank(x)
+	p.refresh(s)
+	if ok && rank < p.n {
+		p.fn(e, true)
+	}
+}
+
+// refresh recomputes the top elements.
+func (p *promote) refresh(s *Stream) {
+	top := s.selectTop(min(p.n, s.n))
+	if p.top == nil {
+		p.top = make(map[string]struct{}, len(top))
+	}
+	clear(p.top)
+	p.last = Element{}
+	for i, e := range top {
+		p.top[e.Key] = struct{}{}
+		if i == 0 || s.before(p.last, e) {
+			p.last = e
+		}
+	}
+}
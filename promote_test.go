@@ -0,0 +1,63 @@
+package topk
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnPromote(t *testing.T) {
+	tk := New(5)
+	var monitored, top []string
+	tk.OnPromote(tk.K(), func(e Element, isTop bool) {
+		if isTop {
+			top = append(top, e.Key)
+		} else {
+			monitored = append(monitored, e.Key)
+		}
+	})
+
+	tk.Insert("a", 10)
+	tk.Insert("b", 5)
+	assert.Equal(t, []string{"a", "b"}, monitored)
+	assert.Equal(t, []string{"a", "b"}, top)
+
+	for i := 0; i < 3; i++ {
+		tk.Insert(fmt.Sprintf("c-%d", i), 20)
+	}
+	tk.Insert("a", 1)
+	assert.Equal(t, []string{"a", "b", "c-0", "c-1", "c-2"}, top)
+	top = nil
+
+	// a new key only enters the top once it overtakes the last of it
+	tk.Insert("d", 1)
+	assert.Empty(t, top)
+	tk.Insert("d", 10)
+	assert.Equal(t, []string{"d"}, top)
+
+	tk.OnPromote(0, nil)
+	tk.Insert("e", 100)
+	assert.Equal(t, []string{"d"}, top)
+}
+
+func TestOnPromoteTop(t *testing.T) {
+	tk := New(10)
+	r := rand.New(rand.NewSource(1))
+	var top []string
+	tk.OnPromote(tk.K(), func(e Element, isTop bool) {
+		if isTop {
+			top = append(top, e.Key)
+		}
+	})
+
+	// every key of the final top was reported entering it
+	for i := 0; i < 20000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", int(r.ExpFloat64()*30)), 1)
+	}
+	for _, e := range tk.Keys() {
+		assert.Contains(t, top, e.Key)
+	}
+	assert.Less(t, len(top), 1000)
+}
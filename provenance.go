@@ -0,0 +1,54 @@
+package topk
+
+import "sort"
+
+// Provenance describes where the estimate of a merged element came from.
+type Provenance uint8
+
+const (
+	// FromLeft is set if the element was monitored by the receiver of the
+	// merge.
+	FromLeft Provenance = 1 << iota
+	// FromRight is set if the element was monitored by the merged sketch.
+	FromRight
+	// Inferred is set if part of the count was taken from the filter of a
+	// sketch that did not monitor the element.
+	Inferred
+)
+
+// MergedElement is an Element annotated with its Provenance.
+type MergedElement struct {
+	Element
+	Provenance Provenance `json:"provenance"`
+}
+
+// MergeWithProvenance is like Merge, but also returns the elements monitored
+// after the merge, ordered like Keys, annotated with where their estimates
+// came from.
+func (s *Stream) MergeWithProvenance(other *Stream) ([]MergedElement, error) {
+	prov := make(map[string]Provenance, 2*s.n)
+	if err := s.merge(other, prov); err != nil {
+		return nil, err
+	}
+	return annotate(s.k.elts, prov), nil
+}
+
+// MergeWithProvenance is like Merge, but also returns where the estimates of
+// the merged elements came from. See Stream.MergeWithProvenance.
+func (t *TopK) MergeWithProvenance(other *TopK) ([]MergedElement, error) {
+	if err := t.checkMerge(other); err != nil {
+		return nil, err
+	}
+	return t.Stream.MergeWithProvenance(t.alignDecay(other))
+}
+
+func annotate(elts []Element, prov map[string]Provenance) []MergedElement {
+	res := make([]MergedElement, len(elts))
+	for i, e := range elts {
+		res[i] = MergedElement{Element: e, Provenance: prov[e.Key]}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return elementsByCountDescending{res[i].Element, res[j].Element}.Less(0, 1)
+	})
+	return res
+}
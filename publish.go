@@ -0,0 +1,140 @@
+package topk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Publisher is a Sink publishing finalized windows to a message bus with
+// at-least-once delivery: a window that could not be published is kept and
+// retried, in order, before any later window is published. A window may be
+// published more than once, e.g. if Publish failed after the bus received
+// it, so consumers should deduplicate by epoch.
+//
+// Publish adapts the bus client, e.g. for Kafka with
+// github.com/segmentio/kafka-go:
+//
+//	p := &topk.Publisher{Publish: func(ctx context.Context, w topk.Window) error {
+//		v, err := json.Marshal(w)
+//		if err != nil {
+//			return err
+//		}
+//		return writer.WriteMessages(ctx, kafka.Message{Key: []byte(strconv.Itoa(int(w.Epoch))), Value: v})
+//	}}
+//
+// or for NATS JetStream with github.com/nats-io/nats.go:
+//
+//	p := &topk.Publisher{Publish: func(ctx context.Context, w topk.Window) error {
+//		v, err := json.Marshal(w)
+//		if err != nil {
+//			return err
+//		}
+//		_, err = js.Publish(ctx, "topk.windows", v, jetstream.WithMsgID(strconv.Itoa(int(w.Epoch))))
+//		return err
+//	}}
+//
+// The windows that are not published yet are lost when the process exits,
+// unless they are persisted alongside the sketches with Encode and restored
+// with Decode. A Publisher is safe for concurrent use.
+type Publisher struct {
+	// Publish sends a window to the bus.
+	Publish func(ctx context.Context, w Window) error
+	// Retries is the number of times publishing a window is retried within
+	// a flush before giving up until the next one.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for every
+	// further retry.
+	Backoff time.Duration
+	// Transformer, if set, is applied by Encode and Decode, typically the
+	// one of the sketches persisted alongside.
+	Transformer Transformer
+
+	mu      sync.Mutex
+	pending []Window
+}
+
+// EmitWindow queues w and flushes the queue.
+func (p *Publisher) EmitWindow(w Window) error {
+	p.mu.Lock()
+	p.pending = append(p.pending, w)
+	p.mu.Unlock()
+	return p.Flush(context.Background())
+}
+
+// Flush publishes the pending windows in order. It stops at the first
+// window that still fails after the retries and returns its error; that
+// window and the following ones are retried by the next flush.
+func (p *Publisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.pending) > 0 {
+		if err := p.publish(ctx, p.pending[0]); err != nil {
+			return fmt.Errorf("topk: publishing window %d: %w", p.pending[0].Epoch, err)
+		}
+		p.pending = p.pending[1:]
+	}
+	p.pending = nil
+	return nil
+}
+
+func (p *Publisher) publish(ctx context.Context, w Window) error {
+	backoff := p.Backoff
+	for retry := 0; ; retry++ {
+		err := p.Publish(ctx, w)
+		if err == nil || retry >= p.Retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// Pending returns the windows that are not published yet, in order.
+func (p *Publisher) Pending() []Window {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Window(nil), p.pending...)
+}
+
+// Encode writes the pending windows as JSON.
+func (p *Publisher) Encode(w io.Writer) error {
+	if p.Transformer == nil {
+		return json.NewEncoder(w).Encode(p.Pending())
+	}
+	tw, err := p.Transformer.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(tw).Encode(p.Pending()); err != nil {
+		tw.Close()
+		return err
+	}
+	return tw.Close()
+}
+
+// Decode replaces the pending windows with the ones written by Encode.
+// They are published by the next flush.
+func (p *Publisher) Decode(r io.Reader) error {
+	if p.Transformer != nil {
+		var err error
+		if r, err = p.Transformer.NewReader(r); err != nil {
+			return err
+		}
+	}
+	var pending []Window
+	if err := json.NewDecoder(r).Decode(&pending); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.pending = pending
+	p.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,78 @@
+package topk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	var (
+		published []uint32
+		fail      int
+	)
+	p := &Publisher{
+		Publish: func(_ context.Context, w Window) error {
+			if fail > 0 {
+				fail--
+				return errors.New("unavailable")
+			}
+			published = append(published, w.Epoch)
+			return nil
+		},
+		Retries: 1,
+	}
+
+	w := NewWindows(2, 5)
+	w.SetSink(p)
+	w.InsertAt("a", 1, 1)
+	w.InsertAt("b", 1, 2)
+
+	// a transient failure is retried
+	fail = 1
+	_, err := w.AdvanceWatermark(2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1}, published)
+
+	// a lasting one keeps the window, and later ones queue behind it
+	fail = 2
+	w.InsertAt("c", 1, 3)
+	_, err = w.AdvanceWatermark(3)
+	assert.ErrorContains(t, err, "window 2: unavailable")
+	assert.Len(t, p.Pending(), 1)
+
+	// the pending windows survive a restart
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, p.Encode(buf))
+	restored := &Publisher{Publish: p.Publish, Retries: p.Retries}
+	require.NoError(t, restored.Decode(buf))
+	assert.Equal(t, p.Pending(), restored.Pending())
+
+	// with a Transformer
+	p.Transformer = gzipTransformer{}
+	require.NoError(t, p.Encode(buf))
+	assert.Error(t, (&Publisher{}).Decode(bytes.NewReader(buf.Bytes())))
+	gzipped := &Publisher{Transformer: gzipTransformer{}}
+	require.NoError(t, gzipped.Decode(buf))
+	assert.Equal(t, p.Pending(), gzipped.Pending())
+
+	fail = 2
+	assert.Error(t, restored.EmitWindow(Window{Epoch: 3}))
+	assert.Equal(t, []uint32{1}, published)
+	require.NoError(t, restored.Flush(context.Background()))
+	assert.Equal(t, []uint32{1, 2, 3}, published)
+	assert.Empty(t, restored.Pending())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fail = 1
+	restored.Backoff = time.Hour
+	restored.pending = []Window{{Epoch: 4}}
+	assert.ErrorIs(t, restored.Flush(ctx), context.Canceled)
+	assert.Len(t, restored.Pending(), 1)
+}
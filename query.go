@@ -0,0 +1,146 @@
+package topk
+
+import (
+	"slices"
+	"sort"
+)
+
+// Archive gives access to finalized windows kept outside of Windows, e.g.
+// the output of a JSONSink on disk.
+type Archive interface {
+	// Windows returns the archived windows with epochs in [from, to].
+	Windows(from, to uint32) ([]Window, error)
+}
+
+// ArchiveFunc adapts a function to an Archive.
+type ArchiveFunc func(from, to uint32) ([]Window, error)
+
+// Windows calls f(from, to).
+func (f ArchiveFunc) Windows(from, to uint32) ([]Window, error) { return f(from, to) }
+
+// SetArchive sets the Archive consulted by Query for epochs that are
+// neither live nor in the history.
+func (w *Windows) SetArchive(a Archive) {
+	w.archive = a
+}
+
+// Query returns the top n elements over the epochs in [from, to], wherever
+// their data lives: the live windows, the history, or the Archive, in that
+// order of preference. Live windows are queried for the estimate of every
+// candidate key. Finalized windows only know their top k, so a key missing
+// from one is counted with the Bound of that window, as error, keeping the
+// estimates upper bounds.
+//
+// Finalized windows hold their elements as reported, after the pipeline set
+// with SetPipeline, while live windows are queried before it. Query is only
+// valid with stages that keep keys and counts as they are and only drop
+// elements, like Threshold or Filter, since dropped elements are within the
+// Bound. Stages that lower counts, like a Smoother, or map keys, like
+// Redact, make the sums over finalized and live windows meaningless.
+func (w *Windows) Query(from, to uint32, n int) ([]Element, error) {
+	var (
+		live     []*TopK
+		finished []Window
+		seen     = make(map[uint32]bool)
+	)
+	for epoch, tk := range w.windows {
+		if epoch >= from && epoch <= to {
+			live = append(live, tk)
+			seen[epoch] = true
+		}
+	}
+	for _, win := range w.history {
+		if win.Epoch >= from && win.Epoch <= to && !seen[win.Epoch] {
+			finished = append(finished, win)
+			seen[win.Epoch] = true
+		}
+	}
+	if w.archive != nil {
+		archived, err := w.archive.Windows(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, win := range archived {
+			if win.Epoch >= from && win.Epoch <= to && !seen[win.Epoch] {
+				finished = append(finished, win)
+				seen[win.Epoch] = true
+			}
+		}
+	}
+
+	candidates := make(map[string]struct{})
+	for _, tk := range live {
+		for _, e := range tk.sorted(nil) {
+			candidates[e.Key] = struct{}{}
+		}
+	}
+	for _, win := range finished {
+		for _, e := range win.Keys {
+			candidates[e.Key] = struct{}{}
+		}
+	}
+
+	indexes := make([]map[string]Element, len(finished))
+	for i, win := range finished {
+		indexes[i] = make(map[string]Element, len(win.Keys))
+		for _, e := range win.Keys {
+			indexes[i][e.Key] = e
+		}
+	}
+
+	res := make([]Element, 0, len(candidates))
+	for key := range candidates {
+		sum := Element{Key: key}
+		for _, tk := range live {
+			e := tk.Estimate(key)
+			sum.Count += e.Count
+			sum.Error += e.Error
+		}
+		for i, win := range finished {
+			e, ok := windowEstimate(win, indexes[i], key, w.k)
+			sum.Count += e.Count
+			sum.Error += e.Error
+			if !ok {
+				sum.Error += e.Count
+			}
+		}
+		res = append(res, sum)
+	}
+
+	sort.Sort(elementsByCountDescending(res))
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// windowEstimate returns the element of key in win, whose keys are indexed
+// in keys, and true if win reported it. Otherwise it returns the Bound of
+// win. Windows archived before they carried a Bound have it 0; if such a
+// window reported k elements, its smallest count bounds the missing keys.
+func windowEstimate(win Window, keys map[string]Element, key string, k int) (Element, bool) {
+	if e, ok := keys[key]; ok {
+		return e, true
+	}
+	bound := win.Bound
+	if bound == 0 && len(win.Keys) >= k && len(win.Keys) > 0 {
+		bound = win.Keys[len(win.Keys)-1].Count
+	}
+	return Element{Key: key, Count: bound}, false
+}
+
+// unreported returns an upper bound of the count of every key not in
+// reported: the largest alpha, or count of another monitored element.
+func (s *Stream) unreported(reported []Element) int64 {
+	in := make(map[string]struct{}, len(reported))
+	for _, e := range reported {
+		in[e.Key] = struct{}{}
+	}
+	bound := slices.Max(s.alphas)
+	for _, e := range s.k.elts {
+		if _, ok := in[e.Key]; !ok {
+			bound = max(bound, e.Count)
+		}
+	}
+	return bound
+}
@@ -0,0 +1,85 @@
+package topk
+
+import "time"
+
+// maxQuotaSources is the number of sources tracked per interval, so that a
+// stream of distinct sources can't grow the quota without bounds.
+const maxQuotaSources = 1 << 16
+
+// sourceQuota tracks the weight contributed per source in the current interval.
+type sourceQuota struct {
+	limit    int
+	interval time.Duration
+	start    time.Time
+	used     map[string]int
+	others   int // used by the sources beyond maxQuotaSources
+}
+
+// SetSourceQuota caps the weight a single source can contribute through
+// InsertFrom to limit per interval. Once maxQuotaSources sources contributed
+// within an interval, further sources share a single quota. A limit <= 0 or
+// an interval <= 0 removes the quota.
+func (s *Stream) SetSourceQuota(limit int, interval time.Duration) {
+	if limit <= 0 || interval <= 0 {
+		s.quota = nil
+		return
+	}
+	start := time.Now()
+	if s.clock != nil {
+		start = s.clock()
+	}
+	s.quota = &sourceQuota{
+		limit:    limit,
+		interval: interval,
+		start:    start,
+		used:     make(map[string]int),
+	}
+}
+
+// admit returns how much of count source may still contribute and accounts
+// for it.
+func (s *Stream) admit(source string, count int) int {
+	q := s.quota
+	if q == nil || count <= 0 {
+		return count
+	}
+
+	now := time.Now()
+	if s.clock != nil {
+		now = s.clock()
+	}
+	if now.Sub(q.start) >= q.interval {
+		clear(q.used)
+		q.start, q.others = now, 0
+	}
+
+	used, ok := q.used[source]
+	if !ok && len(q.used) >= maxQuotaSources {
+		count = min(count, q.limit-q.others)
+		q.others += count
+		return count
+	}
+	count = min(count, q.limit-used)
+	q.used[source] = used + count
+	return count
+}
+
+// InsertFrom is like Insert, but accounts count against the quota of source
+// configured with SetSourceQuota. The part of count exceeding the quota is
+// dropped; if nothing is left, the current estimate for x is returned and
+// the Stream is not modified.
+func (s *Stream) InsertFrom(source, x string, count int) Element {
+	if count = s.admit(source, count); count <= 0 {
+		return s.Estimate(x)
+	}
+	return s.Insert(x, count)
+}
+
+// InsertFrom is like Insert, but accounts count against the quota of source.
+// See Stream.InsertFrom.
+func (t *TopK) InsertFrom(source, x string, count int) Element {
+	if count = t.admit(source, count); count <= 0 {
+		return t.Estimate(x)
+	}
+	return t.Insert(x, count)
+}
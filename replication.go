@@ -0,0 +1,112 @@
+package topk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Replicate sends the sketch returned by snapshot to tr under name every
+// interval until ctx is done, so Followers can serve reads while a single
+// leader ingests. snapshot is called from the goroutine running Replicate and
+// must synchronize with the ingester itself, e.g. by copying the sketch under
+// the ingester's lock. Replicate returns the first error of tr, or ctx.Err().
+func Replicate(ctx context.Context, tr Transport, name string, interval time.Duration, snapshot func() *TopK) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := tr.SendSketch(ctx, name, snapshot()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Follower serves reads from the latest sketch published under Name on
+// Transport. Reads are safe for concurrent use with Run and Sync; before the
+// first successful Sync the Follower behaves like an empty sketch.
+type Follower struct {
+	Transport Transport
+	Name      string
+	// Interval between polls in Run.
+	Interval time.Duration
+
+	mu sync.RWMutex
+	tk *TopK
+}
+
+// Sync fetches the latest sketch once.
+func (f *Follower) Sync(ctx context.Context) error {
+	tk, err := f.Transport.FetchSketch(ctx, f.Name)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.tk = tk
+	f.mu.Unlock()
+	return nil
+}
+
+// Run polls for the latest sketch every Interval until ctx is done. A sketch
+// that has not been published yet is not an error, the Follower keeps
+// polling for it.
+func (f *Follower) Run(ctx context.Context) error {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Sync(ctx); err != nil && !errors.Is(err, ErrSketchNotFound) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *Follower) sketch() *TopK {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.tk
+}
+
+// Keys returns the top k elements of the latest sketch.
+func (f *Follower) Keys() []Element {
+	if tk := f.sketch(); tk != nil {
+		return tk.Keys()
+	}
+	return nil
+}
+
+// Estimate returns the estimate for x of the latest sketch.
+func (f *Follower) Estimate(x string) Element {
+	if tk := f.sketch(); tk != nil {
+		return tk.Estimate(x)
+	}
+	return Element{Key: x}
+}
+
+// Staleness returns the staleness of the latest sketch. Together with a
+// clock on the leader, it tells whether the leader still ingests.
+func (f *Follower) Staleness() Staleness {
+	if tk := f.sketch(); tk != nil {
+		return tk.Staleness()
+	}
+	return Staleness{}
+}
+
+// Count returns the total count of the latest sketch.
+func (f *Follower) Count() int64 {
+	if tk := f.sketch(); tk != nil {
+		return tk.Count()
+	}
+	return 0
+}
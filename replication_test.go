@@ -0,0 +1,53 @@
+package topk
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplication(t *testing.T) {
+	tr := NewMemoryTransport()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := &Follower{Transport: tr, Name: "leader", Interval: time.Millisecond}
+	assert.Nil(t, f.Keys())
+	assert.Equal(t, Element{Key: "foo"}, f.Estimate("foo"))
+
+	// the follower may start before anything was published
+	followerDone := make(chan error, 1)
+	go func() { followerDone <- f.Run(ctx) }()
+
+	var mu sync.Mutex
+	leader := New(10)
+	snapshot := func() *TopK {
+		mu.Lock()
+		defer mu.Unlock()
+		var buf bytes.Buffer
+		assert.NoError(t, leader.Encode(&buf))
+		tk := &TopK{}
+		assert.NoError(t, tk.Decode(&buf))
+		return tk
+	}
+	leaderDone := make(chan error, 1)
+	go func() { leaderDone <- Replicate(ctx, tr, "leader", time.Millisecond, snapshot) }()
+
+	mu.Lock()
+	leader.Insert("foo", 3)
+	leader.Insert("bar", 1)
+	mu.Unlock()
+
+	require.Eventually(t, func() bool { return f.Count() == 4 }, time.Second, time.Millisecond)
+	assert.Equal(t, []Element{{Key: "foo", Count: 3}, {Key: "bar", Count: 1}}, f.Keys())
+	assert.Equal(t, Element{Key: "foo", Count: 3}, f.Estimate("foo"))
+
+	cancel()
+	assert.ErrorIs(t, <-followerDone, context.Canceled)
+	assert.ErrorIs(t, <-leaderDone, context.Canceled)
+}
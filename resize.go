@@ -0,0 +1,43 @@
+package topk
+
+// Resize changes the number of monitored elements of s to n, e.g. when the
+// configured top-k changes, keeping what s counted so far. The alphas are
+// resized in proportion, each new cell taking the largest of the old cells
+// covering the same keys, so estimates stay upper bounds; growing makes
+// them looser until new inserts refine them. Shrinking evicts the smallest
+// elements into the alphas. Resized sketches merge with sketches of the new
+// size and alphas. An n <= 0 is ignored.
+func (s *Stream) Resize(n int) {
+	if n <= 0 || n == s.n {
+		return
+	}
+	if s.n == 0 || len(s.alphas) == 0 {
+		// an empty Stream gets the default filter
+		s.alphas = make([]int64, n*defaultBufMultiplier)
+	} else {
+		s.alphas = resampleAlphas(s.alphas, max(n*len(s.alphas)/s.n, 1))
+	}
+	s.n = n
+	for len(s.k.elts) > n {
+		e := s.k.pop()
+		xhash := reduce(s.sum(e.Key), len(s.alphas))
+		s.alphas[xhash] = max(s.alphas[xhash], e.Count)
+	}
+	if s.promote != nil {
+		s.promote.refresh(s)
+	}
+}
+
+// Resize changes t to report the top k elements, keeping the ratio of
+// monitored to reported elements. See Stream.Resize. A k <= 0 is ignored.
+func (t *TopK) Resize(k int) {
+	if k <= 0 || k == t.k {
+		return
+	}
+	n := k * defaultScaleFactorM
+	if t.k > 0 {
+		n = max(k*t.n/t.k, k)
+	}
+	t.Stream.Resize(n)
+	t.k = k
+}
@@ -0,0 +1,65 @@
+package topk
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(5, 6)), 1.1, 1, 5000)
+	exact := make(map[string]int)
+	tk := New(50)
+	insert := func(n int) {
+		for i := 0; i < n; i++ {
+			x := fmt.Sprintf("word-%d", zipf.Uint64())
+			c := 1 + rng.IntN(3)
+			exact[x] += c
+			tk.Insert(x, c)
+		}
+	}
+
+	insert(20000)
+	tk.Resize(10)
+	assert.Equal(t, 10, tk.K())
+	assert.Equal(t, 20, tk.n)
+	assert.Len(t, tk.alphas, 120)
+	assert.Len(t, tk.Stream.k.elts, 20)
+	assert.Equal(t, 10, len(tk.Keys()))
+	r := EvaluateSketch(tk, exact, 10)
+	assert.Empty(t, r.Violations)
+
+	tk.Resize(100)
+	assert.Equal(t, 200, tk.n)
+	assert.Len(t, tk.alphas, 1200)
+	r = EvaluateSketch(tk, exact, 10)
+	assert.Empty(t, r.Violations)
+
+	// the grown sketch fills up again and merges with sketches of its size
+	insert(20000)
+	assert.Len(t, tk.Stream.k.elts, 200)
+	r = EvaluateSketch(tk, exact, 100)
+	assert.Empty(t, r.Violations)
+	assert.NoError(t, tk.Merge(New(100)))
+
+	var buf bytes.Buffer
+	require.NoError(t, tk.Encode(&buf))
+	decoded := New(100)
+	require.NoError(t, decoded.Decode(&buf))
+	assert.Equal(t, tk.Keys(), decoded.Keys())
+
+	// invalid and unchanged sizes are ignored, empty sketches get a filter
+	tk.Resize(0)
+	tk.Resize(100)
+	assert.Equal(t, 200, tk.n)
+	empty := New(0)
+	empty.Resize(5)
+	assert.Equal(t, 5, empty.K())
+	empty.Insert("a", 1)
+	assert.Equal(t, []Element{{Key: "a", Count: 1}}, empty.Keys())
+}
@@ -0,0 +1,79 @@
+package topk
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrCountOverflow is returned when a count would overflow an int64.
+var ErrCountOverflow = errors.New("topk: count overflow")
+
+// addCount returns a+b, saturating at the bounds of int64. ok is false if it
+// saturated.
+func addCount(a, b int64) (sum int64, ok bool) {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64, false
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64, false
+	}
+	return a + b, true
+}
+
+// add returns a+b, saturating and recording it in s.
+func (s *Stream) add(a, b int64) int64 {
+	sum, ok := addCount(a, b)
+	if !ok {
+		s.saturated = true
+	}
+	return sum
+}
+
+// SetStrictCounts makes Merge return ErrCountOverflow, leaving the Stream
+// unmodified, when a summed count would overflow. By default counts
+// saturate at the largest int64 instead of wrapping around, which would
+// invert the ranking, and Stats reports the Stream as Saturated. Insert
+// always saturates; use TryInsert to detect overflows on insert.
+func (s *Stream) SetStrictCounts(strict bool) {
+	s.strict = strict
+}
+
+// TryInsert is like Insert, but returns ErrCountOverflow without modifying
+// the Stream if the count of x or the total count would overflow.
+func (s *Stream) TryInsert(x string, count int) (Element, error) {
+	if _, ok := addCount(s.c, int64(count)); !ok {
+		return Element{}, ErrCountOverflow
+	}
+	if _, ok := addCount(s.Estimate(x).Count, int64(count)); !ok {
+		return Element{}, ErrCountOverflow
+	}
+	return s.Insert(x, count), nil
+}
+
+// TryInsert is like Insert, but returns ErrCountOverflow without modifying
+// the TopK if the count of x or the total count would overflow.
+func (t *TopK) TryInsert(x string, count int) (Element, error) {
+	if _, ok := addCount(t.c, int64(count)); !ok {
+		return Element{}, ErrCountOverflow
+	}
+	if _, ok := addCount(t.Estimate(x).Count, int64(count)); !ok {
+		return Element{}, ErrCountOverflow
+	}
+	return t.Insert(x, count), nil
+}
+
+// hasSaturated reports whether any count is at the bounds of int64, i.e.
+// whether a decoded Stream saturated before it was encoded.
+func (s *Stream) hasSaturated() bool {
+	for _, e := range s.k.elts {
+		if e.Count == math.MaxInt64 || e.Count == math.MinInt64 {
+			return true
+		}
+	}
+	for _, a := range s.alphas {
+		if a == math.MaxInt64 || a == math.MinInt64 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package topk
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaturate(t *testing.T) {
+	tk := New(2)
+	tk.Insert("a", 1)
+	setCount(tk.Stream, "a", math.MaxInt64-20)
+	tk.Insert("b", 10)
+	assert.False(t, tk.Stats().Saturated)
+
+	tk.Insert("a", 30)
+	assert.Equal(t, int64(math.MaxInt64), tk.Estimate("a").Count)
+	assert.Equal(t, int64(math.MaxInt64), tk.Count())
+	assert.True(t, tk.Stats().Saturated)
+	assert.Equal(t, "a", tk.Keys()[0].Key)
+
+	// the flag survives a round trip
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, tk.Encode(buf))
+	tk2 := &TopK{}
+	require.NoError(t, tk2.Decode(buf))
+	assert.True(t, tk2.Stats().Saturated)
+
+	_, err := New(2).TryInsert("a", 1)
+	assert.NoError(t, err)
+	_, err = tk.TryInsert("b", 1)
+	assert.ErrorIs(t, err, ErrCountOverflow)
+	assert.Equal(t, int64(10), tk.Estimate("b").Count)
+}
+
+func TestSaturateMerge(t *testing.T) {
+	newTK := func() *TopK {
+		tk := New(2)
+		tk.Insert("a", 1)
+		setCount(tk.Stream, "a", math.MaxInt64/2+1)
+		return tk
+	}
+
+	tk := newTK()
+	require.NoError(t, tk.Merge(newTK()))
+	assert.Equal(t, int64(math.MaxInt64), tk.Estimate("a").Count)
+	assert.True(t, tk.Stats().Saturated)
+
+	tk = newTK()
+	tk.SetStrictCounts(true)
+	assert.ErrorIs(t, tk.Merge(newTK()), ErrCountOverflow)
+	assert.Equal(t, int64(math.MaxInt64/2+1), tk.Estimate("a").Count)
+	assert.False(t, tk.Stats().Saturated)
+
+	// overflowing alphas are caught too
+	s1, s2 := newStream(1), newStream(1)
+	s1.alphas[0], s2.alphas[0] = math.MaxInt64, 1
+	s1.SetStrictCounts(true)
+	assert.ErrorIs(t, s1.Merge(s2), ErrCountOverflow)
+	s1.SetStrictCounts(false)
+	require.NoError(t, s1.Merge(s2))
+	assert.Equal(t, int64(math.MaxInt64), s1.alphas[0])
+}
+
+// setCount sets the count of the monitored x and the total accordingly,
+// reaching counts Insert can't take where int has 32 bits.
+func setCount(s *Stream, x string, count int64) {
+	idx := s.k.m[x]
+	s.c += count - s.k.elts[idx].Count
+	s.k.elts[idx].Count = count
+	s.k.fix(idx)
+}
+
+// TestDecodeLargeCount checks that counts beyond 32 bits are read back on
+// all platforms.
+func TestDecodeLargeCount(t *testing.T) {
+	tk := New(2)
+	tk.Insert("a", 1)
+	var buf bytes.Buffer
+	require.NoError(t, encodeTo(&buf, nil, func(enc encoder) error {
+		if err := writeHeader(enc, formatVersion); err != nil {
+			return err
+		}
+		if err := enc.WriteInt(tk.k); err != nil {
+			return err
+		}
+		if err := enc.WriteInt64(1 << 40); err != nil {
+			return err
+		}
+		return tk.Stream.encodeBody(enc, encodeNoCount)
+	}))
+
+	decoded := &TopK{}
+	require.NoError(t, decoded.Decode(&buf))
+	assert.Equal(t, int64(1<<40), decoded.Count())
+
+	setCount(tk.Stream, "a", 1<<40)
+	buf.Reset()
+	require.NoError(t, tk.Encode(&buf))
+	require.NoError(t, decoded.Decode(&buf))
+	assert.Equal(t, int64(1<<40), decoded.Estimate("a").Count)
+}
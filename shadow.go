@@ -0,0 +1,73 @@
+package topk
+
+import "fmt"
+
+// Violation is an estimate that does not bound the exact count of its key.
+type Violation struct {
+	Estimate Element `json:"estimate"`
+	Exact    int     `json:"exact"`
+}
+
+func (v Violation) Error() string {
+	e := v.Estimate
+	return fmt.Sprintf("topk: bounds violated for %q: count=%d error=%d exact=%d", e.Key, e.Count, e.Error, v.Exact)
+}
+
+// Shadow wraps a TopK with exact counts of every inserted key, so that the
+// estimates can be verified against their bounds while running on real
+// traffic, e.g. in staging. Memory use grows with the number of distinct
+// keys.
+type Shadow struct {
+	*TopK
+	exact map[string]int
+
+	// Panic makes Insert panic with a Violation when the returned estimate
+	// is out of bounds.
+	Panic bool
+}
+
+// NewShadow returns a Shadow around tk, which should be empty.
+func NewShadow(tk *TopK) *Shadow {
+	return &Shadow{TopK: tk, exact: make(map[string]int)}
+}
+
+// Insert inserts x into the TopK and the exact counts.
+func (s *Shadow) Insert(x string, count int) Element {
+	s.exact[x] += count
+	e := s.TopK.Insert(x, count)
+	if v, ok := s.check(e); ok && s.Panic {
+		panic(v)
+	}
+	return e
+}
+
+// Exact returns the exact count of x.
+func (s *Shadow) Exact(x string) int { return s.exact[x] }
+
+// Check verifies the estimates of all inserted keys and returns the ones
+// out of bounds, i.e. whose Count is below the exact count or whose
+// Count-Error is above it.
+func (s *Shadow) Check() []Violation {
+	var res []Violation
+	for k := range s.exact {
+		if v, ok := s.check(s.Estimate(k)); ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func (s *Shadow) check(e Element) (Violation, bool) {
+	return checkBounds(e, s.exact[e.Key])
+}
+
+// Report evaluates the top k elements against the exact counts.
+func (s *Shadow) Report(k int) *AccuracyReport {
+	return EvaluateSketch(s.TopK, s.exact, k)
+}
+
+// Clear resets the TopK and the exact counts.
+func (s *Shadow) Clear() {
+	s.TopK.Clear()
+	clear(s.exact)
+}
@@ -0,0 +1,112 @@
+package topk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// ShardedStream spreads keys over P independently locked TopKs by hash, so
+// concurrent inserts of different keys rarely contend for the same lock.
+// Every key is counted by exactly one shard, so the shards don't have to be
+// merged: Keys combines the top k of every shard. It is safe for concurrent
+// use.
+type ShardedStream struct {
+	k      int
+	shards []shard
+}
+
+// cacheLine is the cache line size shards are padded to.
+const cacheLine = 64
+
+type shard struct {
+	shardState
+	_ [cacheLine - unsafe.Sizeof(shardState{})%cacheLine]byte // keep shards on separate cache lines
+}
+
+type shardState struct {
+	mu sync.Mutex
+	t  *TopK
+}
+
+// NewSharded returns a ShardedStream of p shards, each a New(k), reporting
+// the top k elements.
+func NewSharded(k, p int) *ShardedStream {
+	s := &ShardedStream{k: k, shards: make([]shard, p)}
+	for i := range s.shards {
+		s.shards[i].t = New(k)
+	}
+	return s
+}
+
+// shard returns the shard counting x. It uses the upper half of the hash,
+// the shards use the lower half to pick alpha cells.
+func (s *ShardedStream) shard(x string) *shard {
+	h := defaultHash.sum(x, 0) >> 32
+	return &s.shards[h*uint64(len(s.shards))>>32]
+}
+
+// Insert ...
+func (s *ShardedStream) Insert(x string, count int) Element {
+	sh := s.shard(x)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.t.Insert(x, count)
+}
+
+// Estimate ...
+func (s *ShardedStream) Estimate(x string) Element {
+	sh := s.shard(x)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.t.Estimate(x)
+}
+
+// Keys returns the top k elements over all shards.
+func (s *ShardedStream) Keys() []Element {
+	var elts []Element
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		elts = append(elts, sh.t.Keys()...)
+		sh.mu.Unlock()
+	}
+	sort.Sort(elementsByCountDescending(elts))
+	if len(elts) > s.k {
+		elts = elts[:s.k]
+	}
+	return elts
+}
+
+// Count returns the total count over all shards.
+func (s *ShardedStream) Count() int64 {
+	var c int64
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		c += sh.t.Count()
+		sh.mu.Unlock()
+	}
+	return c
+}
+
+// Merge merges other shard by shard. Both must have the same number of
+// shards, and other must not be modified concurrently.
+func (s *ShardedStream) Merge(other *ShardedStream) error {
+	if len(s.shards) != len(other.shards) {
+		return fmt.Errorf("expected %d shards, got %d", len(s.shards), len(other.shards))
+	}
+	for i := range s.shards {
+		sh, o := &s.shards[i], &other.shards[i]
+		o.mu.Lock()
+		sh.mu.Lock()
+		err := sh.t.Merge(o.t)
+		sh.mu.Unlock()
+		o.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package topk
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedStream(t *testing.T) {
+	s := NewSharded(10, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				s.Insert(fmt.Sprintf("key-%d", j), j+1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []Element{
+		{Key: "key-9", Count: 80},
+		{Key: "key-8", Count: 72},
+		{Key: "key-7", Count: 64},
+	}, s.Keys()[:3])
+	assert.Equal(t, Element{Key: "key-9", Count: 80}, s.Estimate("key-9"))
+	assert.Equal(t, int64(8*55), s.Count())
+
+	other := NewSharded(10, 4)
+	other.Insert("key-0", 1000)
+	require.NoError(t, s.Merge(other))
+	assert.Equal(t, "key-0", s.Keys()[0].Key)
+
+	assert.Error(t, s.Merge(NewSharded(10, 2)))
+
+	// shards fill whole cache lines
+	assert.Zero(t, unsafe.Sizeof(shard{})%cacheLine)
+}
+
+func BenchmarkShardedInsert(b *testing.B) {
+	words := loadWords()
+	s := NewSharded(10, 16)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.Insert(words[i%len(words)], 1)
+			i++
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package topk
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Sink receives the results of finalized windows.
+type Sink interface {
+	EmitWindow(w Window) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(w Window) error
+
+// EmitWindow calls f(w).
+func (f SinkFunc) EmitWindow(w Window) error { return f(w) }
+
+// ChanSink sends windows to a channel, blocking until they are received.
+type ChanSink chan<- Window
+
+// EmitWindow ...
+func (c ChanSink) EmitWindow(w Window) error {
+	c <- w
+	return nil
+}
+
+// JSONSink writes windows to W as JSON, one per line, e.g. to a file.
+type JSONSink struct {
+	W io.Writer
+}
+
+// EmitWindow ...
+func (s JSONSink) EmitWindow(w Window) error {
+	return json.NewEncoder(s.W).Encode(w)
+}
@@ -0,0 +1,63 @@
+package topk
+
+import "unsafe"
+
+// SizeBytes estimates the memory held by s: the Stream itself, its alphas,
+// its monitored elements with their keys and index, and the state of the
+// enabled options, e.g. to budget how many sketches a process keeps
+// resident. Maps are estimated from their number of entries, as their
+// capacity isn't known; keys shared between the monitored elements and
+// other maps are counted once.
+func (s *Stream) SizeBytes() int {
+	const (
+		intSize    = int(unsafe.Sizeof(0))
+		stringSize = int(unsafe.Sizeof(""))
+	)
+	size := int(unsafe.Sizeof(*s))
+	size += cap(s.alphas) * 8
+	size += cap(s.k.elts) * int(unsafe.Sizeof(Element{}))
+	for _, e := range s.k.elts {
+		size += len(e.Key)
+	}
+	size += mapSize(len(s.k.m), stringSize+intSize)
+	size += mapSize(len(s.touched), stringSize+8)
+	size += cap(s.pipeline) * int(unsafe.Sizeof(Stage(nil)))
+	if s.quota != nil {
+		size += int(unsafe.Sizeof(*s.quota)) + mapSize(len(s.quota.used), stringSize+intSize)
+		for source := range s.quota.used {
+			size += len(source)
+		}
+	}
+	if s.overload != nil {
+		size += int(unsafe.Sizeof(*s.overload)) + mapSize(len(s.overload.classes), intSize+intSize)
+		size += len(s.overload.classes) * int(unsafe.Sizeof(classCount{}))
+	}
+	if s.emerging != nil {
+		size += int(unsafe.Sizeof(*s.emerging)) + s.emerging.SizeBytes()
+	}
+	if s.audit != nil {
+		size += int(unsafe.Sizeof(*s.audit))
+	}
+	if s.overflow != nil {
+		size += int(unsafe.Sizeof(*s.overflow))
+	}
+	if s.adapt != nil {
+		size += int(unsafe.Sizeof(*s.adapt)) + mapSize(len(s.adapt.hit), stringSize)
+	}
+	if s.promote != nil {
+		size += int(unsafe.Sizeof(*s.promote)) + mapSize(len(s.promote.top), stringSize)
+	}
+	return size
+}
+
+// SizeBytes estimates the memory held by t. See Stream.SizeBytes.
+func (t *TopK) SizeBytes() int {
+	return int(unsafe.Sizeof(*t)) + t.Stream.SizeBytes()
+}
+
+// mapSize estimates the memory of a map of n entries of entry bytes each:
+// a control byte per slot, and slots filled to at most 7/8.
+func mapSize(n, entry int) int {
+	const header = 48
+	return header + n*(entry+1)*8/7
+}
@@ -0,0 +1,56 @@
+package topk
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeBytes(t *testing.T) {
+	tk := New(100)
+	empty := tk.SizeBytes()
+	assert.Greater(t, empty, len(tk.alphas)*8/2)
+	for i := 0; i < 1000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i), 1)
+	}
+	full := tk.SizeBytes()
+	assert.Greater(t, full, empty)
+
+	// longer keys take more space
+	long := New(100)
+	for i := 0; i < 1000; i++ {
+		long.Insert(fmt.Sprintf("%s-%d", strings.Repeat("x", 100), i), 1)
+	}
+	assert.Greater(t, long.SizeBytes(), full+100*len(tk.Stream.k.elts)/2)
+
+	// options add their state
+	tk.EnableEmerging(10)
+	assert.Greater(t, tk.SizeBytes(), full)
+}
+
+func TestSizeBytesHeap(t *testing.T) {
+	const sketches = 20
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	tks := make([]*TopK, sketches)
+	for i := range tks {
+		tks[i] = New(1000)
+		for j := 0; j < 10000; j++ {
+			tks[i].Insert(fmt.Sprintf("key-%d-%d", i, j%3000), 1)
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	var estimated int
+	for _, tk := range tks {
+		estimated += tk.SizeBytes()
+	}
+	heap := int(after.HeapAlloc) - int(before.HeapAlloc)
+	assert.InEpsilon(t, heap, estimated, 0.5, "estimated %d, heap %d", estimated, heap)
+	runtime.KeepAlive(tks)
+}
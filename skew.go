@@ -0,0 +1,50 @@
+package topk
+
+import (
+	"math"
+	"sort"
+)
+
+// ZipfSkew estimates the exponent of the Zipf distribution best fitting the
+// monitored elements: the slope of log(count) against log(rank), fitted by
+// least squares. Only the upper half of the ranks is used, since the counts
+// of the lower ones are mostly error. It is 0 with fewer than 3 elements to
+// fit.
+func (s *Stream) ZipfSkew() float64 {
+	elts := append([]Element(nil), s.k.elts...)
+	sort.Sort(elementsByCountDescending(elts))
+	elts = elts[:len(elts)/2]
+	if len(elts) < 3 {
+		return 0
+	}
+
+	var sx, sy, sxx, sxy float64
+	for i, e := range elts {
+		x, y := math.Log(float64(i+1)), math.Log(float64(max(e.Count, 1)))
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	n := float64(len(elts))
+	slope := (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	return max(-slope, 0)
+}
+
+// PredictedEpsilon returns the error of the estimates, relative to the total
+// count, that the size of s guarantees for a Zipf distribution with the skew
+// estimated by ZipfSkew. Following Metwally et al., monitoring m elements
+// bounds the error to N/m for any distribution and to N/m^z for a skew z
+// above 1. The filter of alphas usually does better; comparing the result
+// with the error that can be tolerated shows the headroom left before
+// accuracy degrades, e.g. when the distribution flattens.
+func (s *Stream) PredictedEpsilon() float64 {
+	return predictedEpsilon(s.n, s.ZipfSkew())
+}
+
+func predictedEpsilon(m int, z float64) float64 {
+	if m <= 0 {
+		return 1
+	}
+	return math.Pow(float64(m), -max(z, 1))
+}
@@ -0,0 +1,33 @@
+package topk
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipfSkew(t *testing.T) {
+	for _, z := range []float64{1.2, 1.5, 2} {
+		r := rand.New(rand.NewPCG(1, 2))
+		zipf := rand.NewZipf(r, z, 1, 100000)
+		tk := New(50)
+		exact := make(map[string]int)
+		for i := 0; i < 200000; i++ {
+			k := fmt.Sprint(zipf.Uint64())
+			tk.Insert(k, 1)
+			exact[k]++
+		}
+		assert.InDelta(t, z, tk.ZipfSkew(), 0.25, "skew %v", z)
+
+		// the prediction bounds the actual error
+		eps := tk.PredictedEpsilon()
+		for _, e := range tk.Keys() {
+			assert.LessOrEqual(t, float64(e.Count-int64(exact[e.Key])), eps*float64(tk.Count()), "skew %v: %v", z, e)
+		}
+	}
+
+	assert.Zero(t, newStream(10).ZipfSkew())
+	assert.Equal(t, 0.1, newStream(10).PredictedEpsilon())
+}
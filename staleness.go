@@ -0,0 +1,115 @@
+package topk
+
+import "time"
+
+// Staleness tells how current a sketch is. Times are zero when unknown.
+type Staleness struct {
+	// FirstInsert and LastInsert are the times of the first and the last
+	// insert covered by the sketch, including merged sketches.
+	FirstInsert, LastInsert time.Time
+	// Snapshot is when the snapshot the sketch was decoded from was taken.
+	Snapshot time.Time
+}
+
+// Age returns how long before now the sketch was last updated, or 0 if that
+// is unknown. A growing Age with steady traffic means the ingester is stuck.
+func (s Staleness) Age(now time.Time) time.Duration {
+	last := s.LastInsert
+	if last.IsZero() {
+		last = s.Snapshot
+	}
+	if last.IsZero() {
+		return 0
+	}
+	return now.Sub(last)
+}
+
+// SetClock enables recording the time of inserts using now, usually
+// time.Now, and stamping snapshots with the time they are taken. The times
+// are kept in snapshots and reported by Staleness. A nil clock disables
+// recording but keeps the times recorded so far. Note that with a clock,
+// the output of EncodeDeterministic changes with every snapshot.
+func (s *Stream) SetClock(now func() time.Time) {
+	s.clock = now
+}
+
+// Staleness returns the recorded insert and snapshot times.
+func (s *Stream) Staleness() Staleness {
+	return Staleness{
+		FirstInsert: unixTime(s.first),
+		LastInsert:  unixTime(s.last),
+		Snapshot:    unixTime(s.stamped),
+	}
+}
+
+// touch records an insert of x at the current time.
+func (s *Stream) touch(x string) {
+	now := s.clock().UnixNano()
+	if s.first == 0 {
+		s.first = now
+	}
+	s.last = now
+
+	if _, ok := s.k.m[x]; !ok {
+		return
+	}
+	if s.touched == nil {
+		s.touched = make(map[string]int64, s.n)
+	}
+	s.touched[x] = now
+	if len(s.touched) > 2*s.n {
+		// drop evicted keys
+		for k := range s.touched {
+			if _, ok := s.k.m[k]; !ok {
+				delete(s.touched, k)
+			}
+		}
+	}
+}
+
+// Compact removes the monitored elements that have not been updated for
+// maxIdle, like ForgetFunc, to make room for current traffic faster than
+// eviction would. It returns the number of removed elements. Update times
+// are only recorded with a clock (see SetClock), without one Compact does
+// nothing. Elements whose update time is unknown, e.g. after Decode or
+// Merge, are considered updated at the first Compact that sees them.
+func (s *Stream) Compact(maxIdle time.Duration) int {
+	if s.clock == nil {
+		return 0
+	}
+	now := s.clock().UnixNano()
+	if s.touched == nil {
+		s.touched = make(map[string]int64, s.n)
+	}
+	removed := s.ForgetFunc(func(e Element) bool {
+		t, ok := s.touched[e.Key]
+		if !ok {
+			s.touched[e.Key] = now
+			return false
+		}
+		return now-t > int64(maxIdle)
+	})
+	for k := range s.touched {
+		if _, ok := s.k.m[k]; !ok {
+			delete(s.touched, k)
+		}
+	}
+	return removed
+}
+
+// cover extends the covered interval of s by that of other.
+func (s *Stream) cover(other *Stream) {
+	if other.first != 0 && (s.first == 0 || other.first < s.first) {
+		s.first = other.first
+	}
+	if other.last > s.last {
+		s.last = other.last
+	}
+}
+
+func unixTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,82 @@
+package topk
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaleness(t *testing.T) {
+	base := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := base
+	clock := func() time.Time { return now }
+
+	tk := New(5)
+	assert.Equal(t, Staleness{}, tk.Staleness())
+	assert.Equal(t, time.Duration(0), tk.Staleness().Age(now))
+
+	tk.SetClock(clock)
+	tk.Insert("a", 1)
+	now = now.Add(time.Minute)
+	tk.Insert("b", 1)
+
+	st := tk.Staleness()
+	assert.True(t, base.Equal(st.FirstInsert))
+	assert.True(t, base.Add(time.Minute).Equal(st.LastInsert))
+	assert.Equal(t, time.Hour, st.Age(base.Add(time.Hour+time.Minute)))
+
+	// snapshots carry the times and are stamped
+	now = now.Add(time.Minute)
+	var buf bytes.Buffer
+	require.NoError(t, tk.Encode(&buf))
+	var got TopK
+	require.NoError(t, got.Decode(&buf))
+	assert.Equal(t, st.FirstInsert, got.Staleness().FirstInsert)
+	assert.Equal(t, st.LastInsert, got.Staleness().LastInsert)
+	assert.True(t, now.Equal(got.Staleness().Snapshot))
+	assert.Equal(t, tk.Keys(), got.Keys())
+
+	// merging covers both sketches
+	other := New(5)
+	other.SetClock(func() time.Time { return base.Add(-time.Hour) })
+	other.Insert("c", 1)
+	require.NoError(t, got.Merge(other))
+	assert.True(t, base.Add(-time.Hour).Equal(got.Staleness().FirstInsert))
+	assert.True(t, base.Add(time.Minute).Equal(got.Staleness().LastInsert))
+
+	got.Clear()
+	assert.Equal(t, Staleness{}, got.Staleness())
+}
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tk := NewWithScaleFactor(3, 1)
+	assert.Equal(t, 0, tk.Compact(time.Minute))
+
+	tk.SetClock(func() time.Time { return now })
+	tk.Insert("old", 100)
+	tk.Insert("older", 200)
+	now = now.Add(30 * time.Second)
+	tk.Insert("older", 1)
+	now = now.Add(time.Hour)
+	tk.Insert("new", 5)
+
+	assert.Equal(t, 2, tk.Compact(time.Minute))
+	assert.Equal(t, []Element{{Key: "new", Count: 5}}, tk.Keys())
+
+	// the counts are folded into the alphas, so estimates stay upper bounds
+	assert.GreaterOrEqual(t, tk.Estimate("old").Count, int64(100))
+	assert.GreaterOrEqual(t, tk.Estimate("older").Count, int64(201))
+
+	// unknown update times get a grace period
+	var buf bytes.Buffer
+	require.NoError(t, tk.Encode(&buf))
+	require.NoError(t, tk.Decode(&buf))
+	assert.Equal(t, 0, tk.Compact(time.Minute))
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 1, tk.Compact(time.Minute))
+	assert.Empty(t, tk.Keys())
+}
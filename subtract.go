@@ -0,0 +1,40 @@
+package topk
+
+import "fmt"
+
+// Subtract removes the counts of other from s, e.g. to get the top keys of
+// the last hour as a cumulative sketch minus its snapshot from an hour ago.
+// other must use the same hash. The estimate of each monitored element of s
+// is reduced by the guaranteed count of other, and its error grows by the
+// error of other, so that it bounds the difference of the true counts;
+// counts don't go below 0. The alphas of s are kept, as they still bound
+// the counts of unmonitored keys. other is not modified.
+func (s *Stream) Subtract(other *Stream) error {
+	if s.hash != other.hash {
+		return fmt.Errorf("expected stream hashed with %v, got %v", s.hash, other.hash)
+	}
+	if s.seed != other.seed {
+		return fmt.Errorf("expected stream with hash seed %d, got %d", s.seed, other.seed)
+	}
+
+	for i, e := range s.k.elts {
+		o := other.Estimate(e.Key)
+		lo := max(e.Count-e.Error-o.Count, 0)
+		e.Count = max(e.Count-(o.Count-o.Error), 0)
+		e.Error = e.Count - lo
+		s.k.elts[i] = e
+	}
+	s.k.init()
+	s.c = max(s.c-other.c, 0)
+	return nil
+}
+
+// Subtract removes the counts of other from t, see Stream.Subtract. TopKs
+// decaying with SetHalfLife can only be subtracted with the same half-life,
+// and are decayed to the same time first, as in Merge.
+func (t *TopK) Subtract(other *TopK) error {
+	if t.halfLife != other.halfLife {
+		return ErrDecayMismatch
+	}
+	return t.Stream.Subtract(t.alignDecay(other))
+}
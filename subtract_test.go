@@ -0,0 +1,53 @@
+package topk
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubtract(t *testing.T) {
+	tk := New(10)
+	for i := 0; i < 10000; i++ {
+		tk.Insert(fmt.Sprintf("old-%d", i%20), 1)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, tk.Encode(&buf))
+	prev := New(10)
+	assert.NoError(t, prev.Decode(&buf))
+
+	exact := make(map[string]int)
+	for i := 0; i < 5000; i++ {
+		x := fmt.Sprintf("new-%d", i%7)
+		if i%5 == 0 {
+			x = fmt.Sprintf("old-%d", i%20)
+		}
+		tk.Insert(x, 1)
+		exact[x]++
+	}
+	assert.NoError(t, tk.Subtract(prev))
+	assert.Equal(t, int64(5000), tk.Count())
+
+	r := EvaluateSketch(tk, exact, 7)
+	assert.Empty(t, r.Violations)
+	assert.Equal(t, 1.0, r.Recall)
+
+	// subtracting a sketch from itself leaves nothing guaranteed
+	assert.NoError(t, prev.Subtract(prev))
+	for _, e := range prev.Keys() {
+		assert.Zero(t, e.Count-e.Error, e.Key)
+	}
+	assert.Zero(t, prev.Count())
+}
+
+func TestSubtractMismatch(t *testing.T) {
+	tk := New(10)
+	assert.Error(t, tk.Subtract(New(10, WithSeed(1))))
+
+	decaying := New(10)
+	decaying.SetHalfLife(time.Hour)
+	assert.ErrorIs(t, tk.Subtract(decaying), ErrDecayMismatch)
+}
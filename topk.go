@@ -18,20 +18,21 @@ Licensed under the MIT license.
 package topk
 
 import (
-	"container/heap"
+	"context"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 	"sort"
-
-	"github.com/dgryski/go-metro"
-	"github.com/tinylib/msgp/msgp"
+	"time"
+	"unsafe"
 )
 
 // Element is a TopK item
 type Element struct {
 	Key   string `json:"key"`
-	Count int    `json:"count"`
-	Error int    `json:"error"`
+	Count int64  `json:"count"`
+	Error int64  `json:"error"`
 }
 
 type elementsByCountDescending []Element
@@ -47,37 +48,80 @@ type keys struct {
 	elts []Element
 }
 
-func (tk *keys) EncodeMsgp(w *msgp.Writer) error {
+// elementsInHeapOrder sorts ascending by the heap ordering, breaking ties on
+// the key. A slice sorted this way is itself a valid heap.
+type elementsInHeapOrder []Element
+
+func (elts elementsInHeapOrder) Len() int { return len(elts) }
+func (elts elementsInHeapOrder) Less(i, j int) bool {
+	if elts[i].Count != elts[j].Count {
+		return elts[i].Count < elts[j].Count
+	}
+	if elts[i].Error != elts[j].Error {
+		return elts[i].Error > elts[j].Error
+	}
+	return elts[i].Key < elts[j].Key
+}
+func (elts elementsInHeapOrder) Swap(i, j int) { elts[i], elts[j] = elts[j], elts[i] }
+
+// encode writes the heap. If canonical is set, the elements are written
+// in heap order with the index map sorted by key, so that the output only
+// depends on the set of monitored elements and not on the insertion history.
+func (tk *keys) encode(w encoder, canonical bool) error {
+	elts := tk.elts
+	if canonical {
+		elts = append([]Element(nil), tk.elts...)
+		sort.Sort(elementsInHeapOrder(elts))
+	}
+
 	if err := w.WriteMapHeader(uint32(len(tk.m))); err != nil {
 		return err
 	}
-	for k, v := range tk.m {
-		if err := w.WriteString(k); err != nil {
-			return err
+	if canonical {
+		// elts is sorted by count, so the positions have to be looked up
+		// in key order separately
+		idx := make([]int, len(elts))
+		for i := range idx {
+			idx[i] = i
 		}
-		if err := w.WriteInt(v); err != nil {
-			return err
+		sort.Slice(idx, func(i, j int) bool { return elts[idx[i]].Key < elts[idx[j]].Key })
+		for _, i := range idx {
+			if err := w.WriteString(elts[i].Key); err != nil {
+				return err
+			}
+			if err := w.WriteInt(i); err != nil {
+				return err
+			}
+		}
+	} else {
+		for k, v := range tk.m {
+			if err := w.WriteString(k); err != nil {
+				return err
+			}
+			if err := w.WriteInt(v); err != nil {
+				return err
+			}
 		}
 	}
 
-	if err := w.WriteArrayHeader(uint32(len(tk.elts))); err != nil {
+	if err := w.WriteArrayHeader(uint32(len(elts))); err != nil {
 		return err
 	}
-	for _, e := range tk.elts {
+	for _, e := range elts {
 		if err := w.WriteString(e.Key); err != nil {
 			return err
 		}
-		if err := w.WriteInt(e.Count); err != nil {
+		if err := w.WriteInt64(e.Count); err != nil {
 			return err
 		}
-		if err := w.WriteInt(e.Error); err != nil {
+		if err := w.WriteInt64(e.Error); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (tk *keys) DecodeMsp(r *msgp.Reader) error {
+func (tk *keys) decode(r decoder) error {
 	var (
 		err error
 		sz  uint32
@@ -86,8 +130,11 @@ func (tk *keys) DecodeMsp(r *msgp.Reader) error {
 	if sz, err = r.ReadMapHeader(); err != nil {
 		return err
 	}
+	if sz > maxDecodeMonitored {
+		return fmt.Errorf("%w: %d monitored elements", ErrCorruptSnapshot, sz)
+	}
 
-	tk.m = make(map[string]int, sz)
+	tk.m = make(map[string]int, min(sz, decodePrealloc))
 
 	for i := uint32(0); i < sz; i++ {
 		key, err := r.ReadString()
@@ -104,55 +151,134 @@ func (tk *keys) DecodeMsp(r *msgp.Reader) error {
 	if sz, err = r.ReadArrayHeader(); err != nil {
 		return err
 	}
+	if sz != uint32(len(tk.m)) {
+		return fmt.Errorf("%w: %d elements for %d indexed keys", ErrCorruptSnapshot, sz, len(tk.m))
+	}
 
-	tk.elts = make([]Element, sz)
-	for i := range tk.elts {
-		if tk.elts[i].Key, err = r.ReadString(); err != nil {
+	tk.elts = make([]Element, 0, min(sz, decodePrealloc))
+	for i := uint32(0); i < sz; i++ {
+		var e Element
+		if e.Key, err = r.ReadString(); err != nil {
 			return err
 		}
-		if tk.elts[i].Count, err = r.ReadInt(); err != nil {
+		if e.Count, err = r.ReadInt64(); err != nil {
 			return err
 		}
-		if tk.elts[i].Error, err = r.ReadInt(); err != nil {
+		if e.Error, err = r.ReadInt64(); err != nil {
 			return err
 		}
+		tk.elts = append(tk.elts, e)
+		if e.Error < 0 || e.Count < e.Error {
+			return fmt.Errorf("%w: element %q with count %d and error %d", ErrCorruptSnapshot, e.Key, e.Count, e.Error)
+		}
+		if tk.m[e.Key] != int(i) {
+			return fmt.Errorf("%w: element %q is not indexed at %d", ErrCorruptSnapshot, e.Key, i)
+		}
 	}
 
+	// a valid heap is left as is, the order of anything else is restored
+	tk.init()
 	return nil
 }
 
-// Implement the container/heap interface
-
-// Len ...
-func (tk *keys) Len() int { return len(tk.elts) }
+// The heap is a min-heap of the elements by lessInHeap, maintained like
+// container/heap does, but typed to avoid boxing every Element in an
+// interface. Elements are moved into the hole instead of swapped, so each
+// level costs a single index update.
 
-// Less ...
-func (tk *keys) Less(i, j int) bool {
-	return (tk.elts[i].Count < tk.elts[j].Count) || (tk.elts[i].Count == tk.elts[j].Count && tk.elts[i].Error > tk.elts[j].Error)
+func lessInHeap(a, b Element) bool {
+	return (a.Count < b.Count) || (a.Count == b.Count && a.Error > b.Error)
 }
-func (tk *keys) Swap(i, j int) {
 
-	tk.elts[i], tk.elts[j] = tk.elts[j], tk.elts[i]
-
-	tk.m[tk.elts[i].Key] = i
-	tk.m[tk.elts[j].Key] = j
+// init establishes the heap order of all elements.
+func (tk *keys) init() {
+	for i := len(tk.elts)/2 - 1; i >= 0; i-- {
+		tk.down(i)
+	}
 }
 
-func (tk *keys) Push(x interface{}) {
-	e := x.(Element)
-	tk.m[e.Key] = len(tk.elts)
+// push adds e to the heap.
+func (tk *keys) push(e Element) {
 	tk.elts = append(tk.elts, e)
+	tk.m[e.Key] = len(tk.elts) - 1
+	tk.up(len(tk.elts) - 1)
 }
 
-func (tk *keys) Pop() interface{} {
-	var e Element
-	e, tk.elts = tk.elts[len(tk.elts)-1], tk.elts[:len(tk.elts)-1]
+// pop removes and returns the minimum element.
+func (tk *keys) pop() Element {
+	return tk.remove(0)
+}
 
+// remove removes and returns the element at i.
+func (tk *keys) remove(i int) Element {
+	e, last := tk.elts[i], len(tk.elts)-1
+	if i != last {
+		tk.elts[i] = tk.elts[last]
+		tk.m[tk.elts[i].Key] = i
+	}
+	tk.elts[last] = Element{}
+	tk.elts = tk.elts[:last]
 	delete(tk.m, e.Key)
-
+	if i != last {
+		tk.fix(i)
+	}
 	return e
 }
 
+// fix restores the heap after the element at i changed.
+func (tk *keys) fix(i int) {
+	if !tk.down(i) {
+		tk.up(i)
+	}
+}
+
+// up moves the element at i up to its place.
+func (tk *keys) up(i int) {
+	e := tk.elts[i]
+	moved := false
+	for i > 0 {
+		p := (i - 1) / 2
+		if !lessInHeap(e, tk.elts[p]) {
+			break
+		}
+		tk.elts[i] = tk.elts[p]
+		tk.m[tk.elts[i].Key] = i
+		i, moved = p, true
+	}
+	if moved {
+		tk.elts[i] = e
+		tk.m[e.Key] = i
+	}
+}
+
+// down moves the element at i down to its place, e.g. after its count
+// increased, and reports whether it moved.
+func (tk *keys) down(i int) bool {
+	e := tk.elts[i]
+	n := len(tk.elts)
+	moved := false
+	for {
+		c := 2*i + 1
+		if c >= n || c < 0 { // c < 0 after int overflow
+			break
+		}
+		if r := c + 1; r < n && lessInHeap(tk.elts[r], tk.elts[c]) {
+			c = r
+		}
+		if !lessInHeap(tk.elts[c], e) {
+			break
+		}
+		tk.elts[i] = tk.elts[c]
+		tk.m[tk.elts[i].Key] = i
+		i, moved = c, true
+	}
+	if moved {
+		tk.elts[i] = e
+		tk.m[e.Key] = i
+	}
+	return moved
+}
+
 func (tk *keys) Clear() {
 	clear(tk.m)
 	tk.elts = tk.elts[:0]
@@ -161,16 +287,100 @@ func (tk *keys) Clear() {
 // Stream calculates the TopK elements for a stream
 type Stream struct {
 	n      int
+	hash   hashID
+	hasher func(string) uint64 // for hashCustom
+	seed   uint64
 	k      keys
-	alphas []int
+	alphas []int64
+	c      int64 // c keeps track of the total count inserted
+
+	// unix nanoseconds, see Staleness
+	first, last, stamped int64
+	// last update of monitored keys, see Compact
+	touched map[string]int64
+
+	transform Transformer
+	redact    func(string) string
+	pipeline  []Stage
+	quota     *sourceQuota
+	overload  *overload
+	emerging  *emerging
+	audit     *audit
+	evict     EvictionPolicy
+	ties      TieBreak
+	unit      float64 // weight of a count, see InsertWeighted; 0 is 1
+	agg       func(old, delta int64) int64
+	overflow  *overflow
+	adapt     *adaptive
+	promote   *promote
+	strict    bool
+	saturated bool
+	labels    bool
+	clock     func() time.Time
+}
+
+// EvictionPolicy decides what is recorded in the alpha cell of an element
+// that is evicted from the monitored set.
+type EvictionPolicy int
+
+const (
+	// EvictOverwrite sets the alpha cell to the count of the evicted
+	// element, as in the paper. This can lower the alpha of a colliding key.
+	EvictOverwrite EvictionPolicy = iota
+	// EvictMax keeps the larger of the alpha cell and the evicted count.
+	// Alphas then never decrease, which guarantees that Estimate(x).Count
+	// never decreases for any x as long as the Stream is only inserted into
+	// and merged.
+	EvictMax
+	// EvictGuaranteed sets the alpha cell to the guaranteed count
+	// (Count-Error) of the evicted element. This keeps estimates of new
+	// elements lower, at the cost of the upper-bound guarantee: an evicted
+	// element's true count can exceed its alpha cell by up to its Error, so
+	// Estimate(x).Count is no longer an upper bound for keys that are not
+	// monitored, and neither are the counts of elements admitted later.
+	// GuaranteedKeys, the bounds checked by Shadow and topktest, and other
+	// results relying on upper bounds give no guarantees under this policy.
+	EvictGuaranteed
+)
+
+func (p EvictionPolicy) alpha(old int64, e Element) int64 {
+	switch p {
+	case EvictMax:
+		return max(old, e.Count)
+	case EvictGuaranteed:
+		return e.Count - e.Error
+	default:
+		return e.Count
+	}
+}
+
+// SetEvictionPolicy sets the EvictionPolicy, EvictOverwrite by default. See
+// EvictGuaranteed for the bounds it gives up.
+func (s *Stream) SetEvictionPolicy(p EvictionPolicy) {
+	s.evict = p
 }
 
 // New returns a Stream estimating the top n most frequent elements
 func newStream(n int) *Stream {
+	return newStreamWithAlphas(n, n*defaultBufMultiplier)
+}
+
+// defaultBufMultiplier is the number of alphas per monitored element, the
+// multiplicative constant from the paper. Each alpha costs 8 bytes, while each
+// monitored element costs a key, a map entry and a heap slot, so the filter is
+// usually the cheaper half of the sketch. Unmonitored keys share a cell with
+// about len(distinct keys)/len(alphas) others, so the error of their
+// estimates shrinks roughly linearly with the multiplier; a larger filter also
+// keeps noise from evicting frequent keys. The guarantees of monitored
+// elements hold for any size. See TestBufferMultiplierAccuracy.
+const defaultBufMultiplier = 6
+
+func newStreamWithAlphas(n, m int) *Stream {
 	return &Stream{
 		n:      n,
+		hash:   defaultHash,
 		k:      keys{m: make(map[string]int, n), elts: make([]Element, 0, n)},
-		alphas: make([]int, n*6), // 6 is the multiplicative constant from the paper
+		alphas: make([]int64, m),
 	}
 }
 
@@ -180,46 +390,89 @@ func reduce(x uint64, n int) uint32 {
 
 // Insert adds an element to the stream to be tracked
 // It returns an estimation for the just inserted element
+// A negative count is removed, see Remove.
 func (s *Stream) Insert(x string, count int) Element {
+	return s.InsertHashed(x, s.sum(x), count)
+}
 
-	xhash := reduce(metro.Hash64Str(x, 0), len(s.alphas))
+// InsertHashed is like Insert, with the hash of x computed by the caller,
+// e.g. when it is also used to route x to a shard. h must be Hash(x);
+// another hash makes the estimates of x and colliding keys meaningless.
+func (s *Stream) InsertHashed(x string, h uint64, count int) Element {
+	if count < 0 {
+		return s.Remove(x, -max(count, -math.MaxInt))
+	}
+	delta := int64(count)
+	s.c = s.add(s.c, delta)
+	if s.clock != nil {
+		defer s.touch(x)
+	}
+	if s.promote != nil {
+		_, monitored := s.k.m[x]
+		defer s.promote.check(s, x, monitored)
+	}
+	if s.adapt != nil {
+		s.adaptInsert(x)
+	}
+
+	if s.audit != nil {
+		s.audit.sample(x, count, h)
+	}
+	xhash := reduce(h, len(s.alphas))
 
 	// are we tracking this element?
 	if idx, ok := s.k.m[x]; ok {
-		s.k.elts[idx].Count += count
+		s.k.elts[idx].Count = s.aggregate(s.k.elts[idx].Count, delta)
 		e := s.k.elts[idx]
-		heap.Fix(&s.k, idx)
+		s.k.down(idx)
 		return e
 	}
 
 	// can we track more elements?
 	if len(s.k.elts) < s.n {
-		// there is free space
-		e := Element{Key: x, Count: count}
-		heap.Push(&s.k, e)
+		// there is free space, but keys may have been forgotten or dropped
+		// by a merge, so the filter still applies
+		e := Element{
+			Key:   x,
+			Error: s.alphas[xhash],
+			Count: s.aggregate(s.alphas[xhash], delta),
+		}
+		s.k.push(e)
 		return e
 	}
 
-	if s.alphas[xhash]+count < s.k.elts[0].Count {
+	if sum := s.aggregate(s.alphas[xhash], delta); sum < s.k.elts[0].Count {
 		e := Element{
 			Key:   x,
 			Error: s.alphas[xhash],
-			Count: s.alphas[xhash] + count,
+			Count: sum,
+		}
+		s.alphas[xhash] = sum
+		if s.emerging != nil {
+			s.emerging.insert(x, count)
 		}
-		s.alphas[xhash] += count
+		return e
+	}
+
+	if e := (Element{Key: x, Error: s.alphas[xhash], Count: s.aggregate(s.alphas[xhash], delta)}); s.spill(e) {
+		s.k.push(e)
 		return e
 	}
 
 	// replace the current minimum element
 	minElement := s.k.elts[0]
+	if s.adapt != nil {
+		s.adapt.evictions++
+		s.adapt.totalEvictions++
+	}
 
-	mkhash := reduce(metro.Hash64Str(minElement.Key, 0), len(s.alphas))
-	s.alphas[mkhash] = minElement.Count
+	mkhash := reduce(s.sum(minElement.Key), len(s.alphas))
+	s.alphas[mkhash] = s.evict.alpha(s.alphas[mkhash], minElement)
 
 	e := Element{
 		Key:   x,
 		Error: s.alphas[xhash],
-		Count: s.alphas[xhash] + count,
+		Count: s.aggregate(s.alphas[xhash], delta),
 	}
 	s.k.elts[0] = e
 
@@ -228,104 +481,528 @@ func (s *Stream) Insert(x string, count int) Element {
 	// but 'x' is as array position 0
 	s.k.m[x] = 0
 
-	heap.Fix(&s.k, 0)
+	// the root has no parent to move up to
+	s.k.down(0)
 	return e
 }
 
-// Merge ...
-func (s *Stream) Merge(other *Stream) error {
-	if s.n != other.n {
-		return fmt.Errorf("expected stream of size n %d, got %d", s.n, other.n)
+// Forget removes x from the monitored elements and reports whether it was
+// monitored. Its count is folded into its alpha cell, so that estimates for
+// x and colliding keys remain upper bounds.
+func (s *Stream) Forget(x string) bool {
+	idx, ok := s.k.m[x]
+	if !ok {
+		return false
+	}
+	e := s.k.remove(idx)
+	xhash := reduce(s.sum(x), len(s.alphas))
+	s.alphas[xhash] = max(s.alphas[xhash], e.Count)
+	return true
+}
+
+// Remove subtracts count from x, e.g. for entities that disappear again,
+// and returns the new estimate for x. Counts don't go below 0, and the
+// error of x only shrinks once its guaranteed count would. If x is not
+// monitored, nothing changes, as its estimate is an alpha cell shared with
+// other keys, which stays an upper bound. A monitored x whose count drops to
+// 0 is no longer monitored. The total count is reduced by count.
+func (s *Stream) Remove(x string, count int) Element {
+	n := int64(count)
+	s.c = max(s.c-n, 0)
+	idx, ok := s.k.m[x]
+	if !ok {
+		return s.Estimate(x)
+	}
+
+	e := s.k.elts[idx]
+	lo := max(e.Count-e.Error-n, 0)
+	e.Count = max(e.Count-n, 0)
+	e.Error = e.Count - lo
+	if e.Count == 0 {
+		s.k.remove(idx)
+		return e
+	}
+	s.k.elts[idx] = e
+	s.k.fix(idx)
+	return e
+}
+
+// Delete forgets x, see Forget, and also drops every other copy of x the
+// Stream retains: its last update time, its entry in the sketch of emerging
+// keys and in the bookkeeping of adaptive sizing. After Delete, x is no
+// longer stored anywhere in s, e.g. to honor an erasure request; snapshots
+// encoded afterwards don't contain it either. Its count remains in its alpha
+// cell, which doesn't identify it. It reports whether x was monitored.
+func (s *Stream) Delete(x string) bool {
+	delete(s.touched, x)
+	if s.adapt != nil {
+		delete(s.adapt.hit, x)
 	}
+	if s.emerging != nil {
+		s.emerging.Delete(x)
+	}
+	return s.Forget(x)
+}
 
-	// merge the elements
-	eKeys := make(map[string]struct{})
-	eMap := make(map[string]Element)
+// ForgetFunc removes all monitored elements for which pred returns true,
+// like Forget, with a single rebuild of the heap. It returns the number of
+// removed elements.
+func (s *Stream) ForgetFunc(pred func(Element) bool) int {
+	elts := s.k.elts[:0]
 	for _, e := range s.k.elts {
-		eKeys[e.Key] = struct{}{}
+		if !pred(e) {
+			elts = append(elts, e)
+			continue
+		}
+		xhash := reduce(s.sum(e.Key), len(s.alphas))
+		s.alphas[xhash] = max(s.alphas[xhash], e.Count)
+		delete(s.k.m, e.Key)
+	}
+
+	removed := len(s.k.elts) - len(elts)
+	if removed == 0 {
+		return 0
 	}
-	for _, e := range other.k.elts {
-		eKeys[e.Key] = struct{}{}
+	clear(s.k.elts[len(elts):])
+	s.k.elts = elts
+	for i, e := range s.k.elts {
+		s.k.m[e.Key] = i
 	}
+	s.k.init()
+	return removed
+}
 
-	for k := range eKeys {
-		idx1, ok1 := s.k.m[k]
-		idx2, ok2 := other.k.m[k]
-		xhash := reduce(metro.Hash64Str(k, 0), len(s.alphas))
-		min1 := s.alphas[xhash]
-		min2 := other.alphas[xhash]
+// WouldAdmit reports whether inserting count for x would make x a monitored
+// element, without modifying the Stream. If admitting x evicts another
+// element, that element is returned as displaced.
+func (s *Stream) WouldAdmit(x string, count int) (admit bool, displaced Element) {
+	idx, monitored := s.k.m[x]
+	if count < 0 {
+		// see Remove, which drops elements whose count reaches zero
+		return monitored && s.k.elts[idx].Count > int64(-max(count, -math.MaxInt)), Element{}
+	}
+	if monitored || len(s.k.elts) < s.n {
+		return true, Element{}
+	}
 
-		switch {
-		case ok1 && ok2:
-			e1 := s.k.elts[idx1]
+	xhash := reduce(s.sum(x), len(s.alphas))
+	e := Element{Key: x, Error: s.alphas[xhash]}
+	e.Count, _ = s.aggregated(s.alphas[xhash], int64(count))
+	if e.Count < s.k.elts[0].Count {
+		return false, Element{}
+	}
+	if s.spill(e) {
+		return true, Element{}
+	}
+	return true, s.k.elts[0]
+}
+
+// Merge merges other into s. other must use the same hash and may be smaller
+// than s, e.g. while a change of size is rolled out. The estimates of a
+// smaller sketch are combined like those of an equal one, but each alpha cell
+// of s receives the largest of the cells of other covering the same keys, so
+// that estimates of unmonitored keys stay upper bounds at the cost of a larger
+// error. Merging a larger sketch into s fails.
+func (s *Stream) Merge(other *Stream) error {
+	return s.MergeContext(context.Background(), other)
+}
+
+// merge merges other into s. If prov is not nil, the provenance of every
+// merged element is recorded in it.
+func (s *Stream) merge(other *Stream, prov map[string]Provenance) error {
+	if err := s.mergeable(other, len(other.alphas)); err != nil {
+		return err
+	}
+	if other == s {
+		// s is merged in place
+		other = s.Clone()
+	}
+	alphas := resampleAlphas(other.alphas, len(s.alphas))
+	if s.strict && s.mergeOverflows(other, alphas) {
+		return ErrCountOverflow
+	}
+
+	// counts saturate unless strict, see SetStrictCounts
+	var overflowed bool
+	add := func(a, b int64) int64 {
+		sum, ok := addCount(a, b)
+		overflowed = overflowed || !ok
+		return sum
+	}
+
+	// merge the elements in place: the elements of s are updated, and
+	// those only monitored by other are appended
+	for i, e1 := range s.k.elts {
+		var p Provenance
+		if idx2, ok := other.k.m[e1.Key]; ok {
 			e2 := other.k.elts[idx2]
-			eMap[k] = Element{
-				Key:   k,
-				Count: e1.Count + e2.Count,
-				Error: e1.Error + e2.Error,
+			s.k.elts[i] = Element{
+				Key:   e1.Key,
+				Count: add(e1.Count, e2.Count),
+				Error: add(e1.Error, e2.Error),
 			}
-		case ok1:
-			e1 := s.k.elts[idx1]
-			eMap[k] = Element{
-				Key:   k,
-				Count: e1.Count + min2,
-				Error: e1.Error + min2,
+			p = FromLeft | FromRight
+		} else {
+			min2 := other.alphas[reduce(s.sum(e1.Key), len(other.alphas))]
+			s.k.elts[i] = Element{
+				Key:   e1.Key,
+				Count: add(e1.Count, min2),
+				Error: add(e1.Error, min2),
 			}
-		case ok2:
-			e2 := other.k.elts[idx2]
-			eMap[k] = Element{
-				Key:   k,
-				Count: e2.Count + min1,
-				Error: e2.Error + min1,
+			p = FromLeft
+			if min2 > 0 {
+				p |= Inferred
+			}
+		}
+		if prov != nil {
+			prov[e1.Key] = p
+		}
+	}
+	for _, e2 := range other.k.elts {
+		if _, ok := s.k.m[e2.Key]; ok {
+			continue
+		}
+		min1 := s.alphas[reduce(s.sum(e2.Key), len(s.alphas))]
+		s.k.elts = append(s.k.elts, Element{
+			Key:   e2.Key,
+			Count: add(e2.Count, min1),
+			Error: add(e2.Error, min1),
+		})
+		if prov != nil {
+			p := FromRight
+			if min1 > 0 {
+				p |= Inferred
 			}
+			prov[e2.Key] = p
 		}
+	}
 
+	// modify alphas
+	for i, v := range alphas {
+		s.alphas[i] = add(s.alphas[i], v)
 	}
+	s.c = add(s.c, other.c)
+	s.saturated = s.saturated || overflowed
 
-	// sort the elements
-	elts := make([]Element, 0, len(eMap))
-	for _, v := range eMap {
-		elts = append(elts, v)
+	trimmed := s.k.settle(s)
+	s.fold(trimmed)
+	clear(trimmed)
+	s.cover(other)
+	return nil
+}
+
+// mergeOverflows reports whether merging other, with its alphas resampled
+// to the alphas of s, overflows a count. Errors are at most counts, so only
+// counts are checked.
+func (s *Stream) mergeOverflows(other *Stream, alphas []int64) bool {
+	ok := true
+	check := func(a, b int64) {
+		_, sok := addCount(a, b)
+		ok = ok && sok
 	}
-	sort.Sort(elementsByCountDescending(elts))
+	for _, e1 := range s.k.elts {
+		if idx2, found := other.k.m[e1.Key]; found {
+			check(e1.Count, other.k.elts[idx2].Count)
+		} else {
+			check(e1.Count, other.alphas[reduce(s.sum(e1.Key), len(other.alphas))])
+		}
+	}
+	for _, e2 := range other.k.elts {
+		if _, found := s.k.m[e2.Key]; !found {
+			check(e2.Count, s.alphas[reduce(s.sum(e2.Key), len(s.alphas))])
+		}
+	}
+	for i, v := range alphas {
+		check(s.alphas[i], v)
+	}
+	check(s.c, other.c)
+	return !ok
+}
 
-	// trim elements
-	if len(elts) > s.n {
-		elts = elts[:s.n]
+// mergeable checks that other, with the given number of alphas, can be
+// merged into s. A smaller Stream can be merged into a larger one, with any
+// number of alphas.
+func (s *Stream) mergeable(other *Stream, alphas int) error {
+	if other.n > s.n {
+		return fmt.Errorf("expected stream of size n at most %d, got %d", s.n, other.n)
+	}
+	if s.hash != other.hash {
+		return fmt.Errorf("expected stream hashed with %v, got %v", s.hash, other.hash)
+	}
+	if s.seed != other.seed {
+		return fmt.Errorf("expected stream with hash seed %d, got %d", s.seed, other.seed)
 	}
+	if other.n == s.n && len(s.alphas) != alphas {
+		return fmt.Errorf("expected stream with %d alphas, got %d", len(s.alphas), alphas)
+	}
+	return nil
+}
 
-	// create heap
+// resampleAlphas returns alphas mapped to m cells. Keys are mapped to cells
+// by reduce, which preserves the order of hashes, so each of the m cells
+// covers a contiguous range of the original cells and gets their maximum.
+// The result stays an upper bound for every key of the cell, but is looser
+// than the original alphas when m is larger.
+func resampleAlphas(alphas []int64, m int) []int64 {
+	if len(alphas) == m {
+		return alphas
+	}
+	res := make([]int64, m)
+	for i := range res {
+		// the hashes covered by cell i are [lo, hi]
+		lo := (uint64(i)<<32 + uint64(m) - 1) / uint64(m)
+		hi := (uint64(i+1)<<32+uint64(m)-1)/uint64(m) - 1
+		for j := reduce(lo, len(alphas)); j <= reduce(hi, len(alphas)); j++ {
+			res[i] = max(res[i], alphas[j])
+		}
+	}
+	return res
+}
+
+// mergedKeys returns the heap of the top n merged elements, and the
+// elements that were trimmed.
+func (s *Stream) mergedKeys(eMap map[string]Element) (keys, []Element) {
 	tk := keys{
-		m:    make(map[string]int),
-		elts: make([]Element, 0, s.n),
+		m:    make(map[string]int, min(len(eMap), s.n)),
+		elts: make([]Element, 0, len(eMap)),
 	}
-	for _, e := range elts {
-		heap.Push(&tk, e)
+	for _, v := range eMap {
+		tk.elts = append(tk.elts, v)
 	}
+	return tk, tk.settle(s)
+}
 
-	// modify alphas
-	for i, v := range other.alphas {
-		s.alphas[i] += v
+// settle makes merged elements a heap again: they are sorted like Keys,
+// trimmed to the size of s and indexed. It returns the trimmed elements,
+// which remain in the capacity of the elements until they are overwritten.
+func (tk *keys) settle(s *Stream) []Element {
+	s.sortElements(tk.elts)
+	var trimmed []Element
+	if len(tk.elts) > s.n {
+		tk.elts, trimmed = tk.elts[:s.n], tk.elts[s.n:]
 	}
+	clear(tk.m)
+	for i, e := range tk.elts {
+		tk.m[e.Key] = i
+	}
+	tk.init()
+	return trimmed
+}
 
-	// replace k
-	s.k = tk
-	return nil
+// fold records the counts of elements that are no longer monitored in their
+// alpha cells, as Forget does, so that their estimates remain upper bounds:
+// the sum of the alphas of both merged sketches can be lower than the merged
+// count of an element monitored by either.
+func (s *Stream) fold(elts []Element) {
+	for _, e := range elts {
+		xhash := reduce(s.sum(e.Key), len(s.alphas))
+		s.alphas[xhash] = max(s.alphas[xhash], e.Count)
+	}
 }
 
+// Count returns the total count inserted into the Stream, including merged
+// Streams.
+func (s *Stream) Count() int64 { return s.c }
+
+// Distinct returns the number of monitored elements, at most the size of the
+// Stream.
+func (s *Stream) Distinct() int { return len(s.k.elts) }
+
 // Keys returns the current estimates for the most frequent elements
 func (s *Stream) Keys() []Element {
-	elts := append([]Element(nil), s.k.elts...)
-	sort.Sort(elementsByCountDescending(elts))
-	if len(elts) > s.n {
-		elts = elts[:s.n]
+	return s.AppendKeys(nil)
+}
+
+// AppendKeys appends the elements of Keys to dst and returns the extended
+// slice. Reusing dst, e.g. dst[:0] of a previous call, makes it free of
+// allocations unless a pipeline or redaction allocates.
+func (s *Stream) AppendKeys(dst []Element) []Element {
+	start := len(dst)
+	dst = s.sorted(dst)
+	elts := s.report(dst[start:])
+	return append(dst[:start], elts...)
+}
+
+// sorted appends the monitored elements to dst in the order of Keys,
+// trimmed to the size of s, without the pipeline and redaction. Internal
+// callers use it, since they look the keys up again or rely on the
+// estimates being bounds.
+func (s *Stream) sorted(dst []Element) []Element {
+	start := len(dst)
+	dst = append(dst, s.k.elts...)
+	s.sortElements(dst[start:])
+	if len(dst)-start > s.n {
+		dst = dst[:start+s.n]
+	}
+	return dst
+}
+
+// report passes elts through the pipeline and the redactor, as Keys
+// reports them.
+func (s *Stream) report(elts []Element) []Element {
+	for _, stage := range s.pipeline {
+		elts = stage(elts)
+	}
+	return s.redacted(elts)
+}
+
+// redacted maps the keys of elts with the redactor, if any, in place.
+func (s *Stream) redacted(elts []Element) []Element {
+	if s.redact != nil {
+		for i := range elts {
+			elts[i].Key = s.redact(elts[i].Key)
+		}
 	}
 	return elts
 }
 
+// TopN returns the first m elements of Keys, without sorting all monitored
+// elements: they are selected with a heap of m elements, which is much
+// cheaper when m is small. With a pipeline, which may filter or reorder the
+// elements, it falls back to Keys.
+func (s *Stream) TopN(m int) []Element {
+	if m <= 0 {
+		return nil
+	}
+	if len(s.pipeline) > 0 || m >= min(len(s.k.elts), s.n) {
+		elts := s.Keys()
+		return elts[:min(m, len(elts))]
+	}
+
+	elts := s.selectTop(m)
+	s.sortElements(elts)
+	return s.redacted(elts)
+}
+
+// selectTop returns the first m monitored elements in the order of Keys,
+// unsorted, selected with a heap of m elements.
+func (s *Stream) selectTop(m int) []Element {
+	top := worstFirst{s: s, elts: make([]Element, 0, min(m, len(s.k.elts)))}
+	for _, e := range s.k.elts {
+		if len(top.elts) < m {
+			top.elts = append(top.elts, e)
+			top.up(len(top.elts) - 1)
+		} else if s.before(e, top.elts[0]) {
+			top.elts[0] = e
+			top.down(0)
+		}
+	}
+	return top.elts
+}
+
+// Rank returns the position of x in Keys, and false if x is not among them,
+// counting the elements ahead of x instead of sorting all of them. The
+// pipeline and redaction of Keys are ignored.
+func (s *Stream) Rank(x string) (int, bool) {
+	idx, ok := s.k.m[x]
+	if !ok {
+		return 0, false
+	}
+	e, rank := s.k.elts[idx], 0
+	for _, o := range s.k.elts {
+		if s.before(o, e) {
+			rank++
+		}
+	}
+	if rank >= s.n {
+		return 0, false
+	}
+	return rank, true
+}
+
+// Contains reports whether x is among Keys, in constant time unless
+// elements are monitored in overflow, see SetOverflow.
+func (s *Stream) Contains(x string) bool {
+	if len(s.k.elts) <= s.n {
+		_, ok := s.k.m[x]
+		return ok
+	}
+	_, ok := s.Rank(x)
+	return ok
+}
+
+// before reports whether a comes before b in Keys.
+func (s *Stream) before(a, b Element) bool {
+	if s.ties == TieByError {
+		return elementsByCountThenError{a, b}.Less(0, 1)
+	}
+	return elementsByCountDescending{a, b}.Less(0, 1)
+}
+
+// worstFirst is a heap of elements with the one coming last in Keys at the
+// root, maintained like the heap of monitored elements.
+type worstFirst struct {
+	s    *Stream
+	elts []Element
+}
+
+// worse reports whether a comes after b in Keys.
+func (w *worstFirst) worse(a, b Element) bool {
+	return w.s.before(b, a)
+}
+
+// up moves the element at i up to its place.
+func (w *worstFirst) up(i int) {
+	e := w.elts[i]
+	for i > 0 {
+		p := (i - 1) / 2
+		if !w.worse(e, w.elts[p]) {
+			break
+		}
+		w.elts[i] = w.elts[p]
+		i = p
+	}
+	w.elts[i] = e
+}
+
+// down moves the element at i down to its place.
+func (w *worstFirst) down(i int) {
+	e := w.elts[i]
+	n := len(w.elts)
+	for {
+		c := 2*i + 1
+		if c >= n || c < 0 { // c < 0 after int overflow
+			break
+		}
+		if r := c + 1; r < n && w.worse(w.elts[r], w.elts[c]) {
+			c = r
+		}
+		if !w.worse(w.elts[c], e) {
+			break
+		}
+		w.elts[i] = w.elts[c]
+		i = c
+	}
+	w.elts[i] = e
+}
+
+// KeysView calls fn for the current estimates in the same order as Keys,
+// until fn returns false. The key is passed as a byte slice sharing memory
+// with the monitored key, so no copies are made; fn must not modify or
+// retain it.
+func (s *Stream) KeysView(fn func(key []byte, count, err int64) bool) {
+	viewKeys(s.Keys(), fn)
+}
+
+func viewKeys(elts []Element, fn func(key []byte, count, err int64) bool) {
+	for _, e := range elts {
+		if !fn(unsafe.Slice(unsafe.StringData(e.Key), len(e.Key)), e.Count, e.Error) {
+			return
+		}
+	}
+}
+
+// SetRedactor configures a function that maps keys before they are returned
+// by Keys, e.g. to hash or mask sensitive values, after the pipeline set
+// with SetPipeline. The monitored keys themselves are left untouched. A nil
+// function disables redaction.
+func (s *Stream) SetRedactor(redact func(key string) string) {
+	s.redact = redact
+}
+
 // Estimate returns an estimate for the item x
 func (s *Stream) Estimate(x string) Element {
-	xhash := reduce(metro.Hash64Str(x, 0), len(s.alphas))
+	xhash := reduce(s.sum(x), len(s.alphas))
 
 	// are we tracking this element?
 	if idx, ok := s.k.m[x]; ok {
@@ -342,63 +1019,238 @@ func (s *Stream) Estimate(x string) Element {
 	return e
 }
 
-// EncodeMsgp ...
-func (s *Stream) EncodeMsgp(w *msgp.Writer) error {
+func (s *Stream) encode(w encoder, mode encodeMode) error {
+	if err := writeHeader(w, mode.version()); err != nil {
+		return err
+	}
+	return s.encodeBody(w, mode)
+}
+
+// encodeMode selects a variant of the encoding.
+type encodeMode int
+
+const (
+	encodeCanonical encodeMode = 1 << iota // see EncodeDeterministic
+	encodeCompact                          // see EncodeCompact
+	encodeUnchecked                        // no checksum, see EncodeMsgp
+	encodeNoCount                          // the total count is written by the TopK
+)
+
+// version returns the format version written in the header.
+func (m encodeMode) version() int {
+	if m&encodeUnchecked != 0 {
+		return 1
+	}
+	return formatVersion
+}
+
+// encodeBody encodes s without the header, e.g. as part of a TopK.
+func (s *Stream) encodeBody(w encoder, mode encodeMode) error {
+	// the hash and the presence of times are recorded as a negative int
+	// in front of n, which older snapshots (with metro and no times) omit
+	stamped := s.stamped
+	if s.clock != nil {
+		stamped = s.clock().UnixNano()
+	}
+	ext := int(s.hash)
+	if s.last != 0 || stamped != 0 {
+		ext |= extTimes
+	}
+	if s.seed != 0 {
+		ext |= extSeed
+	}
+	if s.c != 0 && mode&encodeNoCount == 0 {
+		ext |= extCount
+	}
+	if ext != 0 {
+		if err := w.WriteInt(-ext); err != nil {
+			return err
+		}
+	}
+	if ext&extTimes != 0 {
+		for _, t := range []int64{s.first, s.last, stamped} {
+			if err := w.WriteInt64(t); err != nil {
+				return err
+			}
+		}
+	}
+	if ext&extSeed != 0 {
+		if err := w.WriteInt64(int64(s.seed)); err != nil {
+			return err
+		}
+	}
+	if ext&extCount != 0 {
+		if err := w.WriteInt64(s.c); err != nil {
+			return err
+		}
+	}
 	if err := w.WriteInt(s.n); err != nil {
 		return err
 	}
 
-	if err := w.WriteArrayHeader(uint32(len(s.alphas))); err != nil {
+	alphas := s.alphas
+	if mode&encodeCompact != 0 && len(alphas) > 1 {
+		// a single cell keeps estimates of unmonitored keys upper bounds
+		alphas = []int64{slices.Max(s.alphas)}
+	}
+	if err := w.WriteArrayHeader(uint32(len(alphas))); err != nil {
 		return err
 	}
 
-	for _, a := range s.alphas {
-		if err := w.WriteInt(a); err != nil {
+	for _, a := range alphas {
+		if err := w.WriteInt64(a); err != nil {
 			return err
 		}
 	}
 
-	return s.k.EncodeMsgp(w)
+	return s.k.encode(w, mode&encodeCanonical != 0)
 }
 
-// DecodeMsgp ...
-func (s *Stream) DecodeMsgp(r *msgp.Reader) error {
-	var (
-		err error
-		sz  uint32
-	)
-
-	if s.n, err = r.ReadInt(); err != nil {
+// decode decodes into s, leaving it unmodified on error.
+func (s *Stream) decode(r decoder) error {
+	d := Stream{hasher: s.hasher}
+	if err := d.decodeSections(r, false); err != nil {
 		return err
 	}
+	s.restore(&d)
+	return nil
+}
 
-	if sz, err = r.ReadArrayHeader(); err != nil {
+// restore replaces the state of s with the state of the decoded d, keeping
+// the configuration of s.
+func (s *Stream) restore(d *Stream) {
+	s.n, s.hash, s.seed, s.k, s.alphas, s.c = d.n, d.hash, d.seed, d.k, d.alphas, d.c
+	s.first, s.last, s.stamped = d.first, d.last, d.stamped
+	s.touched = nil
+	s.saturated = d.hasSaturated()
+}
+
+// decodeSections decodes into a fresh s section by section, so that a
+// failure leaves everything read up to that point in place. If partial is
+// set, alphas that could not be read are left zero.
+func (s *Stream) decodeSections(r decoder, partial bool) error {
+	if err := s.decodeHead(r); err != nil {
 		return err
 	}
 
-	s.alphas = make([]int, sz)
-	for i := range s.alphas {
-		if s.alphas[i], err = r.ReadInt(); err != nil {
-			return err
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return &DecodeError{Section: "alphas", Err: err}
+	}
+	if sz == 0 || sz > maxDecodeAlphas {
+		return corrupt("alphas", "%d alphas", sz)
+	}
+
+	s.alphas = make([]int64, 0, min(sz, decodePrealloc))
+	for i := uint32(0); i < sz; i++ {
+		a, err := r.ReadInt64()
+		if err != nil {
+			if partial {
+				// the cells must keep their positions
+				s.alphas = append(s.alphas, make([]int64, int(sz)-len(s.alphas))...)
+			}
+			return &DecodeError{Section: "alphas", Err: err}
 		}
+		if a < 0 {
+			return corrupt("alphas", "negative alpha %d", a)
+		}
+		s.alphas = append(s.alphas, a)
+	}
+
+	if err := s.k.decode(r); err != nil {
+		return &DecodeError{Section: "elements", Err: err}
 	}
+	return nil
+}
+
+// decodeHead decodes the header and the size of a snapshot into s: the
+// hash, the times and n.
+func (s *Stream) decodeHead(r decoder) error {
+	var err error
 
-	return s.k.DecodeMsp(r)
+	// the header is omitted by older snapshots and within a TopK
+	if s.n, err = readHeader(r); err != nil {
+		return &DecodeError{Section: "header", Err: err}
+	}
+	if s.n < 0 {
+		ext := -s.n
+		if ext&^(extHash|extTimes|extSeed|extCount) != 0 {
+			s.n = 0
+			return corrupt("header", "unknown extension bits 0x%x", ext)
+		}
+		s.hash, s.n = hashID(ext&extHash), 0
+		if ext&extTimes != 0 {
+			for _, t := range []*int64{&s.first, &s.last, &s.stamped} {
+				if *t, err = r.ReadInt64(); err != nil {
+					return &DecodeError{Section: "header", Err: err}
+				}
+			}
+		}
+		if ext&extSeed != 0 {
+			var seed int64
+			if seed, err = r.ReadInt64(); err != nil {
+				return &DecodeError{Section: "header", Err: err}
+			}
+			s.seed = uint64(seed)
+		}
+		if ext&extCount != 0 {
+			if s.c, err = r.ReadInt64(); err != nil {
+				return &DecodeError{Section: "header", Err: err}
+			}
+			if s.c < 0 {
+				return corrupt("header", "count %d", s.c)
+			}
+		}
+		if s.n, err = r.ReadInt(); err != nil {
+			return &DecodeError{Section: "size", Err: err}
+		}
+	}
+	if s.n <= 0 || s.n > maxDecodeMonitored {
+		n := s.n
+		s.n = 0
+		return corrupt("size", "%d monitored elements", n)
+	}
+	if !s.hashAvailable() {
+		return &DecodeError{Section: "size", Err: fmt.Errorf("unsupported hash %v", s.hash)}
+	}
+	return nil
 }
 
 // Encode ...
 func (s *Stream) Encode(w io.Writer) error {
-	wrt := msgp.NewWriter(w)
-	if err := s.EncodeMsgp(wrt); err != nil {
-		return err
-	}
-	return wrt.Flush()
+	return s.EncodeContext(context.Background(), w)
+}
+
+// EncodeDeterministic is like Encode, but writes the monitored elements in a
+// canonical order so that identical sketch states always encode to identical
+// bytes. The decoded Stream is equivalent to, but may not be laid out exactly
+// like, the encoded one.
+func (s *Stream) EncodeDeterministic(w io.Writer) error {
+	return s.labelled("encode", func() error {
+		return encodeTo(w, s.transform, func(enc encoder) error {
+			return s.encode(enc, encodeCanonical)
+		})
+	})
+}
+
+// EncodeCompact is like Encode, but replaces the alphas with a single cell
+// holding the largest alpha, which makes the snapshot much smaller for
+// large sketches when only the results are needed. Decode reads it into a
+// Stream reporting the same monitored elements; estimates of unmonitored
+// keys are the largest alpha, still an upper bound. Such a Stream can keep
+// counting, with a much weaker filter, but can't be merged with sketches
+// that have all their alphas.
+func (s *Stream) EncodeCompact(w io.Writer) error {
+	return s.labelled("encode", func() error {
+		return encodeTo(w, s.transform, func(enc encoder) error {
+			return s.encode(enc, encodeCompact)
+		})
+	})
 }
 
 // Decode ...
 func (s *Stream) Decode(r io.Reader) error {
-	rdr := msgp.NewReader(r)
-	return s.DecodeMsgp(rdr)
+	return s.DecodeContext(context.Background(), r)
 }
 
 // Clear resets the Stream to its initial empty state.
@@ -407,99 +1259,270 @@ func (s *Stream) Decode(r io.Reader) error {
 func (s *Stream) Clear() {
 	s.k.Clear()
 	clear(s.alphas)
+	s.c = 0
+	s.first, s.last, s.stamped = 0, 0, 0
+	s.touched = nil
+	s.saturated = false
+	if s.quota != nil {
+		clear(s.quota.used)
+	}
+	if s.overload != nil {
+		s.overload.inserts = 0
+	}
+	if s.promote != nil {
+		s.promote.refresh(s)
+	}
+	if s.adapt != nil {
+		s.adapt.inserts, s.adapt.evictions = 0, 0
+		clear(s.adapt.hit)
+	}
+	if s.emerging != nil {
+		s.emerging.Clear()
+		s.emerging.inserts = 0
+	}
 }
 
 const defaultScaleFactorM = 2
 
 // This is a simple wrapper around the Stream struct, more of a helper of sort
 type TopK struct {
-	c int // c keeps track of number of inserts
 	k int // actual k we are tracking
 	*Stream
+
+	halfLife time.Duration
+	decayed  time.Time // last automatic decay
 }
 
-func New(k int) *TopK {
-	return NewWithScaleFactor(k, defaultScaleFactorM)
+// New returns a TopK reporting the top k elements, configured by opts.
+func New(k int, opts ...Option) *TopK {
+	c := newConfig(opts)
+	return newTopK(k, k*c.m, c)
 }
 
-func NewWithScaleFactor(k, m int) *TopK {
+func NewWithScaleFactor(k, m int, opts ...Option) *TopK {
+	return NewWithMonitored(k, k*m, opts...)
+}
+
+// NewWithMonitored returns a TopK reporting the top k elements while
+// monitoring n elements. n controls the accuracy and memory use of the
+// sketch independently of the number of results; it is raised to k if
+// smaller.
+func NewWithMonitored(k, n int, opts ...Option) *TopK {
+	return newTopK(k, n, newConfig(opts))
+}
+
+func newTopK(k, n int, c config) *TopK {
+	if n < k {
+		n = k
+	}
 	return &TopK{
 		k:      k,
-		Stream: newStream(k * m),
+		Stream: c.newStream(n, n*c.buf),
+	}
+}
+
+// NewWithErrorBound returns a TopK sized for the error guarantees of
+// Space-Saving: every estimate overcounts by at most epsilon times the total
+// count, so every element occurring more often than that is reported. The
+// filter is sized so that a key shares its alpha cell with a monitored key
+// with probability at most delta; the default sizing corresponds to a delta
+// of 1/6. The TopK reports all ceil(1/epsilon) monitored elements. It
+// panics unless epsilon and delta are in (0, 1).
+func NewWithErrorBound(epsilon, delta float64, opts ...Option) *TopK {
+	if !(epsilon > 0 && epsilon < 1) || !(delta > 0 && delta < 1) {
+		panic(fmt.Sprintf("topk: invalid error bound epsilon=%v delta=%v", epsilon, delta))
+	}
+	n := int(math.Ceil(1 / epsilon))
+	return &TopK{
+		k:      n,
+		Stream: newConfig(opts).newStream(n, int(math.Ceil(float64(n)/delta))),
 	}
 }
 
 func (t *TopK) Insert(x string, count int) Element {
-	t.c += count
+	if t.halfLife > 0 {
+		t.autoDecay()
+	}
 	return t.Stream.Insert(x, count)
 }
 
+// InsertHashed is like Insert, with the hash of x computed by the caller.
+// See Stream.InsertHashed.
+func (t *TopK) InsertHashed(x string, h uint64, count int) Element {
+	if t.halfLife > 0 {
+		t.autoDecay()
+	}
+	return t.Stream.InsertHashed(x, h, count)
+}
+
+// Merge merges other into t. other may be smaller than t, with a smaller k,
+// see Stream.Merge. TopKs decaying with SetHalfLife can only be
+// merged with TopKs using the same half-life; the counts of the one that
+// was decayed less recently are decayed to the time of the other first, so
+// that both weigh the past the same.
 func (t *TopK) Merge(other *TopK) error {
-	if t.k != other.k {
-		return fmt.Errorf("cannot merge TopKs with different k values")
+	return t.MergeContext(context.Background(), other)
+}
+
+func (t *TopK) checkMerge(other *TopK) error {
+	if other.k > t.k {
+		return fmt.Errorf("cannot merge TopK with k %d into one with k %d", other.k, t.k)
 	}
-	if err := t.Stream.Merge(other.Stream); err != nil {
-		return err
+	if t.halfLife != other.halfLife {
+		return ErrDecayMismatch
+	}
+	if _, ok := addCount(t.c, other.c); !ok && t.strict {
+		return ErrCountOverflow
 	}
-	t.c += other.c
 	return nil
 }
 
 func (t *TopK) Keys() []Element {
-	res := t.Stream.Keys()
-	if len(res) > t.k {
-		return res[:t.k]
+	return t.AppendKeys(nil)
+}
+
+// sorted is like Stream.sorted, limited to the top k elements.
+func (t *TopK) sorted(dst []Element) []Element {
+	start := len(dst)
+	dst = t.Stream.sorted(dst)
+	if len(dst)-start > t.k {
+		return dst[:start+t.k]
 	}
-	return res
+	return dst
 }
 
-// Returns number of items inserted into the TopK
-func (t *TopK) Count() int { return t.c }
+// AppendKeys is like Stream.AppendKeys, limited to the top k elements.
+func (t *TopK) AppendKeys(dst []Element) []Element {
+	start := len(dst)
+	dst = t.Stream.AppendKeys(dst)
+	if len(dst)-start > t.k {
+		return dst[:start+t.k]
+	}
+	return dst
+}
+
+// TopN is like Stream.TopN, limited to the top k elements.
+func (t *TopK) TopN(m int) []Element {
+	return t.Stream.TopN(min(m, t.k))
+}
 
-// EncodeMsgp ...
-func (t *TopK) EncodeMsgp(w *msgp.Writer) error {
+// Rank is like Stream.Rank, limited to the top k elements.
+func (t *TopK) Rank(x string) (int, bool) {
+	rank, ok := t.Stream.Rank(x)
+	if !ok || rank >= t.k {
+		return 0, false
+	}
+	return rank, true
+}
+
+// Contains reports whether x is among the top k elements.
+func (t *TopK) Contains(x string) bool {
+	_, ok := t.Rank(x)
+	return ok
+}
+
+// KeysView is like Stream.KeysView, limited to the top k elements.
+func (t *TopK) KeysView(fn func(key []byte, count, err int64) bool) {
+	viewKeys(t.Keys(), fn)
+}
+
+// K returns the number of elements reported by Keys.
+func (t *TopK) K() int { return t.k }
+
+func (t *TopK) encode(w encoder, mode encodeMode) error {
+	if err := writeHeader(w, mode.version()); err != nil {
+		return err
+	}
 	if err := w.WriteInt(t.k); err != nil {
 		return err
 	}
-	if err := w.WriteInt(t.c); err != nil {
+	if err := w.WriteInt64(t.c); err != nil {
 		return err
 	}
-	return t.Stream.EncodeMsgp(w)
+	return t.Stream.encodeBody(w, mode|encodeNoCount)
 }
 
-// DecodeMsgp ...
-func (t *TopK) DecodeMsgp(r *msgp.Reader) error {
-	var err error
+// decode decodes into t. Unless partial is set, t is left unmodified on
+// error.
+func (t *TopK) decode(r decoder, partial bool) error {
+	var (
+		k   int
+		c   int64
+		err error
+	)
 
-	if t.k, err = r.ReadInt(); err != nil {
-		return err
+	if k, err = readHeader(r); err != nil {
+		return &DecodeError{Section: "header", Err: err}
 	}
-	if t.c, err = r.ReadInt(); err != nil {
-		return err
+	if k < 0 {
+		// e.g. a delta, whose fingerprint may not even fit an int
+		return corrupt("header", "k %d", k)
+	}
+	if c, err = r.ReadInt64(); err != nil {
+		return &DecodeError{Section: "header", Err: err}
+	}
+	if c < 0 {
+		return corrupt("header", "count %d", c)
+	}
+	// keep the configuration of an existing Stream
+	s := t.Stream
+	if s == nil {
+		s = &Stream{}
 	}
-	t.Stream = &Stream{}
 
-	return t.Stream.DecodeMsgp(r)
+	if partial {
+		var ok bool
+		if ok, err = s.decodePartial(r); !ok {
+			return err
+		}
+	} else if err = s.decode(r); err != nil {
+		return err
+	}
+	s.c = c
+	t.k, t.Stream = k, s
+	return err
 }
 
 // Encode ...
 func (t *TopK) Encode(w io.Writer) error {
-	wrt := msgp.NewWriter(w)
-	if err := t.EncodeMsgp(wrt); err != nil {
-		return err
-	}
-	return wrt.Flush()
+	return t.EncodeContext(context.Background(), w)
+}
+
+// EncodeDeterministic is like Encode, but the output only depends on the
+// state of the TopK and not on the order of past inserts.
+func (t *TopK) EncodeDeterministic(w io.Writer) error {
+	return t.Stream.labelled("encode", func() error {
+		return encodeTo(w, t.transformer(), func(enc encoder) error {
+			return t.encode(enc, encodeCanonical)
+		})
+	})
+}
+
+// EncodeCompact is like Encode, but omits most of the alphas. See
+// Stream.EncodeCompact.
+func (t *TopK) EncodeCompact(w io.Writer) error {
+	return t.Stream.labelled("encode", func() error {
+		return encodeTo(w, t.transformer(), func(enc encoder) error {
+			return t.encode(enc, encodeCompact)
+		})
+	})
 }
 
 // Decode ...
 func (t *TopK) Decode(r io.Reader) error {
-	return t.DecodeMsgp(msgp.NewReader(r))
+	return t.DecodeContext(context.Background(), r)
+}
+
+func (t *TopK) transformer() Transformer {
+	if t.Stream == nil {
+		return nil
+	}
+	return t.transform
 }
 
 // Clear resets the TopK to its initial empty state.
 // Clear preserves the initial k value.
 // Clear is not thread-safe, should not use it concurrently with other methods.
 func (t *TopK) Clear() {
-	t.c = 0
 	t.Stream.Clear()
 }
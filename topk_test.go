@@ -3,6 +3,10 @@ package topk
 import (
 	"bufio"
 	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,9 +14,13 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"runtime/pprof"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -52,10 +60,10 @@ func TestTopK(t *testing.T) {
 		exact[item]++
 		count++
 		e := tk.Insert(item, 1)
-		if e.Count < exact[item] {
+		if e.Count < int64(exact[item]) {
 			t.Errorf("estimate lower than exact: key=%v, exact=%v, estimate=%v", e.Key, exact[item], e.Count)
 		}
-		if e.Count-e.Error > exact[item] {
+		if e.Count-e.Error > int64(exact[item]) {
 			t.Errorf("error bounds too large: key=%v, count=%v, error=%v, exact=%v", e.Key, e.Count, e.Error, exact[item])
 		}
 	}
@@ -64,7 +72,7 @@ func TestTopK(t *testing.T) {
 		log.Println("error during scan: ", err)
 	}
 
-	assert.Equal(t, count, tk.Count())
+	assert.Equal(t, int64(count), tk.Count())
 
 	var keys []string
 
@@ -86,10 +94,10 @@ func TestTopK(t *testing.T) {
 	}
 	for k, v := range exact {
 		e := tk.Estimate(k)
-		if e.Count < v {
+		if e.Count < int64(v) {
 			t.Errorf("estimate lower than exact: key=%v, exact=%v, estimate=%v", e.Key, v, e.Count)
 		}
-		if e.Count-e.Error > v {
+		if e.Count-e.Error > int64(v) {
 			t.Errorf("error bounds too large: key=%v, count=%v, error=%v, exact=%v", e.Key, e.Count, e.Error, v)
 		}
 	}
@@ -121,9 +129,10 @@ func TestTopKMerge(t *testing.T) {
 	tk2 := New(20)
 	mtk := New(20)
 	count := 0
+	r := rand.New(rand.NewSource(1))
 
 	for i := 0; i <= 10000; i++ {
-		x := rand.ExpFloat64() * 10
+		x := r.ExpFloat64() * 10
 		word := fmt.Sprintf("word-%d", int(x))
 		tk1.Insert(word, 1)
 		mtk.Insert(word, 1)
@@ -131,7 +140,7 @@ func TestTopKMerge(t *testing.T) {
 	}
 
 	for i := 0; i <= 10000; i++ {
-		x := rand.ExpFloat64() * 10
+		x := r.ExpFloat64() * 10
 		word := fmt.Sprintf("word-%d", int(x))
 		tk2.Insert(word, 1)
 		mtk.Insert(word, 1)
@@ -149,7 +158,7 @@ func TestTopKMerge(t *testing.T) {
 			t.Errorf("%v != %v", r1[i], r2[i])
 		}
 	}
-	assert.Equal(t, count, mtk.Count())
+	assert.Equal(t, int64(count), mtk.Count())
 }
 
 func loadWords() []string {
@@ -206,8 +215,8 @@ func errorRate(epsilon float64, exact map[string]int, sketch map[string]Element)
 
 	for w, wc := range sketch {
 		exactwc := float64(exact[w])
-		lowerBound := int(math.Floor(exactwc * (1 - epsilon)))
-		upperBound := int(math.Ceil(exactwc * (1 + epsilon)))
+		lowerBound := int64(math.Floor(exactwc * (1 - epsilon)))
+		upperBound := int64(math.Ceil(exactwc * (1 + epsilon)))
 
 		if wc.Count-wc.Error < lowerBound || wc.Count-wc.Error > upperBound {
 			numBad++
@@ -295,7 +304,7 @@ func TestSingle(t *testing.T) {
 	// TODO: by way of construction of test set we have pandemonium after #8, would like to check top[:topk]
 	skTop := sketch.Keys()
 	for i, w := range top[:8] {
-		if w != skTop[i].Key && exact[w] != skTop[i].Count {
+		if w != skTop[i].Key && int64(exact[w]) != skTop[i].Count {
 			fmt.Println("key", w, exact[w])
 			t.Errorf("Expected top %d/%d to be '%s'(%d) found '%s'(%d)", i, topK, w, exact[w], skTop[i].Key, skTop[i].Count)
 		}
@@ -375,7 +384,7 @@ func caseRunner(t *testing.T, slices [][]string, topk int, delta float64) {
 		// Assert order of heavy hitters in sub-sketch is as expected
 		// TODO: by way of construction of test set we have pandemonium after #8, would like to check top[:topk]
 		for i, w := range top[:8] {
-			if w != skTop[i].Key && exact[w] != skTop[i].Count {
+			if w != skTop[i].Key && int64(exact[w]) != skTop[i].Count {
 				t.Errorf("Expected top %d/%d to be '%s'(%d) found '%s'(%d)", i, topk, w, exact[w], skTop[i].Key, skTop[i].Count)
 			}
 		}
@@ -454,11 +463,11 @@ func TestTopKClear(t *testing.T) {
 
 	tk.Clear()
 
-	assert.Equal(t, 0, tk.Count())
+	assert.Equal(t, int64(0), tk.Count())
 	keys := tk.Keys()
 	assert.Equal(t, 0, len(keys))
 	est := tk.Estimate("apple")
-	assert.Equal(t, 0, est.Count)
+	assert.Equal(t, int64(0), est.Count)
 	assert.Equal(t, 10, tk.k)
 }
 
@@ -475,6 +484,1218 @@ func TestStreamClear(t *testing.T) {
 	assert.Equal(t, 0, len(keys))
 
 	est := stream.Estimate("foo")
-	assert.Equal(t, 0, est.Count)
+	assert.Equal(t, int64(0), est.Count)
 	assert.Equal(t, 10, stream.n)
 }
+
+func TestEncodeDeterministic(t *testing.T) {
+	tk1 := New(10)
+	tk2 := New(10)
+
+	words := []string{"apple", "banana", "cherry", "date", "elderberry"}
+	for i, w := range words {
+		tk1.Insert(w, i+1)
+	}
+	for i := len(words) - 1; i >= 0; i-- {
+		tk2.Insert(words[i], i+1)
+	}
+
+	b1 := bytes.NewBuffer(nil)
+	assert.NoError(t, tk1.EncodeDeterministic(b1))
+	b2 := bytes.NewBuffer(nil)
+	assert.NoError(t, tk2.EncodeDeterministic(b2))
+	assert.Equal(t, b1.Bytes(), b2.Bytes())
+
+	decoded := &TopK{}
+	assert.NoError(t, decoded.Decode(bytes.NewReader(b1.Bytes())))
+	assert.Equal(t, tk1.Keys(), decoded.Keys())
+	for _, w := range words {
+		assert.Equal(t, tk1.Estimate(w), decoded.Estimate(w))
+	}
+
+	b3 := bytes.NewBuffer(nil)
+	assert.NoError(t, decoded.EncodeDeterministic(b3))
+	assert.Equal(t, b1.Bytes(), b3.Bytes())
+}
+
+type gzipTransformer struct{}
+
+func (gzipTransformer) NewWriter(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+func (gzipTransformer) NewReader(r io.Reader) (io.Reader, error)      { return gzip.NewReader(r) }
+
+func TestTransformer(t *testing.T) {
+	tk := New(10)
+	tk.SetTransformer(gzipTransformer{})
+	for _, w := range []string{"apple", "banana", "cherry", "apple"} {
+		tk.Insert(w, 1)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, tk.Encode(buf))
+
+	// the raw bytes are gzipped
+	_, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+
+	plain := New(10)
+	assert.Error(t, plain.Decode(bytes.NewReader(buf.Bytes())))
+
+	decoded := New(10)
+	decoded.SetTransformer(gzipTransformer{})
+	assert.NoError(t, decoded.Decode(buf))
+	assert.Equal(t, tk.Keys(), decoded.Keys())
+	assert.Equal(t, tk.Count(), decoded.Count())
+}
+
+func TestGzip(t *testing.T) {
+	tk := NewWithMonitored(10, 1000)
+	for i := 0; i < 5000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%(1+i%300)), 1)
+	}
+	plain, compressed := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	assert.NoError(t, tk.Encode(plain))
+	tk.SetTransformer(Gzip(gzip.BestCompression))
+	assert.NoError(t, tk.Encode(compressed))
+	assert.Less(t, compressed.Len(), plain.Len()/3)
+
+	// both decode with compression enabled
+	decoded := New(10)
+	decoded.SetTransformer(Gzip(gzip.DefaultCompression))
+	for _, buf := range []*bytes.Buffer{compressed, plain} {
+		assert.NoError(t, decoded.Decode(buf))
+		assert.Equal(t, tk.Keys(), decoded.Keys())
+	}
+
+	tk.SetTransformer(Gzip(42))
+	assert.Error(t, tk.Encode(io.Discard))
+}
+
+func TestRedactor(t *testing.T) {
+	tk := New(10)
+	tk.Insert("token=secret", 3)
+	tk.Insert("token=other", 1)
+	tk.SetRedactor(func(key string) string {
+		return strings.SplitN(key, "=", 2)[0] + "=***"
+	})
+
+	keys := tk.Keys()
+	assert.Equal(t, 2, len(keys))
+	assert.Equal(t, Element{Key: "token=***", Count: 3}, keys[0])
+	assert.Equal(t, Element{Key: "token=***", Count: 1}, keys[1])
+
+	// internal state is untouched
+	assert.Equal(t, int64(3), tk.Estimate("token=secret").Count)
+
+	tk.SetRedactor(nil)
+	assert.Equal(t, "token=secret", tk.Keys()[0].Key)
+}
+
+func TestInsertFrom(t *testing.T) {
+	tk := New(10)
+	tk.SetSourceQuota(5, time.Hour)
+
+	assert.Equal(t, int64(3), tk.InsertFrom("client-1", "foo", 3).Count)
+	// only 2 of the remaining weight is admitted
+	assert.Equal(t, int64(5), tk.InsertFrom("client-1", "foo", 10).Count)
+	assert.Equal(t, int64(0), tk.InsertFrom("client-1", "bar", 1).Count)
+	assert.Equal(t, int64(0), tk.Estimate("bar").Count)
+
+	// other sources are not affected
+	assert.Equal(t, int64(9), tk.InsertFrom("client-2", "foo", 4).Count)
+	assert.Equal(t, int64(9), tk.Count())
+
+	// without a quota everything is admitted
+	tk.SetSourceQuota(0, 0)
+	assert.Equal(t, int64(19), tk.InsertFrom("client-1", "foo", 10).Count)
+	tk.SetSourceQuota(5, 0)
+	assert.Nil(t, tk.quota)
+
+	// intervals follow the clock
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tk = New(10)
+	tk.SetClock(func() time.Time { return now })
+	tk.SetSourceQuota(5, time.Minute)
+	assert.Equal(t, int64(5), tk.InsertFrom("client-1", "foo", 10).Count)
+	now = now.Add(time.Minute)
+	assert.Equal(t, int64(10), tk.InsertFrom("client-1", "foo", 10).Count)
+
+	// sources beyond the tracked ones share a quota
+	for i := 1; i < maxQuotaSources; i++ {
+		tk.InsertFrom(strconv.Itoa(i), "bar", 1)
+	}
+	assert.Len(t, tk.quota.used, maxQuotaSources)
+	assert.Equal(t, 3, tk.admit("new-1", 3))
+	assert.Equal(t, 2, tk.admit("new-2", 3))
+	assert.Len(t, tk.quota.used, maxQuotaSources)
+}
+
+func TestLeaderboard(t *testing.T) {
+	lb := Leaderboard{MinCount: 5, Smoothing: 0.5}
+
+	res := lb.Update([]Element{{Key: "a", Count: 100}, {Key: "b", Count: 90}, {Key: "c", Count: 3}}, 10)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, "a", res[0].Key)
+	assert.Equal(t, "b", res[1].Key)
+
+	// a single jump of b doesn't overtake a
+	res = lb.Update([]Element{{Key: "b", Count: 105}, {Key: "a", Count: 101}}, 10)
+	assert.Equal(t, "a", res[0].Key)
+	assert.Equal(t, 100.5, res[0].Score)
+	assert.Equal(t, 97.5, res[1].Score)
+
+	// but a sustained one does
+	res = lb.Update([]Element{{Key: "b", Count: 120}, {Key: "a", Count: 102}}, 10)
+	assert.Equal(t, "b", res[0].Key)
+
+	// missing elements decay out of the ranking
+	for i := 0; i < 10; i++ {
+		res = lb.Update([]Element{{Key: "b", Count: 120}}, 10)
+	}
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "b", res[0].Key)
+
+	// as do elements falling below MinCount
+	res = lb.Update([]Element{{Key: "b", Count: 120}, {Key: "c", Count: 20}}, 10)
+	assert.Equal(t, 2, len(res))
+	res = lb.Update([]Element{{Key: "b", Count: 120}, {Key: "c", Count: 4}}, 10)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, Ranked{Element: Element{Key: "c"}, Score: 10}, res[1])
+	for i := 0; i < 2; i++ {
+		res = lb.Update([]Element{{Key: "b", Count: 120}, {Key: "c", Count: 4}}, 10)
+	}
+	assert.Equal(t, 1, len(res))
+
+	// with a prior, a newcomer has to hold its count over several updates
+	lb = Leaderboard{Prior: 10, PriorWeight: 2}
+	res = lb.Update([]Element{{Key: "a", Count: 100}}, 10)
+	assert.InDelta(t, (2*10+100)/3.0, res[0].Score, 1e-9)
+	for i := 0; i < 3; i++ {
+		lb.Update([]Element{{Key: "a", Count: 100}}, 10)
+	}
+	res = lb.Update([]Element{{Key: "a", Count: 100}, {Key: "new", Count: 150}}, 10)
+	assert.Equal(t, "a", res[0].Key)
+	assert.InDelta(t, (2*10+5*100)/7.0, res[0].Score, 1e-9)
+	assert.InDelta(t, (2*10+150)/3.0, res[1].Score, 1e-9)
+	for i := 0; i < 5; i++ {
+		res = lb.Update([]Element{{Key: "a", Count: 100}, {Key: "new", Count: 150}}, 10)
+	}
+	assert.Equal(t, "new", res[0].Key)
+}
+
+func TestTrending(t *testing.T) {
+	total := New(10)
+	recent := New(10)
+
+	total.Insert("steady", 10000)
+	total.Insert("burst", 100)
+	recent.Insert("steady", 100)
+	recent.Insert("burst", 50)
+	recent.Insert("new", 10)
+
+	res := total.Trending(recent.Stream, 2)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, "burst", res[0].Key)
+	assert.InDelta(t, 5, res[0].Score, 1e-9)
+	assert.Equal(t, "new", res[1].Key)
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	tk := New(10)
+	for i := 0; i < 100; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%30), i)
+	}
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, tk.Encode(buf))
+	full := buf.Bytes()
+
+	// a failed decode leaves the receiver untouched
+	decoded := New(5)
+	decoded.Insert("foo", 1)
+	err := decoded.Decode(bytes.NewReader(full[:len(full)-10]))
+	var derr *DecodeError
+	assert.ErrorAs(t, err, &derr)
+	assert.Equal(t, "checksum", derr.Section)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Equal(t, 5, decoded.k)
+	assert.Equal(t, []Element{{Key: "foo", Count: 1}}, decoded.Keys())
+
+	// a partial decode keeps what could be read
+	partial := New(5)
+	err = partial.DecodePartial(bytes.NewReader(full[:len(full)-10]))
+	assert.ErrorAs(t, err, &derr)
+	assert.Equal(t, 10, partial.k)
+	assert.Equal(t, tk.Count(), partial.Count())
+	keys := partial.Keys()
+	assert.NotEmpty(t, keys)
+	assert.Less(t, len(partial.Stream.Keys()), len(tk.Stream.Keys()))
+	for _, e := range keys {
+		assert.Equal(t, tk.Estimate(e.Key), e)
+		assert.Equal(t, e, partial.Estimate(e.Key))
+	}
+
+	// nothing usable
+	partial = New(5)
+	assert.Error(t, partial.DecodePartial(bytes.NewReader(full[:1])))
+	assert.Equal(t, 5, partial.k)
+
+	// missing alphas are sized as configured
+	for cut := 1; cut < len(full); cut++ {
+		partial = New(10, WithAlphas(50))
+		err := partial.DecodePartial(bytes.NewReader(full[:cut]))
+		if !errors.As(err, &derr) || derr.Section != "alphas" {
+			continue
+		}
+		assert.Len(t, partial.alphas, 50)
+		partial = New(5, WithAlphas(50))
+		assert.Error(t, partial.DecodePartial(bytes.NewReader(full[:cut])))
+		assert.Len(t, partial.alphas, 20*defaultBufMultiplier)
+		break
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	// snapshot writes a Stream of n elements with the given alphas and
+	// elements, indexing elements at idx
+	var hash []byte
+	if defaultHash != hashMetro {
+		ext := -int8(defaultHash)
+		hash = []byte{byte(ext)}
+	}
+	snapshot := func(n int, alphas []int, idx map[string]int, elts []Element) []byte {
+		buf := bytes.NewBuffer(nil)
+		buf.Write(hash)
+		w := newEncoder(buf)
+		assert.NoError(t, w.WriteInt(n))
+		assert.NoError(t, w.WriteArrayHeader(uint32(len(alphas))))
+		for _, a := range alphas {
+			assert.NoError(t, w.WriteInt(a))
+		}
+		assert.NoError(t, w.WriteMapHeader(uint32(len(idx))))
+		for k, i := range idx {
+			assert.NoError(t, w.WriteString(k))
+			assert.NoError(t, w.WriteInt(i))
+		}
+		assert.NoError(t, w.WriteArrayHeader(uint32(len(elts))))
+		for _, e := range elts {
+			assert.NoError(t, w.WriteString(e.Key))
+			assert.NoError(t, w.WriteInt64(e.Count))
+			assert.NoError(t, w.WriteInt64(e.Error))
+		}
+		assert.NoError(t, w.Flush())
+		return buf.Bytes()
+	}
+	a := []Element{{Key: "a", Count: 2}}
+
+	valid := snapshot(1, []int{0, 1}, map[string]int{"a": 0}, a)
+	s := &Stream{}
+	assert.NoError(t, s.Decode(bytes.NewReader(valid)))
+	assert.Equal(t, a, s.Keys())
+
+	for name, b := range map[string][]byte{
+		"no elements":    snapshot(0, []int{0}, nil, nil),
+		"huge n":         snapshot(maxDecodeMonitored+1, []int{0}, nil, nil),
+		"no alphas":      snapshot(1, nil, nil, nil),
+		"negative alpha": snapshot(1, []int{-1}, nil, nil),
+		"unindexed":      snapshot(1, []int{0}, nil, a),
+		"wrong index":    snapshot(2, []int{0}, map[string]int{"a": 1, "b": 0}, append(a, Element{Key: "b"})),
+		"error > count":  snapshot(1, []int{0}, map[string]int{"a": 0}, []Element{{Key: "a", Count: 1, Error: 2}}),
+		"extension":      {0xd0, 0xc0, 0x01},
+		"huge alphas":    append(hash, 0x01, 0xdd, 0xff, 0xff, 0xff, 0xff),
+		"huge key":       append(hash, 0x01, 0x91, 0x00, 0x81, 0xdb, 0x7f, 0xff, 0xff, 0xff),
+	} {
+		err := s.Decode(bytes.NewReader(b))
+		assert.ErrorIs(t, err, ErrCorruptSnapshot, name)
+		assert.Equal(t, a, s.Keys(), name)
+		assert.ErrorIs(t, (&Stream{}).DecodePartial(bytes.NewReader(b)), ErrCorruptSnapshot, name)
+	}
+
+	// sizes are not trusted for allocating
+	allocs := testing.AllocsPerRun(10, func() {
+		s.Decode(bytes.NewReader(append(hash, 0x01, 0xdd, 0x03, 0xff, 0xff, 0xff, 0x00)))
+	})
+	assert.Less(t, allocs, 20.0)
+}
+
+func FuzzDecode(f *testing.F) {
+	tk := New(5)
+	for i := 0; i < 50; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%13), i)
+	}
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(f, tk.Encode(buf))
+	f.Add(buf.Bytes())
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tk := &TopK{}
+		if err := tk.Decode(bytes.NewReader(b)); err != nil {
+			return
+		}
+		// a decoded sketch is usable
+		tk.Insert("foo", 1)
+		tk.Keys()
+		tk.Merge(tk)
+	})
+}
+
+func TestKeysView(t *testing.T) {
+	tk := New(10)
+	tk.Insert("foo", 3)
+	tk.Insert("bar", 5)
+	tk.Insert("baz", 1)
+
+	var buf bytes.Buffer
+	tk.KeysView(func(key []byte, count, err int64) bool {
+		fmt.Fprintf(&buf, "%s=%d-%d;", key, count, err)
+		return count > 1
+	})
+	assert.Equal(t, "bar=5-0;foo=3-0;baz=1-0;", buf.String())
+
+	buf.Reset()
+	tk.KeysView(func(key []byte, count, err int64) bool {
+		buf.Write(key)
+		return false
+	})
+	assert.Equal(t, "bar", buf.String())
+}
+
+func TestNewWithMonitored(t *testing.T) {
+	tk := NewWithMonitored(10, 5000)
+	assert.Equal(t, 10, tk.k)
+	assert.Equal(t, 5000, tk.n)
+
+	for i := 0; i < 100; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i), i)
+	}
+	assert.Equal(t, 10, len(tk.Keys()))
+	assert.Equal(t, 100, len(tk.Stream.Keys()))
+
+	assert.Equal(t, 10, NewWithMonitored(10, 1).n)
+}
+
+func TestEmerging(t *testing.T) {
+	tk := NewWithScaleFactor(5, 1)
+	assert.Nil(t, tk.Emerging(5))
+	tk.EnableEmerging(5)
+
+	for i := 0; i < 5; i++ {
+		tk.Insert(fmt.Sprintf("heavy-%d", i), 1000)
+	}
+	for i := 0; i < 10; i++ {
+		tk.Insert("rising", 10)
+	}
+	tk.Insert("noise", 1)
+
+	em := tk.Emerging(1)
+	assert.Equal(t, 1, len(em))
+	assert.Equal(t, "rising", em[0].Key)
+	assert.Equal(t, int64(100), em[0].Count)
+
+	// once monitored, a key is no longer emerging
+	tk.Insert("rising", 1000)
+	for _, e := range tk.Emerging(5) {
+		assert.NotEqual(t, "rising", e.Key)
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy EvictionPolicy
+		alpha  int64
+	}{
+		{EvictOverwrite, 5},
+		{EvictMax, 7},
+		{EvictGuaranteed, 2},
+	} {
+		s := newStream(1)
+		s.SetEvictionPolicy(tc.policy)
+		s.Insert("a", 5)
+		s.k.elts[0].Error = 3
+		xhash := reduce(s.sum("a"), len(s.alphas))
+		s.alphas[xhash] = 7
+
+		// evict a
+		s.Insert("b", 10)
+		assert.Equal(t, tc.alpha, s.alphas[xhash], "policy %d", tc.policy)
+	}
+}
+
+func TestEvictMaxMonotonic(t *testing.T) {
+	words := loadWords()[:500]
+	tk := New(5)
+	tk.SetEvictionPolicy(EvictMax)
+
+	last := make(map[string]int64, len(words))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		tk.Insert(words[int(r.ExpFloat64()*50)%len(words)], 1+r.Intn(3))
+		if i%1000 == 0 {
+			// merging raises alphas above the monitored counts
+			other := New(5)
+			for j := 0; j < 1000; j++ {
+				other.Insert(words[r.Intn(len(words))], 1)
+			}
+			assert.NoError(t, tk.Merge(other))
+		}
+		if i%100 != 0 {
+			continue
+		}
+		for _, w := range words {
+			est := tk.Estimate(w).Count
+			if est < last[w] {
+				t.Fatalf("estimate for %q decreased from %d to %d", w, last[w], est)
+			}
+			last[w] = est
+		}
+	}
+}
+
+func TestWouldAdmit(t *testing.T) {
+	tk := NewWithScaleFactor(2, 1)
+
+	admit, displaced := tk.WouldAdmit("a", 1)
+	assert.True(t, admit)
+	assert.Equal(t, Element{}, displaced)
+
+	tk.Insert("a", 10)
+	tk.Insert("b", 5)
+
+	admit, displaced = tk.WouldAdmit("a", 1)
+	assert.True(t, admit)
+	assert.Equal(t, Element{}, displaced)
+
+	admit, _ = tk.WouldAdmit("c", 1)
+	assert.False(t, admit)
+
+	admit, displaced = tk.WouldAdmit("c", 6)
+	assert.True(t, admit)
+	assert.Equal(t, Element{Key: "b", Count: 5}, displaced)
+
+	// nothing changed
+	assert.Equal(t, []Element{{Key: "a", Count: 10}, {Key: "b", Count: 5}}, tk.Keys())
+	assert.Equal(t, int64(0), tk.Estimate("c").Count)
+}
+
+// TestWouldAdmitInsert checks WouldAdmit against a real Insert.
+func TestWouldAdmitInsert(t *testing.T) {
+	setAlpha := func(s *Stream, x string, a int64) {
+		s.alphas[reduce(s.sum(x), len(s.alphas))] = a
+	}
+	for _, tc := range []struct {
+		name  string
+		opts  []Option
+		setup func(s *Stream)
+		x     string
+		count int
+	}{
+		{name: "free", x: "b", count: 1},
+		{name: "monitored", x: "a", count: 1},
+		{name: "filtered", x: "c", count: 1},
+		{name: "tie", x: "c", count: 5},
+		{name: "evicts", x: "c", count: 6},
+		{name: "saturates", x: "c", count: 10, setup: func(s *Stream) {
+			setCount(s, "a", math.MaxInt64)
+			setCount(s, "b", math.MaxInt64)
+			setAlpha(s, "c", math.MaxInt64-1)
+		}},
+		{name: "aggregator filtered", x: "c", count: 3,
+			opts:  []Option{WithAggregator(func(old, delta int64) int64 { return max(old, delta) })},
+			setup: func(s *Stream) { setAlpha(s, "c", 4) }},
+		{name: "aggregator evicts", x: "c", count: 7,
+			opts: []Option{WithAggregator(func(old, delta int64) int64 { return max(old, delta) })}},
+		{name: "spill", x: "c", count: 6, setup: func(s *Stream) { s.SetOverflow(2, 1) }},
+		{name: "remove", x: "b", count: -2},
+		{name: "remove all", x: "b", count: -5},
+		{name: "remove unmonitored", x: "c", count: -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tk := NewWithScaleFactor(2, 1, tc.opts...)
+			tk.Insert("a", 10)
+			if tc.name != "free" {
+				tk.Insert("b", 5)
+			}
+			if tc.setup != nil {
+				tc.setup(tk.Stream)
+			}
+			before := tk.Keys()
+
+			admit, displaced := tk.WouldAdmit(tc.x, tc.count)
+			assert.Equal(t, before, tk.Keys())
+			assert.False(t, tk.saturated)
+
+			clone := tk.Clone()
+			clone.Insert(tc.x, tc.count)
+			_, inserted := clone.Stream.k.m[tc.x]
+			assert.Equal(t, inserted, admit)
+			var evicted Element
+			for _, e := range before {
+				if _, ok := clone.Stream.k.m[e.Key]; !ok && e.Key != tc.x {
+					evicted = e
+				}
+			}
+			assert.Equal(t, evicted, displaced)
+		})
+	}
+}
+
+func TestGlobalTopK(t *testing.T) {
+	shards := make([]Shard, 20)
+	exact := make(map[string]int)
+	r := rand.New(rand.NewSource(1))
+	for i := range shards {
+		tk := New(10)
+		for j := 0; j < 5000; j++ {
+			word := fmt.Sprintf("word-%d", int(r.ExpFloat64()*10))
+			// every shard has a few local heavy hitters
+			if j%10 == 0 {
+				word = fmt.Sprintf("local-%d-%d", i, j%3)
+			}
+			tk.Insert(word, 1)
+			exact[word]++
+		}
+		shards[i] = tk
+	}
+
+	res := GlobalTopK(10, shards...)
+	assert.Equal(t, 10, len(res))
+	top := exactTop(exact)
+	for i, e := range res {
+		assert.GreaterOrEqual(t, e.Count, int64(exact[e.Key]))
+		assert.LessOrEqual(t, e.Count-e.Error, int64(exact[e.Key]))
+		if i < 5 {
+			assert.Equal(t, top[i], e.Key)
+		}
+	}
+
+	assert.Nil(t, GlobalTopK(10))
+}
+
+func TestMergeWithProvenance(t *testing.T) {
+	s1 := newStream(4)
+	s2 := newStream(4)
+
+	s1.Insert("both", 10)
+	s1.Insert("left", 8)
+	s2.Insert("both", 5)
+	s2.Insert("right", 7)
+	s2.alphas[reduce(s2.sum("left"), len(s2.alphas))] = 2
+
+	res, err := s1.MergeWithProvenance(s2)
+	assert.NoError(t, err)
+	assert.Equal(t, []MergedElement{
+		{Element: Element{Key: "both", Count: 15}, Provenance: FromLeft | FromRight},
+		{Element: Element{Key: "left", Count: 10, Error: 2}, Provenance: FromLeft | Inferred},
+		{Element: Element{Key: "right", Count: 7}, Provenance: FromRight},
+	}, res)
+
+	tk1, tk2 := New(2), New(2)
+	tk1.Insert("foo", 1)
+	tk2.Insert("foo", 2)
+	_, err = tk1.MergeWithProvenance(tk2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), tk1.Count())
+
+	_, err = tk1.MergeWithProvenance(New(3))
+	assert.Error(t, err)
+}
+
+func TestShadow(t *testing.T) {
+	sh := NewShadow(New(10))
+	sh.Panic = true
+	for _, w := range loadWords() {
+		sh.Insert(w, 1)
+	}
+	assert.Empty(t, sh.Check())
+
+	// corrupt the sketch
+	sh.Stream.k.elts[0].Count = 0
+	key := sh.Stream.k.elts[0].Key
+	violations := sh.Check()
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, key, violations[0].Estimate.Key)
+	assert.Equal(t, sh.Exact(key), violations[0].Exact)
+	assert.Panics(t, func() { sh.Insert(key, 0) })
+
+	sh.Clear()
+	assert.Empty(t, sh.Check())
+	assert.Equal(t, 0, sh.Exact(key))
+}
+
+func TestInsertAllocs(t *testing.T) {
+	tk := New(10)
+	words := loadWords()[:1000]
+	for _, w := range words {
+		tk.Insert(w, 1)
+	}
+
+	i := 0
+	allocs := testing.AllocsPerRun(10000, func() {
+		tk.Insert(words[i%len(words)], 1)
+		i++
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	allocs = testing.AllocsPerRun(10000, func() {
+		tk.Estimate(words[i%len(words)])
+		i++
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestProfilerLabels(t *testing.T) {
+	tk1, tk2 := New(10), New(10)
+	tk1.SetProfilerLabels(true)
+	tk1.Insert("foo", 1)
+	tk2.Insert("foo", 2)
+
+	assert.NoError(t, tk1.Merge(tk2))
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, tk1.Encode(buf))
+	decoded := New(10)
+	decoded.SetProfilerLabels(true)
+	assert.NoError(t, decoded.Decode(buf))
+	assert.Equal(t, tk1.Keys(), decoded.Keys())
+
+	for _, on := range []bool{true, false} {
+		s := New(10).Stream
+		s.SetProfilerLabels(on)
+		assert.NoError(t, s.labelledContext(context.Background(), "merge", func(ctx context.Context) error {
+			op, ok := pprof.Label(ctx, "topk")
+			assert.Equal(t, on, ok)
+			if on {
+				assert.Equal(t, "merge", op)
+			}
+			return nil
+		}))
+	}
+
+	// the goroutine carries the label while encoding
+	var profile bytes.Buffer
+	tk1.SetTransformer(profilingTransformer{profile: &profile})
+	assert.NoError(t, tk1.Encode(io.Discard))
+	assert.Contains(t, profile.String(), `"topk":"encode"`)
+
+	// the labels of the caller are kept by the Context variants
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("host", "ingest"))
+	assert.NoError(t, tk1.Stream.labelledContext(ctx, "merge", func(ctx context.Context) error {
+		host, _ := pprof.Label(ctx, "host")
+		op, _ := pprof.Label(ctx, "topk")
+		assert.Equal(t, "ingest", host)
+		assert.Equal(t, "merge", op)
+		return nil
+	}))
+	pprof.Do(context.Background(), pprof.Labels("host", "ingest"), func(ctx context.Context) {
+		profile.Reset()
+		assert.NoError(t, tk1.EncodeContext(ctx, io.Discard))
+		assert.Contains(t, profile.String(), `"host":"ingest", "topk":"encode"`)
+	})
+	assert.NoError(t, tk1.MergeContext(ctx, tk2))
+	tk1.SetTransformer(nil)
+	buf.Reset()
+	assert.NoError(t, tk1.EncodeContext(ctx, buf))
+	assert.NoError(t, decoded.DecodeContext(ctx, buf))
+	assert.Equal(t, tk1.Keys(), decoded.Keys())
+}
+
+// profilingTransformer writes the goroutine profile to profile whenever a
+// snapshot is encoded.
+type profilingTransformer struct {
+	gzipTransformer
+	profile *bytes.Buffer
+}
+
+func (p profilingTransformer) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if err := pprof.Lookup("goroutine").WriteTo(p.profile, 1); err != nil {
+		return nil, err
+	}
+	return p.gzipTransformer.NewWriter(w)
+}
+
+func TestForget(t *testing.T) {
+	tk := New(10)
+	tk.Insert("foo", 5)
+	tk.Insert("bar", 3)
+	tk.Insert("baz", 8)
+
+	assert.True(t, tk.Forget("foo"))
+	assert.False(t, tk.Forget("foo"))
+	assert.False(t, tk.Forget("unknown"))
+
+	assert.Equal(t, []Element{{Key: "baz", Count: 8}, {Key: "bar", Count: 3}}, tk.Keys())
+	// the estimate is still an upper bound
+	assert.Equal(t, Element{Key: "foo", Count: 5, Error: 5}, tk.Estimate("foo"))
+
+	tk.Insert("foo", 1)
+	assert.Equal(t, Element{Key: "foo", Count: 6, Error: 5}, tk.Estimate("foo"))
+}
+
+func TestForgetFunc(t *testing.T) {
+	tk := New(10)
+	for i := 0; i < 10; i++ {
+		tk.Insert(fmt.Sprintf("tenant-%d/key", i%3), i)
+	}
+
+	n := tk.ForgetFunc(func(e Element) bool { return strings.HasPrefix(e.Key, "tenant-1/") })
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, tk.ForgetFunc(func(e Element) bool { return false }))
+
+	keys := tk.Keys()
+	assert.Equal(t, []Element{{Key: "tenant-0/key", Count: 18}, {Key: "tenant-2/key", Count: 15}}, keys)
+	assert.Equal(t, int64(12), tk.Estimate("tenant-1/key").Count)
+
+	for _, e := range keys {
+		assert.True(t, tk.Forget(e.Key))
+	}
+	assert.Empty(t, tk.Keys())
+}
+
+func TestCompare(t *testing.T) {
+	a := []Element{{Key: "a", Count: 4}, {Key: "b", Count: 3}, {Key: "c", Count: 2}, {Key: "d", Count: 1}}
+	reversed := []Element{{Key: "d", Count: 4}, {Key: "c", Count: 3}, {Key: "b", Count: 2}, {Key: "a", Count: 1}}
+	replaced := []Element{{Key: "a", Count: 4}, {Key: "x", Count: 3}, {Key: "c", Count: 2}, {Key: "d", Count: 1}}
+
+	assert.Equal(t, Divergence{Jaccard: 1, RankCorrelation: 1}, Compare(a, a, 10))
+	assert.Equal(t, Divergence{Jaccard: 1, RankCorrelation: -1}, Compare(a, reversed, 10))
+
+	d := Compare(a, replaced, 10)
+	assert.Equal(t, 2, d.SymmetricDifference)
+	assert.Equal(t, 0.6, d.Jaccard)
+	assert.InDelta(t, 0, d.RankCorrelation, 1e-9)
+
+	d = Compare(a, replaced, 2)
+	assert.Equal(t, 2, d.SymmetricDifference)
+	assert.InDelta(t, 1.0/3, d.Jaccard, 1e-9)
+
+	// nothing to compare
+	for _, n := range []int{0, -1} {
+		assert.Equal(t, Divergence{Jaccard: 1, RankCorrelation: 1}, Compare(a, replaced, n))
+		assert.Equal(t, 1.0, JaccardAt(a, replaced, n))
+	}
+}
+
+func TestKendallTauTies(t *testing.T) {
+	a := []Element{{Key: "a", Count: 2}, {Key: "b", Count: 2}, {Key: "c", Count: 1}}
+	b := []Element{{Key: "b", Count: 5}, {Key: "a", Count: 4}, {Key: "c", Count: 1}}
+	// the swapped pair is a tie in a
+	assert.InDelta(t, 2/math.Sqrt(6), KendallTau(a, b), 1e-9)
+	assert.Equal(t, 1.0, KendallTau(nil, nil))
+	assert.Equal(t, 1.0, JaccardAt(nil, nil, 10))
+}
+
+func TestComparison(t *testing.T) {
+	var reports []Divergence
+	c := Comparison{
+		A:      New(10),
+		B:      NewWithScaleFactor(10, 1),
+		N:      10,
+		Report: func(d Divergence) { reports = append(reports, d) },
+		Every:  1000,
+	}
+	for _, w := range loadWords()[:5000] {
+		c.Insert(w, 1)
+	}
+	assert.Equal(t, 5, len(reports))
+	assert.Equal(t, reports[4], c.Divergence())
+	assert.LessOrEqual(t, reports[4].SymmetricDifference, 20)
+}
+
+func TestNewWithErrorBound(t *testing.T) {
+	tk := NewWithErrorBound(0.01, 1.0/6)
+	assert.Equal(t, 100, tk.n)
+	assert.Equal(t, 100, tk.k)
+	assert.Len(t, tk.alphas, 600)
+
+	tk = NewWithErrorBound(0.001, 0.01)
+	assert.Equal(t, 1000, tk.n)
+	assert.Len(t, tk.alphas, 100000)
+
+	words := loadWords()
+	exact := make(map[string]int)
+	for i := 0; i < 20000; i++ {
+		w := words[(i*i)%len(words)]
+		tk.Insert(w, 1)
+		exact[w]++
+	}
+	for w, c := range exact {
+		e := tk.Estimate(w)
+		assert.LessOrEqual(t, int64(c), e.Count)
+		assert.LessOrEqual(t, e.Count-int64(c), int64(0.001*float64(tk.Count())), w)
+	}
+
+	assert.Panics(t, func() { NewWithErrorBound(0, 0.1) })
+	assert.Panics(t, func() { NewWithErrorBound(0.1, 1) })
+}
+
+func TestHeapDown(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := newStream(50)
+	for i := 0; i < 20000; i++ {
+		count := r.Intn(10) + 1
+		if i%10 == 0 {
+			count = -1
+		}
+		s.Insert(strconv.Itoa(int(r.ExpFloat64()*30)), count)
+	}
+	for i, e := range s.k.elts {
+		assert.Equal(t, i, s.k.m[e.Key])
+		if i > 0 {
+			assert.False(t, lessInHeap(e, s.k.elts[(i-1)/2]), "element %d is less than its parent", i)
+		}
+	}
+}
+
+func TestHeapOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tk := keys{m: make(map[string]int)}
+	for i := 0; i < 5000; i++ {
+		switch op := r.Intn(4); {
+		case op == 0 && len(tk.elts) > 0:
+			tk.remove(r.Intn(len(tk.elts)))
+		case op == 1 && len(tk.elts) > 0:
+			first := tk.elts[0]
+			assert.Equal(t, first, tk.pop())
+		case op == 2 && len(tk.elts) > 0:
+			i := r.Intn(len(tk.elts))
+			tk.elts[i].Count = r.Int63n(100)
+			tk.fix(i)
+		default:
+			tk.push(Element{Key: strconv.Itoa(i), Count: r.Int63n(100)})
+		}
+		if i%100 == 0 {
+			assert.Len(t, tk.m, len(tk.elts))
+			for i, e := range tk.elts {
+				assert.Equal(t, i, tk.m[e.Key])
+				if i > 0 {
+					assert.False(t, lessInHeap(e, tk.elts[(i-1)/2]), "element %d is less than its parent", i)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkInsertUniform(b *testing.B) {
+	tk := New(100)
+	xs := make([]string, 1<<16)
+	for i := range xs {
+		xs[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tk.Insert(xs[i%len(xs)], 1)
+	}
+}
+
+// BenchmarkIncrement measures restoring the heap after incrementing a
+// monitored key, the most common operation on skewed streams.
+func BenchmarkIncrement(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		fix  func(tk *keys, i int)
+	}{
+		{"fix", (*keys).fix},
+		{"down", func(tk *keys, i int) { tk.down(i) }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := newStream(1000)
+			for i := 0; i < 1000; i++ {
+				s.Insert(strconv.Itoa(i), 1)
+			}
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 999)
+			xs := make([]string, 4096)
+			for i := range xs {
+				xs[i] = strconv.Itoa(int(zipf.Uint64()))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx := s.k.m[xs[i%len(xs)]]
+				s.k.elts[idx].Count++
+				bc.fix(&s.k, idx)
+			}
+		})
+	}
+}
+
+func BenchmarkInsertSkewed(b *testing.B) {
+	tk := New(100)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 1<<20)
+	xs := make([]string, 1<<16)
+	for i := range xs {
+		xs[i] = strconv.Itoa(int(zipf.Uint64()))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tk.Insert(xs[i%len(xs)], 1)
+	}
+}
+
+func TestMergeBounds(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		tk1, tk2 := New(5), New(5)
+		exact := make(map[string]int)
+		for i := 0; i < 3000; i++ {
+			x := fmt.Sprintf("word-%d", int(r.ExpFloat64()*20))
+			c := 1 + r.Intn(3)
+			exact[x] += c
+			if r.Intn(2) == 0 {
+				tk1.Insert(x, c)
+			} else {
+				tk2.Insert(x, c)
+			}
+		}
+
+		var buf bytes.Buffer
+		assert.NoError(t, tk2.Encode(&buf))
+		tk3 := New(5)
+		assert.NoError(t, tk3.Decode(bytes.NewReader(buf.Bytes())))
+		assert.NoError(t, tk3.Merge(tk1))
+		assert.NoError(t, tk1.MergeEncoded(&buf))
+
+		// elements trimmed by the merge must keep their bounds
+		for _, tk := range []*TopK{tk1, tk3} {
+			assert.Empty(t, EvaluateSketch(tk, exact, 5).Violations, "seed %d", seed)
+		}
+	}
+}
+
+func TestMergeSmaller(t *testing.T) {
+	words := loadWords()[:40000]
+	big, small := New(20), New(10)
+	for i, w := range words {
+		if i%2 == 0 {
+			big.Insert(w, 1)
+		} else {
+			small.Insert(w, 1)
+		}
+	}
+	assert.NoError(t, big.Merge(small))
+	assert.Equal(t, int64(len(words)), big.Count())
+	assert.Equal(t, 20, big.k)
+	for k, c := range exactCount(words) {
+		e := big.Estimate(k)
+		assert.GreaterOrEqual(t, e.Count, int64(c), k)
+		assert.LessOrEqual(t, e.Count-e.Error, int64(c), k)
+	}
+
+	assert.Error(t, small.Merge(big))
+
+	// MergeMany is sized like the largest sketch
+	res, err := MergeMany(small, big)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, res.k)
+	assert.Equal(t, big.n, res.n)
+}
+
+func TestResampleAlphas(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphas := make([]int64, 60)
+	for i := range alphas {
+		alphas[i] = r.Int63n(100)
+	}
+	for _, m := range []int{60, 61, 120, 1000, 7} {
+		res := resampleAlphas(alphas, m)
+		assert.Len(t, res, m)
+		for i := 0; i < 10000; i++ {
+			h := r.Uint64()
+			assert.GreaterOrEqual(t, res[reduce(h, m)], alphas[reduce(h, len(alphas))])
+		}
+	}
+	assert.Equal(t, []int64{slices.Max(alphas)}, resampleAlphas(alphas, 1))
+}
+
+func TestStreamCount(t *testing.T) {
+	s := New(10).Stream
+	for i := 0; i < 100; i++ {
+		s.Insert(fmt.Sprintf("word-%d", i%30), 2)
+	}
+	assert.Equal(t, int64(200), s.Count())
+	assert.Equal(t, s.n, s.Distinct())
+
+	var buf bytes.Buffer
+	assert.NoError(t, s.Encode(&buf))
+	decoded := &Stream{}
+	assert.NoError(t, decoded.Decode(&buf))
+	assert.Equal(t, int64(200), decoded.Count())
+
+	assert.NoError(t, s.Merge(decoded))
+	assert.Equal(t, int64(400), s.Count())
+	assert.NoError(t, s.Decay(0.5))
+	assert.Equal(t, int64(200), s.Count())
+
+	s.Clear()
+	assert.Zero(t, s.Count())
+	assert.Zero(t, s.Distinct())
+}
+
+func TestRemove(t *testing.T) {
+	tk := New(5)
+	r := rand.New(rand.NewSource(1))
+	exact := make(map[string]int)
+	for i := 0; i < 5000; i++ {
+		x := fmt.Sprintf("word-%d", int(r.ExpFloat64()*5))
+		c := 1 + r.Intn(3)
+		if r.Intn(3) == 0 {
+			c = -min(c, exact[x])
+		}
+		tk.Insert(x, c)
+		exact[x] += c
+	}
+	assert.Empty(t, EvaluateSketch(tk, exact, 5).Violations)
+	keys := tk.Keys()
+	assert.True(t, slices.IsSortedFunc(keys, func(a, b Element) int { return cmp.Compare(b.Count, a.Count) }))
+
+	// a key removed down to 0 is no longer monitored
+	x, distinct := keys[0].Key, tk.Distinct()
+	e := tk.Remove(x, int(keys[0].Count)+10)
+	assert.Equal(t, Element{Key: x}, e)
+	_, ok := tk.Stream.k.m[x]
+	assert.False(t, ok)
+	assert.Equal(t, distinct-1, tk.Distinct())
+
+	// unmonitored keys keep their estimates
+	before := tk.Estimate("missing")
+	assert.Equal(t, before, tk.Remove("missing", 1))
+	assert.Equal(t, before, tk.Insert("missing", -1))
+}
+
+func TestDelete(t *testing.T) {
+	tk := New(5)
+	now := time.Unix(0, 0)
+	tk.SetClock(func() time.Time { return now })
+	tk.EnableEmerging(64)
+	for i := 0; i < 100; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%3), 1)
+	}
+	tk.emerging.insert("word-1", 1)
+	before := tk.Estimate("word-1")
+
+	assert.True(t, tk.Delete("word-1"))
+	assert.False(t, tk.Delete("word-1"))
+	_, ok := tk.touched["word-1"]
+	assert.False(t, ok)
+	_, ok = tk.emerging.k.m["word-1"]
+	assert.False(t, ok)
+	assert.GreaterOrEqual(t, tk.Estimate("word-1").Count, before.Count)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tk.Encode(&buf))
+	assert.NotContains(t, buf.String(), "word-1")
+}
+
+func TestTopN(t *testing.T) {
+	for _, ties := range []TieBreak{TieByKey, TieByError} {
+		tk := New(100, WithTieBreak(ties))
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 20000; i++ {
+			tk.Insert(fmt.Sprintf("word-%d", int(r.ExpFloat64()*100)), 1+r.Intn(2))
+		}
+		keys := tk.Keys()
+		for _, m := range []int{1, 10, 99, 100, 1000} {
+			assert.Equal(t, keys[:min(m, len(keys))], tk.TopN(m), "m %d", m)
+		}
+		assert.Empty(t, tk.TopN(0))
+		assert.Empty(t, tk.TopN(-1))
+
+		// only the result is allocated
+		allocs := testing.AllocsPerRun(1000, func() {
+			tk.TopN(10)
+		})
+		assert.Equal(t, 1.0, allocs)
+	}
+}
+
+func BenchmarkTopN(b *testing.B) {
+	tk := New(1000)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", int(r.ExpFloat64()*1000)), 1)
+	}
+	b.Run("Keys", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = tk.Keys()[:10]
+		}
+	})
+	b.Run("TopN", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tk.TopN(10)
+		}
+	})
+}
+
+func TestRank(t *testing.T) {
+	tk := New(10)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", int(r.ExpFloat64()*30)), 1)
+	}
+
+	for i, e := range tk.Keys() {
+		rank, ok := tk.Rank(e.Key)
+		assert.True(t, ok, e.Key)
+		assert.Equal(t, i, rank, e.Key)
+		assert.True(t, tk.Contains(e.Key))
+	}
+	for i, e := range tk.Stream.Keys() {
+		rank, ok := tk.Stream.Rank(e.Key)
+		assert.True(t, ok)
+		assert.Equal(t, i, rank)
+		assert.True(t, tk.Stream.Contains(e.Key))
+		if i >= tk.K() {
+			assert.False(t, tk.Contains(e.Key), e.Key)
+		}
+	}
+	_, ok := tk.Rank("missing")
+	assert.False(t, ok)
+	assert.False(t, tk.Stream.Contains("missing"))
+}
+
+func TestAppendKeys(t *testing.T) {
+	tk := New(10)
+	for i := 0; i < 1000; i++ {
+		tk.Insert(fmt.Sprintf("word-%d", i%(1+i%40)), 1)
+	}
+
+	prefix := []Element{{Key: "prefix"}}
+	assert.Equal(t, append(slices.Clone(prefix), tk.Keys()...), tk.AppendKeys(prefix))
+	assert.Equal(t, tk.Stream.Keys(), tk.Stream.AppendKeys(nil))
+
+	buf := tk.AppendKeys(nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = tk.AppendKeys(buf[:0])
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestMergeInPlace(t *testing.T) {
+	tk1, tk2 := New(100), New(100)
+	for i := 0; i < 100000; i++ {
+		tk1.Insert(fmt.Sprintf("word-%d", i%(1+i%1000)), 1)
+		tk2.Insert(fmt.Sprintf("word-%d", i%(1+i%777)), 1)
+	}
+	assert.NoError(t, tk1.Merge(tk2))
+	allocs := testing.AllocsPerRun(10, func() {
+		assert.NoError(t, tk1.Merge(tk2))
+	})
+	assert.Zero(t, allocs)
+
+	// merging a Stream into itself doubles it
+	keys := tk2.Keys()
+	assert.NoError(t, tk2.Merge(tk2))
+	for i, e := range tk2.Keys() {
+		assert.Equal(t, keys[i].Key, e.Key)
+		assert.Equal(t, 2*keys[i].Count, e.Count)
+	}
+}
+
+func BenchmarkMerge(b *testing.B) {
+	tk1, tk2 := New(100), New(100)
+	for i := 0; i < 100000; i++ {
+		tk1.Insert(fmt.Sprintf("word-%d", i%(1+i%1000)), 1)
+		tk2.Insert(fmt.Sprintf("word-%d", i%(1+i%777)), 1)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = tk1.Merge(tk2)
+	}
+}
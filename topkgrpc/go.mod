@@ -0,0 +1,11 @@
+module github.com/axiomhq/topk/topkgrpc
+
+go 1.24
+
+require (
+	github.com/axiomhq/topk v0.0.0
+	github.com/stretchr/testify v1.7.1
+	google.golang.org/grpc v1.65.0
+)
+
+replace github.com/axiomhq/topk => ../
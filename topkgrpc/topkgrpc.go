@@ -0,0 +1,63 @@
+// Package topkgrpc counts the heavy hitters among gRPC calls, e.g. the top
+// methods, peers or error codes of a service, with interceptors that can be
+// added to any grpc.Server. It is a module of its own, so that package topk
+// doesn't depend on gRPC.
+package topkgrpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/axiomhq/topk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// KeyFunc returns the key a finished call is counted under, given the
+// context of the call, its full method name and the error it returned.
+type KeyFunc func(ctx context.Context, method string, err error) string
+
+// ByMethod counts calls by full method name, e.g. "/pkg.Service/Method".
+func ByMethod(_ context.Context, method string, _ error) string { return method }
+
+// ByPeer counts calls by the IP address of the peer, without the port.
+// Calls without a peer are counted under the empty key.
+func ByPeer(ctx context.Context, _ string, _ error) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// ByCode counts calls by the name of their status code, e.g. "OK" or
+// "Unavailable".
+func ByCode(_ context.Context, _ string, err error) string {
+	return status.Code(err).String()
+}
+
+// UnaryServerInterceptor returns an interceptor counting every unary call
+// into s under the key returned by key, once it is handled.
+func UnaryServerInterceptor(s *topk.ConcurrentTopK, key KeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		s.Insert(key(ctx, info.FullMethod, err), 1)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor counting every streaming
+// call into s under the key returned by key, once it is handled. A stream is
+// counted once, however many messages it carries.
+func StreamServerInterceptor(s *topk.ConcurrentTopK, key KeyFunc) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		s.Insert(key(ss.Context(), info.FullMethod, err), 1)
+		return err
+	}
+}
@@ -0,0 +1,62 @@
+package topkgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	s := topk.SafeTopK(topk.New(10))
+	intercept := UnaryServerInterceptor(s, ByMethod)
+	handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+	for _, m := range []string{"/a.A/Get", "/a.A/Put", "/a.A/Get"} {
+		resp, err := intercept(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: m}, handler)
+		require.NoError(t, err)
+		assert.Equal(t, "req", resp)
+	}
+	assert.Equal(t, []topk.Element{{Key: "/a.A/Get", Count: 2}, {Key: "/a.A/Put", Count: 1}}, s.Keys())
+
+	// errors are passed through and counted by code
+	s = topk.SafeTopK(topk.New(10))
+	intercept = UnaryServerInterceptor(s, ByCode)
+	failing := func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	}
+	_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/a.A/Get"}, failing)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/a.A/Get"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, []topk.Element{{Key: "OK", Count: 1}, {Key: "Unavailable", Count: 1}}, s.Keys())
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	s := topk.SafeTopK(topk.New(10))
+	intercept := StreamServerInterceptor(s, ByPeer)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	errStream := errors.New("stream failed")
+	handler := func(srv any, ss grpc.ServerStream) error { return errStream }
+	for i := 0; i < 2; i++ {
+		err := intercept(nil, serverStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/a.A/Watch"}, handler)
+		assert.ErrorIs(t, err, errStream)
+	}
+	err := intercept(nil, serverStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/a.A/Watch"}, handler)
+	assert.ErrorIs(t, err, errStream)
+	assert.Equal(t, []topk.Element{{Key: "10.0.0.1", Count: 2}, {Key: "", Count: 1}}, s.Keys())
+}
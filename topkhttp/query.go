@@ -0,0 +1,90 @@
+package topkhttp
+
+import (
+	_ "embed"
+	"time"
+
+	"github.com/axiomhq/topk"
+)
+
+// QueryVersion is the version of the Query document served by Handler.
+const QueryVersion = 1
+
+// Schema is the JSON Schema of the Query document, for consumers outside
+// of Go.
+//
+//go:embed schema/query.v1.json
+var Schema []byte
+
+// Query is the versioned JSON document served by Handler, described by
+// Schema. Within a version, fields are only ever added.
+type Query struct {
+	Version   int            `json:"version"`
+	Params    QueryParams    `json:"params"`
+	Count     int64          `json:"count"`
+	Elements  []QueryElement `json:"elements"`
+	Staleness QueryStaleness `json:"staleness"`
+}
+
+// QueryParams are the parameters of the queried sketch.
+type QueryParams struct {
+	K         int `json:"k"`
+	Monitored int `json:"monitored"`
+	Alphas    int `json:"alphas"`
+}
+
+// QueryElement is an element with the bounds of its count.
+type QueryElement struct {
+	Key        string `json:"key"`
+	Count      int64  `json:"count"`
+	Error      int64  `json:"error"`
+	LowerBound int64  `json:"lower_bound"`
+	UpperBound int64  `json:"upper_bound"`
+}
+
+// QueryStaleness is topk.Staleness with unknown times as null.
+type QueryStaleness struct {
+	FirstInsert *time.Time `json:"first_insert"`
+	LastInsert  *time.Time `json:"last_insert"`
+	Snapshot    *time.Time `json:"snapshot"`
+}
+
+// NewQuery returns the Query document for the top n elements of t, or all
+// of them if n < 0.
+func NewQuery(t *topk.TopK, n int) Query {
+	keys := t.Keys()
+	if n >= 0 {
+		keys = keys[:min(n, len(keys))]
+	}
+	st := t.Stats()
+	q := Query{
+		Version:  QueryVersion,
+		Params:   QueryParams{K: t.K(), Monitored: st.Monitored, Alphas: st.Alphas},
+		Count:    t.Count(),
+		Elements: make([]QueryElement, len(keys)),
+	}
+	for i, e := range keys {
+		q.Elements[i] = QueryElement{
+			Key:        e.Key,
+			Count:      e.Count,
+			Error:      e.Error,
+			LowerBound: e.Count - e.Error,
+			UpperBound: e.Count,
+		}
+	}
+	s := t.Staleness()
+	q.Staleness = QueryStaleness{
+		FirstInsert: timeOrNull(s.FirstInsert),
+		LastInsert:  timeOrNull(s.LastInsert),
+		Snapshot:    timeOrNull(s.Snapshot),
+	}
+	return q
+}
+
+func timeOrNull(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,129 @@
+package topkhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validate checks v against the subset of JSON Schema used by Schema.
+func validate(schema map[string]any, v any, path string) error {
+	if c, ok := schema["const"]; ok && c != v {
+		return fmt.Errorf("%s: expected %v, got %v", path, c, v)
+	}
+	if typ, ok := schema["type"]; ok {
+		var types []any
+		if s, ok := typ.(string); ok {
+			types = []any{s}
+		} else {
+			types = typ.([]any)
+		}
+		if !slices.ContainsFunc(types, func(t any) bool { return hasType(v, t.(string)) }) {
+			return fmt.Errorf("%s: %v is not of type %v", path, v, typ)
+		}
+	}
+	if m, ok := schema["minimum"].(float64); ok {
+		if f, ok := v.(float64); ok && f < m {
+			return fmt.Errorf("%s: %v is less than %v", path, f, m)
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, r := range schema["required"].([]any) {
+			if _, ok := v[r.(string)]; !ok {
+				return fmt.Errorf("%s: missing %s", path, r)
+			}
+		}
+		for k, p := range v {
+			ps, ok := props[k]
+			if !ok {
+				return fmt.Errorf("%s: unexpected %s", path, k)
+			}
+			if err := validate(ps.(map[string]any), p, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if err := validate(schema["items"].(map[string]any), e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func TestQuerySchema(t *testing.T) {
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(Schema, &schema))
+
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	tk := topk.New(3)
+	tk.Insert("unstamped", 1)
+	s := topk.SafeTopK(tk)
+	tk.SetClock(func() time.Time { return now })
+	for _, k := range []string{"a", "b", "a", "c", "a", "d"} {
+		s.Insert(k, 1)
+	}
+
+	query := func(target string) (*httptest.ResponseRecorder, map[string]any) {
+		rec := httptest.NewRecorder()
+		Handler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var doc map[string]any
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+		}
+		return rec, doc
+	}
+
+	_, doc := query("/?v=1&n=2")
+	require.NoError(t, validate(schema, doc, "$"))
+	var q Query
+	b, _ := json.Marshal(doc)
+	require.NoError(t, json.Unmarshal(b, &q))
+	assert.Equal(t, QueryParams{K: 3, Monitored: 6, Alphas: 36}, q.Params)
+	assert.Equal(t, int64(7), q.Count)
+	assert.Equal(t, QueryElement{Key: "a", Count: 3, LowerBound: 3, UpperBound: 3}, q.Elements[0])
+	assert.Len(t, q.Elements, 2)
+	assert.Equal(t, now, *q.Staleness.LastInsert)
+	assert.Nil(t, q.Staleness.Snapshot)
+
+	// the schema rejects what it doesn't describe
+	doc["extra"] = true
+	assert.Error(t, validate(schema, doc, "$"))
+	delete(doc, "extra")
+	doc["version"] = 2.0
+	assert.Error(t, validate(schema, doc, "$"))
+
+	rec, _ := query("/?v=2")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
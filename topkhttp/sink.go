@@ -0,0 +1,38 @@
+package topkhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/axiomhq/topk"
+)
+
+// Sink is a topk.Sink posting windows as JSON to URL.
+type Sink struct {
+	URL string
+	// Client is used for requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// EmitWindow ...
+func (s Sink) EmitWindow(w topk.Window) error {
+	body, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("topkhttp: posting window %d: %s", w.Epoch, resp.Status)
+	}
+	return nil
+}
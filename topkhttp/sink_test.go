@@ -0,0 +1,26 @@
+package topkhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSink(t *testing.T) {
+	win := topk.Window{Epoch: 1, Count: 3, Keys: []topk.Element{{Key: "a", Count: 3}}}
+	var posted topk.Window
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil || posted.Epoch == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	sink := Sink{URL: srv.URL, Client: srv.Client()}
+	assert.NoError(t, sink.EmitWindow(win))
+	assert.Equal(t, win, posted)
+	assert.Error(t, sink.EmitWindow(topk.Window{Epoch: 2}))
+}
@@ -0,0 +1,120 @@
+// Package topkhttp counts the heavy hitters among HTTP requests, e.g. the
+// top endpoints or client addresses of a web service, and moves sketches and
+// windows over HTTP, keeping net/http out of package topk.
+package topkhttp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/axiomhq/topk"
+)
+
+// KeyFunc returns the key a request is counted under.
+type KeyFunc func(r *http.Request) string
+
+// ByPath counts requests by URL path.
+func ByPath(r *http.Request) string { return r.URL.Path }
+
+// ByClientIP counts requests by the IP address of the client, without the
+// port. Proxy headers are not taken into account.
+func ByClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByPattern counts requests by the ServeMux pattern they matched. It is only
+// set for requests passing through a ServeMux before the middleware, so it
+// is typically used with middleware wrapping the individual handlers.
+func ByPattern(r *http.Request) string { return r.Pattern }
+
+// Weight returns the weight a finished request is counted with, given the
+// number of response bytes written and the time it took to serve.
+type Weight func(r *http.Request, bytes int, d time.Duration) int
+
+// Bytes weights requests by the size of the response body.
+func Bytes(_ *http.Request, bytes int, _ time.Duration) int { return bytes }
+
+// Milliseconds weights requests by latency.
+func Milliseconds(_ *http.Request, _ int, d time.Duration) int { return int(d.Milliseconds()) }
+
+// Middleware returns middleware counting every request into s under the key
+// returned by key.
+func Middleware(s *topk.ConcurrentTopK, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.Insert(key(r), 1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WeightedMiddleware is like Middleware, but counts requests once they are
+// served, with the weight returned by weight.
+func WeightedMiddleware(s *topk.ConcurrentTopK, key KeyFunc, weight Weight) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			cw := &countingWriter{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+			if n := weight(r, cw.n, time.Since(start)); n > 0 {
+				s.Insert(key(r), n)
+			}
+		})
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *countingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Handler serves the current top k elements of s as JSON. The n query
+// parameter limits the number of elements. With v=1, the response is the
+// Query document described by Schema, for consumers that are not written
+// in Go; without v, it is a plain array of topk.Element, as before the
+// schema was introduced.
+func Handler(s *topk.ConcurrentTopK) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := -1
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n < 0 {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var res any
+		switch v := r.URL.Query().Get("v"); v {
+		case "":
+			keys := s.Keys()
+			if n >= 0 {
+				keys = keys[:min(n, len(keys))]
+			}
+			res = keys
+		case strconv.Itoa(QueryVersion):
+			s.Do(func(t *topk.TopK) { res = NewQuery(t, n) })
+		default:
+			http.Error(w, "unsupported version "+v, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+}
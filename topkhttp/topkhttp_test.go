@@ -0,0 +1,46 @@
+package topkhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	s := topk.SafeTopK(topk.New(10))
+	h := Middleware(s, ByPath)(http.NotFoundHandler())
+	for _, p := range []string{"/a", "/b", "/a"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?n=1", nil))
+	var keys []topk.Element
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&keys))
+	assert.Equal(t, []topk.Element{{Key: "/a", Count: 2}}, keys)
+
+	rec = httptest.NewRecorder()
+	Handler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?n=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestWeightedMiddleware(t *testing.T) {
+	s := topk.SafeTopK(topk.New(10))
+	h := WeightedMiddleware(s, ByClientIP, Bytes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	for _, p := range []string{"/a", "/bbb"} {
+		r := httptest.NewRequest(http.MethodGet, p, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	assert.Equal(t, topk.Element{Key: "10.0.0.1", Count: 6}, s.Estimate("10.0.0.1"))
+
+	assert.Equal(t, 1500, Milliseconds(nil, 0, 1500*time.Millisecond))
+}
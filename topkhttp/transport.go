@@ -0,0 +1,161 @@
+package topkhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/axiomhq/topk"
+)
+
+// MaxSketchSize is the largest encoded sketch TransportHandler accepts.
+const MaxSketchSize = 64 << 20
+
+// Transport is a topk.Transport talking to a TransportHandler at URL.
+type Transport struct {
+	// URL is the base URL the TransportHandler is served at.
+	URL string
+	// Client is used for requests; http.DefaultClient if nil.
+	Client *http.Client
+	// NewSketch returns the empty sketch a fetched sketch is decoded into,
+	// configured like the sketches of the handler, e.g. with the same
+	// Transformer. If nil, a zero TopK is used.
+	NewSketch func() *topk.TopK
+}
+
+func (h *Transport) do(ctx context.Context, method, name, suffix string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.URL+"/"+url.PathEscape(name)+suffix, body)
+	if err != nil {
+		return nil, err
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, topk.ErrSketchNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("topkhttp: %s %s: %s", method, req.URL, resp.Status)
+	}
+}
+
+// SendSketch ...
+func (h *Transport) SendSketch(ctx context.Context, name string, tk *topk.TopK) error {
+	buf := bytes.NewBuffer(nil)
+	if err := tk.Encode(buf); err != nil {
+		return err
+	}
+	resp, err := h.do(ctx, http.MethodPut, name, "", buf)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// FetchSketch ...
+func (h *Transport) FetchSketch(ctx context.Context, name string) (*topk.TopK, error) {
+	resp, err := h.do(ctx, http.MethodGet, name, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tk := emptySketch(h.NewSketch)
+	if err := tk.Decode(resp.Body); err != nil {
+		return nil, err
+	}
+	return tk, nil
+}
+
+// QueryEstimate ...
+func (h *Transport) QueryEstimate(ctx context.Context, name, key string) (topk.Element, error) {
+	resp, err := h.do(ctx, http.MethodGet, name, "/estimate?key="+url.QueryEscape(key), nil)
+	if err != nil {
+		return topk.Element{}, err
+	}
+	defer resp.Body.Close()
+
+	var e topk.Element
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		return topk.Element{}, err
+	}
+	return e, nil
+}
+
+// TransportHandler serves the sketches of t to Transport clients. Sent
+// sketches are decoded into the sketches returned by newSketch, configured
+// like the clients' sketches, e.g. with the same Transformer; a zero TopK if
+// it is nil. Sketches larger than MaxSketchSize are rejected. If the time of
+// the last insert is known (see topk.Stream.SetClock), sketches are served with it as
+// Last-Modified.
+func TransportHandler(t topk.Transport, newSketch func() *topk.TopK) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /{name}", func(w http.ResponseWriter, r *http.Request) {
+		tk := emptySketch(newSketch)
+		if err := tk.Decode(http.MaxBytesReader(w, r.Body, MaxSketchSize)); err != nil {
+			status := http.StatusBadRequest
+			if errors.As(err, new(*http.MaxBytesError)) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if err := t.SendSketch(r.Context(), r.PathValue("name"), tk); err != nil {
+			writeTransportError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /{name}", func(w http.ResponseWriter, r *http.Request) {
+		tk, err := t.FetchSketch(r.Context(), r.PathValue("name"))
+		if err != nil {
+			writeTransportError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-msgpack")
+		if last := tk.Staleness().LastInsert; !last.IsZero() {
+			w.Header().Set("Last-Modified", last.UTC().Format(http.TimeFormat))
+		}
+		tk.Encode(w)
+	})
+	mux.HandleFunc("GET /{name}/estimate", func(w http.ResponseWriter, r *http.Request) {
+		e, err := t.QueryEstimate(r.Context(), r.PathValue("name"), r.URL.Query().Get("key"))
+		if err != nil {
+			writeTransportError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+	return mux
+}
+
+func writeTransportError(w http.ResponseWriter, err error) {
+	if errors.Is(err, topk.ErrSketchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// emptySketch returns the sketch returned by fn, or a zero TopK if fn is nil.
+func emptySketch(fn func() *topk.TopK) *topk.TopK {
+	if fn == nil {
+		return &topk.TopK{}
+	}
+	return fn()
+}
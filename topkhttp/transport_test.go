@@ -0,0 +1,98 @@
+package topkhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(TransportHandler(topk.NewMemoryTransport(), nil))
+	defer srv.Close()
+	tr := &Transport{URL: srv.URL, Client: srv.Client()}
+	ctx := context.Background()
+
+	_, err := tr.FetchSketch(ctx, "missing")
+	assert.ErrorIs(t, err, topk.ErrSketchNotFound)
+	_, err = tr.QueryEstimate(ctx, "missing", "foo")
+	assert.ErrorIs(t, err, topk.ErrSketchNotFound)
+
+	tk := topk.New(10)
+	tk.Insert("foo", 3)
+	tk.Insert("bar", 1)
+	assert.NoError(t, tr.SendSketch(ctx, "a/b", tk))
+
+	// later changes are not visible
+	tk.Insert("foo", 1)
+
+	fetched, err := tr.FetchSketch(ctx, "a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []topk.Element{{Key: "foo", Count: 3}, {Key: "bar", Count: 1}}, fetched.Keys())
+	assert.Equal(t, int64(4), fetched.Count())
+
+	e, err := tr.QueryEstimate(ctx, "a/b", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, topk.Element{Key: "foo", Count: 3}, e)
+}
+
+func TestTransportTransformer(t *testing.T) {
+	gzipped := func() *topk.TopK {
+		tk := topk.New(10)
+		tk.SetTransformer(topk.Gzip(gzip.BestSpeed))
+		return tk
+	}
+	mem := topk.NewMemoryTransport()
+	mem.NewSketch = gzipped
+	srv := httptest.NewServer(TransportHandler(mem, gzipped))
+	defer srv.Close()
+	tr := &Transport{URL: srv.URL, Client: srv.Client(), NewSketch: gzipped}
+	ctx := context.Background()
+
+	tk := gzipped()
+	tk.Insert("foo", 3)
+	require.NoError(t, tr.SendSketch(ctx, "a", tk))
+	fetched, err := tr.FetchSketch(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, tk.Keys(), fetched.Keys())
+}
+
+func TestTransportHandlerLimit(t *testing.T) {
+	srv := httptest.NewServer(TransportHandler(topk.NewMemoryTransport(), nil))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/a", bytes.NewReader(make([]byte, MaxSketchSize+1)))
+	require.NoError(t, err)
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestTransportStaleness(t *testing.T) {
+	last := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mem := topk.NewMemoryTransport()
+	tk := topk.New(5)
+	tk.SetClock(func() time.Time { return last })
+	tk.Insert("a", 1)
+	require.NoError(t, mem.SendSketch(context.Background(), "s", tk))
+
+	srv := httptest.NewServer(TransportHandler(mem, nil))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/s")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, last.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+
+	f := &topk.Follower{Transport: &Transport{URL: srv.URL, Client: srv.Client()}, Name: "s"}
+	require.NoError(t, f.Sync(context.Background()))
+	assert.True(t, last.Equal(f.Staleness().LastInsert))
+}
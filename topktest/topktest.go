@@ -0,0 +1,84 @@
+// Package topktest provides the invariants of the topk estimates as
+// reusable checks, so that property-based tests can be run against wrappers
+// and custom sketches as well as the ones in package topk.
+package topktest
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/axiomhq/topk"
+)
+
+// Estimator is a sketch answering point queries.
+type Estimator interface {
+	Estimate(x string) topk.Element
+}
+
+// Counter is a sketch keeping track of the total inserted weight.
+type Counter interface {
+	Count() int64
+}
+
+// CheckBounds returns a topk.Violation if e does not bound exact, i.e. if
+// its Count is below exact or its Count-Error is above exact.
+func CheckBounds(e topk.Element, exact int) error {
+	if e.Count < int64(exact) || e.Count-e.Error > int64(exact) {
+		return topk.Violation{Estimate: e, Exact: exact}
+	}
+	return nil
+}
+
+// CheckEstimates checks the estimates of s for all keys of exact, which maps
+// keys to their exact counts, and returns all violations.
+func CheckEstimates(s Estimator, exact map[string]int) error {
+	var errs []error
+	for k, v := range exact {
+		if err := CheckBounds(s.Estimate(k), v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckTotal checks that the total count of s is the total weight of exact.
+func CheckTotal(s Counter, exact map[string]int) error {
+	total := 0
+	for _, v := range exact {
+		total += v
+	}
+	if got := s.Count(); got != int64(total) {
+		return fmt.Errorf("topktest: total count is %d, expected %d", got, total)
+	}
+	return nil
+}
+
+// CheckMonotone checks that no estimate of s for the keys of last dropped
+// below the count recorded in last, and records the current estimates in
+// last. Estimates must not decrease as long as a sketch is only inserted
+// into and merged, and evicts with topk.EvictMax: the default
+// topk.EvictOverwrite may lower alphas, and so estimates of unmonitored keys.
+func CheckMonotone(s Estimator, last map[string]int64) error {
+	var errs []error
+	for k, v := range last {
+		e := s.Estimate(k)
+		if e.Count < v {
+			errs = append(errs, fmt.Errorf("topktest: estimate for %q decreased from %d to %d", k, v, e.Count))
+		}
+		last[k] = e.Count
+	}
+	return errors.Join(errs...)
+}
+
+// CheckMerge checks that the estimates of merged, the result of merging
+// sketches over streams with the given exact counts, bound the combined
+// exact counts.
+func CheckMerge(merged Estimator, exact ...map[string]int) error {
+	combined := make(map[string]int)
+	for _, m := range exact {
+		for k, v := range m {
+			combined[k] += v
+		}
+	}
+	return CheckEstimates(merged, combined)
+}
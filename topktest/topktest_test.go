@@ -0,0 +1,64 @@
+package topktest
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/axiomhq/topk"
+	"github.com/stretchr/testify/assert"
+)
+
+func insert(tk *topk.TopK, exact map[string]int, r *rand.Rand, n, scale int) {
+	for i := 0; i < n; i++ {
+		word := fmt.Sprintf("word-%d", int(r.ExpFloat64()*float64(scale)))
+		tk.Insert(word, 1)
+		exact[word]++
+	}
+}
+
+func TestInvariants(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tk := topk.New(10)
+	tk.SetEvictionPolicy(topk.EvictMax)
+	exact := make(map[string]int)
+	last := make(map[string]int64)
+
+	for i := 0; i < 10; i++ {
+		insert(tk, exact, r, 1000, 20)
+		for k := range exact {
+			if _, ok := last[k]; !ok {
+				last[k] = 0
+			}
+		}
+		assert.NoError(t, CheckEstimates(tk, exact))
+		assert.NoError(t, CheckTotal(tk, exact))
+		assert.NoError(t, CheckMonotone(tk, last))
+	}
+
+	assert.NoError(t, CheckMonotone(tk, last))
+}
+
+func TestMergeInvariants(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tk1, tk2 := topk.New(10), topk.New(10)
+	exact1, exact2 := make(map[string]int), make(map[string]int)
+
+	// few enough keys for the merged elements to fit
+	insert(tk1, exact1, r, 1000, 2)
+	insert(tk2, exact2, r, 1000, 2)
+	assert.NoError(t, tk1.Merge(tk2))
+	assert.NoError(t, CheckMerge(tk1, exact1, exact2))
+}
+
+func TestViolations(t *testing.T) {
+	assert.NoError(t, CheckBounds(topk.Element{Key: "a", Count: 10, Error: 5}, 7))
+	assert.Error(t, CheckBounds(topk.Element{Key: "a", Count: 6}, 7))
+	assert.Error(t, CheckBounds(topk.Element{Key: "a", Count: 10, Error: 2}, 7))
+
+	tk := topk.New(10)
+	tk.Insert("a", 2)
+	assert.Error(t, CheckEstimates(tk, map[string]int{"a": 3}))
+	assert.Error(t, CheckTotal(tk, map[string]int{"a": 3}))
+	assert.Error(t, CheckMonotone(tk, map[string]int64{"a": 3}))
+}
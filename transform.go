@@ -0,0 +1,148 @@
+package topk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Transformer wraps the byte streams written by Encode and read by Decode,
+// e.g. to compress or encrypt snapshots. It is configured once on a Stream
+// with SetTransformer and then applied to every Encode and Decode call.
+type Transformer interface {
+	// NewWriter returns a writer transforming everything written to it
+	// before passing it on to w. It is closed once encoding is complete.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader reverting the transformation of NewWriter.
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// SetTransformer configures the Transformer applied by Encode and Decode.
+// A nil Transformer disables the transformation.
+func (s *Stream) SetTransformer(t Transformer) {
+	s.transform = t
+}
+
+func encodeTo(w io.Writer, t Transformer, enc func(encoder) error) error {
+	if t == nil {
+		return encodeChecked(w, enc)
+	}
+
+	tw, err := t.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := encodeChecked(tw, enc); err != nil {
+		tw.Close()
+		return err
+	}
+	return tw.Close()
+}
+
+// encodeChecked encodes to w, followed by the checksum of the encoding.
+func encodeChecked(w io.Writer, enc func(encoder) error) error {
+	h := crc32.New(castagnoli)
+	wrt := newEncoder(io.MultiWriter(w, h))
+	if err := enc(wrt); err != nil {
+		return err
+	}
+	if err := wrt.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(checksum(h.Sum32()))
+	return err
+}
+
+// decodeFrom reads all of r and decodes it with dec. Unless partial is
+// set, the checksum of version 2 snapshots is verified first.
+func decodeFrom(r io.Reader, t Transformer, partial bool, dec func(decoder) error) error {
+	if t != nil {
+		var err error
+		if r, err = t.NewReader(r); err != nil {
+			return err
+		}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil && !partial {
+		return err
+	}
+	if !partial {
+		if err := verifyChecksum(data); err != nil {
+			return err
+		}
+	}
+	return dec(newDecoder(bytes.NewReader(data)))
+}
+
+// Version 2 snapshots end with the CRC-32C of everything before it, encoded
+// as a MessagePack uint32 so that the snapshot remains valid MessagePack.
+const checksumSize = 5
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is wrapped by the DecodeError returned for snapshots
+// that don't match their checksum, e.g. because they were truncated or
+// corrupted in storage.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+func checksum(sum uint32) []byte {
+	b := make([]byte, checksumSize)
+	b[0] = 0xce // uint32
+	binary.BigEndian.PutUint32(b[1:], sum)
+	return b
+}
+
+// magicPrefix is the encoding of formatMagic.
+var magicPrefix = func() []byte {
+	buf := bytes.NewBuffer(nil)
+	enc := newEncoder(buf)
+	enc.WriteInt(formatMagic)
+	enc.Flush()
+	return buf.Bytes()
+}()
+
+// verifyChecksum verifies the checksum of data if it is a version 2
+// snapshot. Other versions are left to the decoder.
+func verifyChecksum(data []byte) error {
+	if !bytes.HasPrefix(data, magicPrefix) || len(data) == len(magicPrefix) {
+		return nil
+	}
+	if v := data[len(magicPrefix)]; v < 2 || v > formatVersion {
+		return nil
+	}
+	n := len(data) - checksumSize
+	if n <= len(magicPrefix) || !bytes.Equal(data[n:], checksum(crc32.Checksum(data[:n], castagnoli))) {
+		return &DecodeError{Section: "checksum", Err: ErrChecksumMismatch}
+	}
+	return nil
+}
+
+// Gzip returns a Transformer compressing snapshots with gzip at the given
+// level, e.g. gzip.BestSpeed or gzip.DefaultCompression. The alphas are
+// mostly small counts and compress very well. Decoding recognizes gzip by
+// its magic bytes and reads other input as is, so snapshots written before
+// compression was enabled still decode. Other algorithms, e.g. zstd, can be
+// plugged in with a Transformer of their own.
+func Gzip(level int) Transformer {
+	return gzipCompression{level: level}
+}
+
+type gzipCompression struct {
+	level int
+}
+
+func (g gzipCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, g.level)
+}
+
+func (gzipCompression) NewReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
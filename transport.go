@@ -0,0 +1,80 @@
+package topk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSketchNotFound is returned by a Transport for unknown sketch names.
+var ErrSketchNotFound = errors.New("topk: sketch not found")
+
+// Transport moves sketches between processes. Distribution features are
+// written against it, so a custom RPC stack can be plugged in by
+// implementing it. Package topkhttp implements it over HTTP.
+type Transport interface {
+	// SendSketch stores a copy of tk under name at the remote end.
+	SendSketch(ctx context.Context, name string, tk *TopK) error
+	// FetchSketch returns a copy of the sketch stored under name.
+	FetchSketch(ctx context.Context, name string) (*TopK, error)
+	// QueryEstimate returns the estimate for key of the sketch stored under
+	// name, without transferring the sketch.
+	QueryEstimate(ctx context.Context, name, key string) (Element, error)
+}
+
+// MemoryTransport is a Transport keeping encoded sketches in memory. It is
+// safe for concurrent use.
+type MemoryTransport struct {
+	// NewSketch returns the empty sketch a fetched sketch is decoded into,
+	// configured to decode the sent sketches, e.g. with the same
+	// Transformer or hasher. If nil, a zero TopK is used.
+	NewSketch func() *TopK
+
+	mu       sync.RWMutex
+	sketches map[string][]byte
+}
+
+// NewMemoryTransport returns an empty MemoryTransport.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{sketches: make(map[string][]byte)}
+}
+
+// SendSketch ...
+func (m *MemoryTransport) SendSketch(_ context.Context, name string, tk *TopK) error {
+	buf := bytes.NewBuffer(nil)
+	if err := tk.Encode(buf); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.sketches[name] = buf.Bytes()
+	m.mu.Unlock()
+	return nil
+}
+
+// FetchSketch ...
+func (m *MemoryTransport) FetchSketch(_ context.Context, name string) (*TopK, error) {
+	m.mu.RLock()
+	b, ok := m.sketches[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrSketchNotFound
+	}
+	tk := &TopK{}
+	if m.NewSketch != nil {
+		tk = m.NewSketch()
+	}
+	if err := tk.Decode(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return tk, nil
+}
+
+// QueryEstimate ...
+func (m *MemoryTransport) QueryEstimate(ctx context.Context, name, key string) (Element, error) {
+	tk, err := m.FetchSketch(ctx, name)
+	if err != nil {
+		return Element{}, err
+	}
+	return tk.Estimate(key), nil
+}
@@ -0,0 +1,61 @@
+package topk
+
+import (
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTransport(t *testing.T, tr Transport) {
+	ctx := context.Background()
+
+	_, err := tr.FetchSketch(ctx, "missing")
+	assert.ErrorIs(t, err, ErrSketchNotFound)
+	_, err = tr.QueryEstimate(ctx, "missing", "foo")
+	assert.ErrorIs(t, err, ErrSketchNotFound)
+
+	tk := New(10)
+	tk.Insert("foo", 3)
+	tk.Insert("bar", 1)
+	assert.NoError(t, tr.SendSketch(ctx, "a/b", tk))
+
+	// later changes are not visible
+	tk.Insert("foo", 1)
+
+	fetched, err := tr.FetchSketch(ctx, "a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []Element{{Key: "foo", Count: 3}, {Key: "bar", Count: 1}}, fetched.Keys())
+	assert.Equal(t, int64(4), fetched.Count())
+
+	e, err := tr.QueryEstimate(ctx, "a/b", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, Element{Key: "foo", Count: 3}, e)
+}
+
+func TestMemoryTransport(t *testing.T) {
+	testTransport(t, NewMemoryTransport())
+}
+
+func TestMemoryTransportTransformer(t *testing.T) {
+	ctx := context.Background()
+	tr := NewMemoryTransport()
+	tk := New(10)
+	tk.SetTransformer(Gzip(gzip.BestSpeed))
+	tk.Insert("foo", 3)
+	require.NoError(t, tr.SendSketch(ctx, "a", tk))
+
+	// the sketch can only be decoded with the transformer
+	_, err := tr.FetchSketch(ctx, "a")
+	assert.Error(t, err)
+	tr.NewSketch = func() *TopK {
+		tk := New(10)
+		tk.SetTransformer(Gzip(gzip.BestSpeed))
+		return tk
+	}
+	fetched, err := tr.FetchSketch(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, tk.Keys(), fetched.Keys())
+}
@@ -0,0 +1,51 @@
+package topk
+
+// View is an immutable snapshot of a ConcurrentStream, see Snapshot. Its
+// methods take no locks and are safe for concurrent use, provided the
+// pipeline stages and redactor of the Stream are.
+type View struct {
+	s *Stream
+}
+
+// Snapshot returns a View of the current state. Taking it copies nothing:
+// the View shares the state of the Stream, and the next write copies it
+// before modifying it instead, so that many readers can query the View
+// without locking while a single writer keeps inserting. Without writes in
+// between, successive calls return the same View.
+func (c *ConcurrentStream) Snapshot() *View {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.view == nil {
+		c.view = &View{s: c.s}
+	}
+	return c.view
+}
+
+// own gives the writer its own copy of the Stream if a View shares it. It
+// must be called under the write lock.
+func (c *ConcurrentStream) own() {
+	if c.view == nil {
+		return
+	}
+	s := c.s.Clone()
+	s.promote = c.s.promote
+	c.s, c.view = s, nil
+}
+
+// Keys is like Stream.Keys.
+func (v *View) Keys() []Element { return v.s.Keys() }
+
+// AppendKeys is like Stream.AppendKeys.
+func (v *View) AppendKeys(dst []Element) []Element { return v.s.AppendKeys(dst) }
+
+// TopN is like Stream.TopN.
+func (v *View) TopN(m int) []Element { return v.s.TopN(m) }
+
+// Estimate is like Stream.Estimate.
+func (v *View) Estimate(x string) Element { return v.s.Estimate(x) }
+
+// Rank is like Stream.Rank.
+func (v *View) Rank(x string) (int, bool) { return v.s.Rank(x) }
+
+// Count is like Stream.Count.
+func (v *View) Count() int64 { return v.s.Count() }
@@ -0,0 +1,115 @@
+package topk
+
+import (
+	"fmt"
+	"math"
+)
+
+// MergeWeighted merges other into s with all of its counts multiplied by
+// weight, e.g. 10 for a sketch of traffic sampled at 1:10, so that sketches
+// of different sampling rates are combined at their true volume. Scaled
+// counts are rounded up and guaranteed counts down, so estimates stay
+// bounds of the scaled counts. other is not modified. See Merge.
+func (s *Stream) MergeWeighted(other *Stream, weight float64) error {
+	if !(weight > 0) || math.IsInf(weight, 1) {
+		return fmt.Errorf("topk: invalid merge weight %v", weight)
+	}
+	return s.labelled("merge", func() error {
+		scaled, ok := other.scaled(weight)
+		if !ok && s.strict {
+			return ErrCountOverflow
+		}
+		if err := s.merge(scaled, nil); err != nil {
+			return err
+		}
+		s.saturated = s.saturated || !ok
+		return nil
+	})
+}
+
+// MergeWeighted merges other into t with all of its counts multiplied by
+// weight. See Stream.MergeWeighted and Merge.
+func (t *TopK) MergeWeighted(other *TopK, weight float64) error {
+	if err := t.checkMerge(other); err != nil {
+		return err
+	}
+	return t.Stream.MergeWeighted(t.alignDecay(other), weight)
+}
+
+// scaled returns a copy of s with its counts multiplied by weight. ok is
+// false if a count saturated.
+func (s *Stream) scaled(weight float64) (res *Stream, ok bool) {
+	ok = true
+	scale := func(c int64, round func(float64) float64) int64 {
+		c, sok := scaleCount(c, weight, round)
+		ok = ok && sok
+		return c
+	}
+
+	res = emptyLike(s)
+	res.first, res.last = s.first, s.last
+	res.c = scale(s.c, math.Ceil)
+	for i, a := range s.alphas {
+		res.alphas[i] = scale(a, math.Ceil)
+	}
+	eMap := make(map[string]Element, len(s.k.elts))
+	for _, e := range s.k.elts {
+		c := scale(e.Count, math.Ceil)
+		eMap[e.Key] = Element{Key: e.Key, Count: c, Error: c - scale(e.Count-e.Error, math.Floor)}
+	}
+	res.k, _ = res.mergedKeys(eMap)
+	return res, ok
+}
+
+// scaleCount returns c multiplied by weight and rounded with round,
+// saturating at the largest int64. ok is false if it saturated.
+func scaleCount(c int64, weight float64, round func(float64) float64) (int64, bool) {
+	f := round(float64(c) * weight)
+	if f >= math.MaxInt64 {
+		return math.MaxInt64, false
+	}
+	return int64(f), true
+}
+
+// InsertWeighted inserts x with weight w, e.g. the bytes of a transfer or
+// the latency of a request, to track keys by their total weight rather than
+// by their number of events. w is counted in units set by WithWeightUnit,
+// rounded to the nearest whole unit; counts and errors of the returned and
+// reported elements are in units too, see Weight. A negative weight removes
+// weight as Remove does, and NaN counts as 0.
+func (s *Stream) InsertWeighted(x string, w float64) Element {
+	if w < 0 {
+		return s.Remove(x, s.units(-w))
+	}
+	return s.Insert(x, s.units(w))
+}
+
+// InsertWeighted inserts x with weight w. See Stream.InsertWeighted.
+func (t *TopK) InsertWeighted(x string, w float64) Element {
+	if t.halfLife > 0 {
+		t.autoDecay()
+	}
+	return t.Stream.InsertWeighted(x, w)
+}
+
+// Weight returns the weight of count units, e.g. of the Count or the Error
+// of an element inserted with InsertWeighted. See WithWeightUnit.
+func (s *Stream) Weight(count int64) float64 {
+	if s.unit == 0 {
+		return float64(count)
+	}
+	return float64(count) * s.unit
+}
+
+// units returns the non-negative weight w in whole units, saturating at
+// the largest int.
+func (s *Stream) units(w float64) int {
+	if s.unit != 0 {
+		w /= s.unit
+	}
+	if !(w > 0) {
+		return 0
+	}
+	c, _ := scaleCount(1, w, math.Round)
+	return int(min(c, math.MaxInt))
+}
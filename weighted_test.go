@@ -0,0 +1,93 @@
+package topk
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeWeighted(t *testing.T) {
+	full, sampled := New(100), New(100)
+	exact := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		x := fmt.Sprintf("word-%d", i%50)
+		exact[x] += 2
+		full.Insert(x, 1)
+		if i/50%10 == 0 {
+			sampled.Insert(x, 1)
+		}
+	}
+
+	// the sampled sketch counts every 10th round of inserts, so scaling it
+	// by 10 counts as many inserts as the full one
+	assert.NoError(t, full.MergeWeighted(sampled, 10))
+	assert.Equal(t, int64(20000), full.Count())
+	r := EvaluateSketch(full, exact, 10)
+	assert.Empty(t, r.Violations)
+	assert.Equal(t, 1.0, r.Recall)
+	assert.Equal(t, int64(1000), sampled.Count())
+
+	for _, w := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		assert.Error(t, full.MergeWeighted(sampled, w), "weight %v", w)
+	}
+}
+
+func TestMergeWeightedBounds(t *testing.T) {
+	s1, s2 := New(5).Stream, New(5).Stream
+	exact := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		x := fmt.Sprintf("word-%d", i%17)
+		s2.Insert(x, 3)
+		exact[x] += 3
+	}
+
+	// counts are scaled to halves, which must round to bounds
+	assert.NoError(t, s1.MergeWeighted(s2, 0.5))
+	for x, c := range exact {
+		e := s1.Estimate(x)
+		assert.GreaterOrEqual(t, e.Count, int64((c+1)/2), x)
+		assert.LessOrEqual(t, e.Count-e.Error, int64(c/2), x)
+	}
+}
+
+func TestMergeWeightedOverflow(t *testing.T) {
+	s1, s2 := New(5).Stream, New(5).Stream
+	s2.Insert("a", 1)
+	setCount(s2, "a", math.MaxInt64/2)
+	assert.NoError(t, s1.MergeWeighted(s2, 4))
+	assert.Equal(t, int64(math.MaxInt64), s1.Estimate("a").Count)
+	assert.True(t, s1.Stats().Saturated)
+
+	s1 = New(5).Stream
+	s1.SetStrictCounts(true)
+	assert.ErrorIs(t, s1.MergeWeighted(s2, 4), ErrCountOverflow)
+	assert.Zero(t, s1.Estimate("a").Count)
+}
+
+func TestInsertWeighted(t *testing.T) {
+	tk := New(10, WithWeightUnit(0.001))
+	exact := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		x := fmt.Sprintf("endpoint-%d", i%20)
+		// latency in seconds, the larger for the higher endpoints
+		w := float64(i%20+1) * 0.0125
+		tk.InsertWeighted(x, w)
+		exact[x] += int(math.Round(w * 1000))
+	}
+	r := EvaluateSketch(tk, exact, 10)
+	assert.Empty(t, r.Violations)
+	assert.Equal(t, 1.0, r.Recall)
+	assert.Equal(t, "endpoint-19", tk.Keys()[0].Key)
+	assert.InDelta(t, 500*0.25, tk.Weight(tk.Keys()[0].Count), 1e-9)
+
+	// counts are in units, and weights round to the nearest one
+	tk = New(10)
+	assert.Equal(t, int64(3), tk.InsertWeighted("a", 2.6).Count)
+	assert.Equal(t, int64(3), tk.InsertWeighted("a", 0.4).Count)
+	assert.Equal(t, int64(1), tk.InsertWeighted("a", -1.7).Count)
+	assert.Equal(t, int64(1), tk.InsertWeighted("a", math.NaN()).Count)
+	assert.Equal(t, int64(math.MaxInt), tk.InsertWeighted("b", math.Inf(1)).Count)
+	assert.Equal(t, 3.0, tk.Weight(3))
+}
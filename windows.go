@@ -0,0 +1,232 @@
+package topk
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Windows counts the top elements separately per epoch, e.g. per minute of
+// event time. Inserts may arrive out of order as long as their epoch is one
+// of the retained most recent epochs.
+type Windows struct {
+	k       int
+	retain  uint32
+	latest  uint32
+	windows map[uint32]*TopK
+
+	lateness  uint32
+	watermark uint32
+	sink      Sink
+	errs      []error // of the Sink, returned by AdvanceWatermark
+
+	historySize int
+	history     []Window // ascending by epoch
+	archive     Archive
+	pipeline    []Stage
+}
+
+// Window is the final result of an epoch.
+type Window struct {
+	Epoch uint32    `json:"epoch"`
+	Count int64     `json:"count"`
+	Keys  []Element `json:"keys"`
+	// Bound is an upper bound of the count of every key not in Keys, e.g.
+	// because it ranked below the top k or was dropped by the pipeline.
+	Bound int64 `json:"bound"`
+}
+
+// NewWindows returns Windows tracking the top k elements of each of the
+// last retain epochs.
+func NewWindows(k int, retain uint32) *Windows {
+	return &Windows{
+		k:       k,
+		retain:  max(retain, 1),
+		windows: make(map[uint32]*TopK, retain),
+	}
+}
+
+// InsertAt adds count for x to the given epoch. It returns false, and
+// discards the insert, if the epoch is older than the retained epochs or
+// has been finalized by AdvanceWatermark.
+// Inserting into a newer epoch finalizes the windows that are no longer
+// retained, like AdvanceWatermark: they are recorded in the history and
+// emitted to the Sink, whose errors are returned by the next call to
+// AdvanceWatermark.
+func (w *Windows) InsertAt(x string, count int, epoch uint32) (Element, bool) {
+	if len(w.windows) > 0 && uint64(epoch)+uint64(w.retain) <= uint64(w.latest) {
+		return Element{}, false
+	}
+	if w.final(epoch) {
+		return Element{}, false
+	}
+	if len(w.windows) == 0 || epoch > w.latest {
+		w.latest = epoch
+		for _, e := range w.Epochs() {
+			if uint64(e)+uint64(w.retain) > uint64(epoch) {
+				break
+			}
+			if _, err := w.finalize(e); err != nil {
+				w.errs = append(w.errs, err)
+			}
+		}
+	}
+
+	tk, ok := w.windows[epoch]
+	if !ok {
+		tk = New(w.k, WithPipeline(w.pipeline...))
+		w.windows[epoch] = tk
+	}
+	return tk.Insert(x, count), true
+}
+
+// Window returns the sketch of epoch, or nil if it is not retained.
+func (w *Windows) Window(epoch uint32) *TopK {
+	return w.windows[epoch]
+}
+
+// Epochs returns the retained epochs in ascending order.
+func (w *Windows) Epochs() []uint32 {
+	res := make([]uint32, 0, len(w.windows))
+	for e := range w.windows {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// SetLateness sets how many epochs behind the watermark inserts are still
+// accepted, 0 by default.
+func (w *Windows) SetLateness(lateness uint32) {
+	w.lateness = lateness
+}
+
+// final reports whether epoch can no longer receive inserts.
+func (w *Windows) final(epoch uint32) bool {
+	return uint64(epoch)+uint64(w.lateness) < uint64(w.watermark)
+}
+
+// SetSink sets the Sink finalized windows are emitted to.
+func (w *Windows) SetSink(sink Sink) {
+	w.sink = sink
+}
+
+// AdvanceWatermark declares that no more events older than watermark will
+// arrive, apart from the allowed lateness. It finalizes every window that
+// can no longer receive inserts, removes it and returns its result, in
+// ascending order of epochs. If a Sink is set, the windows are emitted to
+// it as well, and the errors it returned are returned. The watermark never
+// moves backwards.
+func (w *Windows) AdvanceWatermark(watermark uint32) ([]Window, error) {
+	if watermark <= w.watermark {
+		return nil, nil
+	}
+	w.watermark = watermark
+
+	var res []Window
+	errs := w.errs
+	w.errs = nil
+	for _, epoch := range w.Epochs() {
+		if !w.final(epoch) {
+			break
+		}
+		win, err := w.finalize(epoch)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		res = append(res, win)
+	}
+	return res, errors.Join(errs...)
+}
+
+// finalize removes the window of epoch, records it in the history and emits
+// it to the Sink.
+func (w *Windows) finalize(epoch uint32) (Window, error) {
+	tk := w.windows[epoch]
+	keys := tk.Keys()
+	win := Window{Epoch: epoch, Count: tk.Count(), Keys: keys, Bound: tk.unreported(keys)}
+	delete(w.windows, epoch)
+	w.record(win)
+	if w.sink != nil {
+		return win, w.sink.EmitWindow(win)
+	}
+	return win, nil
+}
+
+// SetHistory makes Windows keep the results of the last n finalized epochs,
+// available from History.
+func (w *Windows) SetHistory(n int) {
+	w.historySize = n
+	if len(w.history) > n {
+		w.history = w.history[len(w.history)-n:]
+	}
+}
+
+// History returns the retained finalized windows in ascending order of
+// epochs.
+func (w *Windows) History() []Window {
+	return append([]Window(nil), w.history...)
+}
+
+// record adds win to the history, replacing an existing window of the same
+// epoch.
+func (w *Windows) record(win Window) {
+	if w.historySize <= 0 {
+		return
+	}
+	i := sort.Search(len(w.history), func(i int) bool { return w.history[i].Epoch >= win.Epoch })
+	switch {
+	case i < len(w.history) && w.history[i].Epoch == win.Epoch:
+		w.history[i] = win
+	case i == 0 && len(w.history) == w.historySize:
+		// older than everything retained
+		return
+	default:
+		w.history = append(w.history, Window{})
+		copy(w.history[i+1:], w.history[i:])
+		w.history[i] = win
+	}
+	if len(w.history) > w.historySize {
+		w.history = w.history[1:]
+	}
+}
+
+// Event is a timestamped insert.
+type Event struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	Epoch uint32 `json:"epoch"`
+}
+
+// Replay reconstructs the windows of historical events, e.g. to backfill an
+// outage. The events are counted by a separate Windows with the same
+// configuration, as if they arrived live: the watermark follows the latest
+// epoch seen, so out of order events are accepted within the lateness and
+// dropped otherwise. Once all events are consumed, the remaining windows
+// are finalized as well. The resulting windows are added to the history of
+// w, replacing windows of the same epochs, and returned in ascending order
+// of epochs. The live windows of w are not affected.
+func (w *Windows) Replay(events []Event) []Window {
+	r := NewWindows(w.k, w.retain)
+	r.SetLateness(w.lateness)
+	r.SetPipeline(w.pipeline...)
+	// windows are finalized by inserts as well as by the watermark
+	var res []Window
+	r.SetSink(SinkFunc(func(win Window) error {
+		res = append(res, win)
+		return nil
+	}))
+
+	for _, ev := range events {
+		if _, ok := r.InsertAt(ev.Key, ev.Count, ev.Epoch); !ok {
+			continue
+		}
+		r.AdvanceWatermark(r.latest)
+	}
+	r.AdvanceWatermark(uint32(min(uint64(r.latest)+uint64(r.lateness)+1, math.MaxUint32)))
+
+	for _, win := range res {
+		w.record(win)
+	}
+	return res
+}
@@ -0,0 +1,261 @@
+package topk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowsInsertAt(t *testing.T) {
+	w := NewWindows(10, 3)
+
+	_, ok := w.InsertAt("foo", 1, 10)
+	assert.True(t, ok)
+	_, ok = w.InsertAt("foo", 2, 12)
+	assert.True(t, ok)
+
+	// late, but within the retained epochs
+	e, ok := w.InsertAt("foo", 3, 10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), e.Count)
+	_, ok = w.InsertAt("bar", 1, 11)
+	assert.True(t, ok)
+	assert.Equal(t, []uint32{10, 11, 12}, w.Epochs())
+
+	// moving on drops epoch 10
+	_, ok = w.InsertAt("foo", 1, 13)
+	assert.True(t, ok)
+	assert.Equal(t, []uint32{11, 12, 13}, w.Epochs())
+	assert.Nil(t, w.Window(10))
+	_, ok = w.InsertAt("foo", 1, 10)
+	assert.False(t, ok)
+
+	assert.Equal(t, []Element{{Key: "foo", Count: 2}}, w.Window(12).Keys())
+
+	// epochs near the end of the range don't wrap around
+	w = NewWindows(10, 3)
+	_, ok = w.InsertAt("foo", 1, math.MaxUint32-1)
+	assert.True(t, ok)
+	_, ok = w.InsertAt("foo", 1, math.MaxUint32)
+	assert.True(t, ok)
+	_, ok = w.InsertAt("foo", 1, math.MaxUint32-2)
+	assert.True(t, ok)
+	assert.Equal(t, []uint32{math.MaxUint32 - 2, math.MaxUint32 - 1, math.MaxUint32}, w.Epochs())
+}
+
+func TestWindowsWatermark(t *testing.T) {
+	w := NewWindows(10, 10)
+	w.SetLateness(1)
+
+	w.InsertAt("foo", 1, 1)
+	w.InsertAt("foo", 2, 2)
+	w.InsertAt("bar", 3, 3)
+
+	// epoch 1 may still receive late data
+	res, err := w.AdvanceWatermark(2)
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+	_, ok := w.InsertAt("foo", 1, 1)
+	assert.True(t, ok)
+
+	res, err = w.AdvanceWatermark(4)
+	assert.NoError(t, err)
+	assert.Equal(t, []Window{
+		{Epoch: 1, Count: 2, Keys: []Element{{Key: "foo", Count: 2}}},
+		{Epoch: 2, Count: 2, Keys: []Element{{Key: "foo", Count: 2}}},
+	}, res)
+	assert.Equal(t, []uint32{3}, w.Epochs())
+
+	_, ok = w.InsertAt("foo", 1, 2)
+	assert.False(t, ok)
+	_, ok = w.InsertAt("foo", 1, 3)
+	assert.True(t, ok)
+
+	// no going back
+	res, err = w.AdvanceWatermark(1)
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+	_, ok = w.InsertAt("foo", 1, 1)
+	assert.False(t, ok)
+}
+
+func TestWindowsSink(t *testing.T) {
+	var emitted []Window
+	w := NewWindows(10, 10)
+	w.SetSink(SinkFunc(func(win Window) error {
+		emitted = append(emitted, win)
+		if win.Epoch == 2 {
+			return errors.New("failed")
+		}
+		return nil
+	}))
+
+	w.InsertAt("foo", 1, 1)
+	w.InsertAt("foo", 1, 2)
+	w.InsertAt("foo", 1, 3)
+	res, err := w.AdvanceWatermark(3)
+	assert.Error(t, err)
+	assert.Equal(t, res, emitted)
+	assert.Equal(t, 2, len(emitted))
+}
+
+func TestWindowsSinkRetain(t *testing.T) {
+	var emitted []Window
+	w := NewWindows(10, 2)
+	w.SetHistory(10)
+	w.SetSink(SinkFunc(func(win Window) error {
+		emitted = append(emitted, win)
+		if win.Epoch == 2 {
+			return errors.New("failed")
+		}
+		return nil
+	}))
+
+	// moving past the retained epochs finalizes the dropped windows
+	w.InsertAt("foo", 1, 1)
+	w.InsertAt("foo", 2, 2)
+	w.InsertAt("bar", 3, 3)
+	w.InsertAt("bar", 1, 4)
+	assert.Equal(t, []uint32{3, 4}, w.Epochs())
+	assert.Equal(t, []Window{
+		{Epoch: 1, Count: 1, Keys: []Element{{Key: "foo", Count: 1}}},
+		{Epoch: 2, Count: 2, Keys: []Element{{Key: "foo", Count: 2}}},
+	}, emitted)
+	assert.Equal(t, emitted, w.History())
+
+	// the error of the Sink is returned once
+	_, err := w.AdvanceWatermark(1)
+	assert.Error(t, err)
+	_, err = w.AdvanceWatermark(2)
+	assert.NoError(t, err)
+}
+
+func TestSinks(t *testing.T) {
+	win := Window{Epoch: 1, Count: 3, Keys: []Element{{Key: "foo", Count: 3}}}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, JSONSink{W: buf}.EmitWindow(win))
+	assert.NoError(t, JSONSink{W: buf}.EmitWindow(win))
+	dec := json.NewDecoder(buf)
+	for i := 0; i < 2; i++ {
+		var got Window
+		assert.NoError(t, dec.Decode(&got))
+		assert.Equal(t, win, got)
+	}
+
+	ch := make(chan Window, 1)
+	assert.NoError(t, ChanSink(ch).EmitWindow(win))
+	assert.Equal(t, win, <-ch)
+}
+
+func TestWindowsReplay(t *testing.T) {
+	w := NewWindows(10, 10)
+	w.SetHistory(3)
+
+	w.InsertAt("live", 1, 1)
+	w.InsertAt("live", 1, 4)
+	w.InsertAt("live", 1, 5)
+	w.AdvanceWatermark(5)
+	assert.Equal(t, []uint32{1, 4}, epochs(w.History()))
+
+	// epochs 2 and 3 are missing, 0 is too old to be kept
+	res := w.Replay([]Event{
+		{Key: "a", Count: 1, Epoch: 0},
+		{Key: "a", Count: 1, Epoch: 2},
+		{Key: "b", Count: 2, Epoch: 3},
+		{Key: "a", Count: 1, Epoch: 2}, // late
+		{Key: "a", Count: 3, Epoch: 3},
+	})
+	assert.Equal(t, []uint32{0, 2, 3}, epochs(res))
+	assert.Equal(t, []Element{{Key: "a", Count: 1}}, res[1].Keys)
+	assert.Equal(t, []uint32{2, 3, 4}, epochs(w.History()))
+	assert.Equal(t, []uint32{5}, w.Epochs())
+
+	// with lateness, the late event is counted
+	w.SetLateness(1)
+	res = w.Replay([]Event{
+		{Key: "a", Count: 1, Epoch: 2},
+		{Key: "b", Count: 2, Epoch: 3},
+		{Key: "a", Count: 1, Epoch: 2},
+	})
+	assert.Equal(t, []Element{{Key: "a", Count: 2}}, res[0].Keys)
+}
+
+func epochs(wins []Window) []uint32 {
+	var res []uint32
+	for _, w := range wins {
+		res = append(res, w.Epoch)
+	}
+	return res
+}
+
+func TestWindowsQuery(t *testing.T) {
+	w := NewWindows(2, 10)
+	w.SetHistory(10)
+	w.SetArchive(ArchiveFunc(func(from, to uint32) ([]Window, error) {
+		return []Window{
+			{Epoch: 1, Count: 30, Keys: []Element{{Key: "old", Count: 20}, {Key: "a", Count: 10}}},
+			// also in the history, which is preferred
+			{Epoch: 2, Count: 1000, Keys: []Element{{Key: "x", Count: 1000}}},
+		}, nil
+	}))
+
+	w.InsertAt("a", 5, 2)
+	w.InsertAt("b", 3, 2)
+	w.InsertAt("c", 1, 2)
+	_, err := w.AdvanceWatermark(3)
+	assert.NoError(t, err)
+	w.InsertAt("a", 4, 3)
+	w.InsertAt("d", 8, 3)
+
+	res, err := w.Query(1, 3, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []Element{
+		// 20 + at most 1 in epoch 2, where c was the largest unreported
+		{Key: "old", Count: 21, Error: 1},
+		// 10 + 5 + 4
+		{Key: "a", Count: 19},
+		// at most 10 in the full archived epoch 1, and 1 in epoch 2
+		{Key: "d", Count: 19, Error: 11},
+	}, res)
+
+	res, err = w.Query(3, 3, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Element{{Key: "d", Count: 8}}, res)
+
+	// keys dropped by the pipeline are bounded too
+	w = NewWindows(2, 10)
+	w.SetHistory(10)
+	w.SetPipeline(Threshold(5))
+	w.InsertAt("a", 4, 1)
+	w.InsertAt("b", 12, 1)
+	w.InsertAt("a", 6, 2)
+	_, err = w.AdvanceWatermark(3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), w.History()[0].Bound)
+	res, err = w.Query(1, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []Element{{Key: "b", Count: 12}, {Key: "a", Count: 10, Error: 4}}, res)
+
+	// with a live window, estimates stay bounds of the exact counts
+	exact := map[string]int64{"a": 13, "b": 12, "c": 6}
+	w.InsertAt("a", 3, 3)
+	w.InsertAt("c", 6, 3)
+	res, err = w.Query(1, 3, 3)
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	for _, e := range res {
+		assert.GreaterOrEqual(t, e.Count, exact[e.Key], e.Key)
+		assert.LessOrEqual(t, e.Count-e.Error, exact[e.Key], e.Key)
+	}
+
+	w.SetArchive(ArchiveFunc(func(from, to uint32) ([]Window, error) {
+		return nil, errors.New("unavailable")
+	}))
+	_, err = w.Query(1, 3, 3)
+	assert.Error(t, err)
+}